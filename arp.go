@@ -0,0 +1,159 @@
+package packet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Constants for Ethernet frames carrying IPv4 ARP packets, from RFC 826.
+const (
+	etherTypeARP  = 0x0806
+	etherTypeIPv4 = 0x0800
+
+	arpHardwareEthernet = 1
+	arpOpRequest        = 1
+	arpOpReply          = 2
+
+	// The length of an Ethernet header followed by an IPv4 over Ethernet ARP
+	// packet.
+	arpFrameLen = 14 + 28
+)
+
+// ARPRequest produces a broadcast Ethernet frame carrying an ARP request from
+// srcMAC and srcIP which asks for the hardware address of dstIP. The frame is
+// ready to be passed to Conn.WriteTo on a Raw Conn, with a destination Addr of
+// the Ethernet broadcast address.
+//
+// srcMAC must be an Ethernet MAC address, and srcIP and dstIP must be IPv4
+// addresses. ARPRequest panics otherwise.
+func ARPRequest(srcMAC net.HardwareAddr, srcIP, dstIP net.IP) []byte {
+	if len(srcMAC) != 6 {
+		panic(fmt.Sprintf("packet: invalid ARP sender MAC address: %q", srcMAC))
+	}
+
+	sip, dip := srcIP.To4(), dstIP.To4()
+	if sip == nil || dip == nil {
+		panic(fmt.Sprintf("packet: invalid ARP IPv4 addresses: %q, %q", srcIP, dstIP))
+	}
+
+	// The target hardware address is unknown and left zero.
+	return arpFrame(
+		net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		arpOpRequest,
+		srcMAC, sip,
+		make(net.HardwareAddr, 6), dip,
+	)
+}
+
+// arpFrame produces an Ethernet frame destined for dst which carries an IPv4
+// over Ethernet ARP packet. The frame's source is the ARP sender.
+func arpFrame(dst net.HardwareAddr, op uint16, sha net.HardwareAddr, spa net.IP, tha net.HardwareAddr, tpa net.IP) []byte {
+	b := make([]byte, 0, arpFrameLen)
+
+	// Ethernet header.
+	b = append(b, dst...)
+	b = append(b, sha...)
+	b = binary.BigEndian.AppendUint16(b, etherTypeARP)
+
+	// ARP packet.
+	b = binary.BigEndian.AppendUint16(b, arpHardwareEthernet)
+	b = binary.BigEndian.AppendUint16(b, etherTypeIPv4)
+	b = append(b, 6, 4)
+	b = binary.BigEndian.AppendUint16(b, op)
+	b = append(b, sha...)
+	b = append(b, spa...)
+	b = append(b, tha...)
+	return append(b, tpa...)
+}
+
+// ARPResponder reads frames from c and replies to each ARP request for the
+// IPv4 address ip with an ARP reply indicating that ip is at the Ethernet MAC
+// address mac. c should be a Raw Conn bound to the ARP EtherType (0x0806);
+// frames which are not ARP requests for ip are ignored.
+//
+// ARPResponder blocks until ctx is canceled or c can no longer be read, such
+// as after it is closed, and then returns nil. It returns an error if ip or
+// mac are invalid, or if a reply cannot be written. Callers typically run
+// ARPResponder in its own goroutine.
+//
+// ARPResponder reads frames using Conn.Stream, so the same rules apply to the
+// Conn's read deadline and to concurrent reads.
+func ARPResponder(ctx context.Context, c *Conn, ip net.IP, mac net.HardwareAddr) error {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return fmt.Errorf("packet: invalid ARP responder IPv4 address: %q", ip)
+	}
+	if len(mac) != 6 {
+		return fmt.Errorf("packet: invalid ARP responder MAC address: %q", mac)
+	}
+
+	// Stop reading if a reply cannot be written, so that the goroutine
+	// started by Stream exits.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for f := range c.Stream(ctx, 0) {
+		reply, ok := arpReply(f.Data, ip4, mac)
+		c.putBuffer(f.Data)
+		if !ok {
+			continue
+		}
+
+		if _, err := c.WriteTo(reply, &Addr{HardwareAddr: reply[0:6]}); err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// arpReply produces the reply from mac to an ARP request frame if req is a
+// request for the IPv4 address ip.
+func arpReply(req []byte, ip net.IP, mac net.HardwareAddr) ([]byte, bool) {
+	sha, spa, op, ok := parseARP(req)
+	if !ok || op != arpOpRequest || !ip.Equal(req[38:42]) {
+		return nil, false
+	}
+
+	return arpFrame(sha, arpOpReply, mac, ip, sha, spa), true
+}
+
+// ParseARPReply parses an Ethernet frame carrying an IPv4 over Ethernet ARP
+// reply, such as one sent in response to a frame produced by ARPRequest. It
+// returns the hardware and IPv4 addresses of the reply's sender, and reports
+// false if frame is not such a reply.
+func ParseARPReply(frame []byte) (senderMAC net.HardwareAddr, senderIP net.IP, ok bool) {
+	mac, ip, op, ok := parseARP(frame)
+	if !ok || op != arpOpReply {
+		return nil, nil, false
+	}
+
+	return mac, ip, true
+}
+
+// parseARP parses an Ethernet frame carrying an IPv4 over Ethernet ARP packet
+// and returns its sender addresses and operation.
+func parseARP(frame []byte) (senderMAC net.HardwareAddr, senderIP net.IP, op uint16, ok bool) {
+	if len(frame) < arpFrameLen || binary.BigEndian.Uint16(frame[12:14]) != etherTypeARP {
+		return nil, nil, 0, false
+	}
+
+	arp := frame[14:arpFrameLen]
+	if binary.BigEndian.Uint16(arp[0:2]) != arpHardwareEthernet ||
+		binary.BigEndian.Uint16(arp[2:4]) != etherTypeIPv4 ||
+		arp[4] != 6 || arp[5] != 4 {
+		return nil, nil, 0, false
+	}
+
+	// Copy the addresses so they do not alias the caller's buffer.
+	senderMAC = append(net.HardwareAddr(nil), arp[8:14]...)
+	senderIP = append(net.IP(nil), arp[14:18]...)
+	return senderMAC, senderIP, binary.BigEndian.Uint16(arp[6:8]), true
+}
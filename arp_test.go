@@ -0,0 +1,123 @@
+package packet_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/packet"
+)
+
+var (
+	arpMAC = net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	arpSrc = net.IPv4(192, 0, 2, 1)
+	arpDst = net.IPv4(192, 0, 2, 2)
+)
+
+func TestARPRequest(t *testing.T) {
+	want := []byte{
+		// Ethernet: broadcast destination, source, EtherType ARP.
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		0x08, 0x06,
+		// ARP: Ethernet, IPv4, lengths 6 and 4, request.
+		0x00, 0x01,
+		0x08, 0x00,
+		0x06, 0x04,
+		0x00, 0x01,
+		// Sender hardware and protocol addresses.
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		192, 0, 2, 1,
+		// Target hardware and protocol addresses.
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		192, 0, 2, 2,
+	}
+
+	got := packet.ARPRequest(arpMAC, arpSrc, arpDst)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected ARP request (-want +got):\n%s", diff)
+	}
+}
+
+func TestARPRequestPanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected a panic for an IPv6 address")
+		}
+	}()
+
+	_ = packet.ARPRequest(arpMAC, net.IPv6loopback, arpDst)
+}
+
+func TestParseARPReply(t *testing.T) {
+	reply := []byte{
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x08, 0x06,
+		0x00, 0x01,
+		0x08, 0x00,
+		0x06, 0x04,
+		0x00, 0x02,
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+		192, 0, 2, 2,
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		192, 0, 2, 1,
+		// Ethernet padding to the minimum frame size.
+		0x00, 0x00, 0x00, 0x00,
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		mac   net.HardwareAddr
+		ip    net.IP
+		ok    bool
+	}{
+		{
+			name:  "OK",
+			frame: reply,
+			mac:   net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01},
+			ip:    net.IP{192, 0, 2, 2},
+			ok:    true,
+		},
+		{
+			name:  "short",
+			frame: reply[:41],
+		},
+		{
+			name:  "request",
+			frame: packet.ARPRequest(arpMAC, arpSrc, arpDst),
+		},
+		{
+			name: "not ARP",
+			frame: func() []byte {
+				b := append([]byte(nil), reply...)
+				b[12], b[13] = 0x08, 0x00
+				return b
+			}(),
+		},
+		{
+			name: "not IPv4",
+			frame: func() []byte {
+				b := append([]byte(nil), reply...)
+				b[16], b[17] = 0x86, 0xdd
+				return b
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mac, ip, ok := packet.ParseARPReply(tt.frame)
+			if diff := cmp.Diff(tt.ok, ok); diff != "" {
+				t.Fatalf("unexpected ok (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.mac, mac); diff != "" {
+				t.Fatalf("unexpected sender MAC (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.ip, ip); diff != "" {
+				t.Fatalf("unexpected sender IP (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
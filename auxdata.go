@@ -0,0 +1,85 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// auxdataLen is the length of a tpacket_auxdata structure.
+const auxdataLen = 20
+
+// tpacket_auxdata.tp_status bits from linux/if_packet.h.
+const (
+	tpStatusCsumNotReady  = 0x8
+	tpStatusVLANValid     = 0x10
+	tpStatusVLANTPIDValid = 0x40
+	tpStatusCsumValid     = 0x80
+)
+
+// Auxdata is the tpacket_auxdata metadata which the Linux kernel attaches to
+// each frame read from a Conn when Config.Auxdata is set.
+type Auxdata struct {
+	// Length is the original length of the frame, which may be larger than
+	// the number of bytes read if the frame was truncated.
+	Length uint32
+
+	// Snaplen is the number of bytes of the frame captured by the kernel.
+	Snaplen uint32
+
+	// VLANValid reports whether VLANTCI and VLANTPID are valid, and they are
+	// zero otherwise. Some network interfaces strip the VLAN tag from
+	// received frames and report it out-of-band instead.
+	VLANValid bool
+	VLANTCI   uint16
+	VLANTPID  uint16
+
+	// ChecksumValid reports whether the frame's transport layer checksum was
+	// validated by the kernel or network interface (CHECKSUM_UNNECESSARY), in
+	// which case the checksum need not be verified again. ChecksumValid is
+	// only set by Linux 4.11 and newer; on older kernels it is always false.
+	ChecksumValid bool
+
+	// ChecksumNotReady reports whether the frame's transport layer checksum
+	// has not yet been computed (CHECKSUM_PARTIAL). This is typical of frames
+	// transmitted by the local machine with checksum offload enabled.
+	ChecksumNotReady bool
+}
+
+// unmarshal unpacks a tpacket_auxdata structure, whose fields use the
+// specified byte order, into a. The kernel uses the host's native byte order.
+func (a *Auxdata) unmarshal(b []byte, order binary.ByteOrder) error {
+	if len(b) < auxdataLen {
+		return errors.New("packet: auxdata too short")
+	}
+
+	// struct tpacket_auxdata {
+	// 	__u32 tp_status;
+	// 	__u32 tp_len;
+	// 	__u32 tp_snaplen;
+	// 	__u16 tp_mac;
+	// 	__u16 tp_net;
+	// 	__u16 tp_vlan_tci;
+	// 	__u16 tp_vlan_tpid;
+	// };
+	status := order.Uint32(b[0:4])
+
+	*a = Auxdata{
+		Length:           order.Uint32(b[4:8]),
+		Snaplen:          order.Uint32(b[8:12]),
+		ChecksumValid:    status&tpStatusCsumValid != 0,
+		ChecksumNotReady: status&tpStatusCsumNotReady != 0,
+	}
+
+	// The VLAN fields are otherwise left uninitialized by the kernel.
+	if status&tpStatusVLANValid != 0 {
+		a.VLANValid = true
+		a.VLANTCI = order.Uint16(b[16:18])
+	}
+
+	// The TPID is reported separately by Linux 3.14 and newer.
+	if status&tpStatusVLANTPIDValid != 0 {
+		a.VLANTPID = order.Uint16(b[18:20])
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package packet
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAuxdataUnmarshal(t *testing.T) {
+	tests := []struct {
+		name   string
+		status uint32
+		a      *Auxdata
+		ok     bool
+	}{
+		{
+			name:   "no flags",
+			status: 0x1,
+			a:      &Auxdata{Length: 1514, Snaplen: 1500},
+			ok:     true,
+		},
+		{
+			name:   "checksum valid",
+			status: tpStatusCsumValid,
+			a:      &Auxdata{Length: 1514, Snaplen: 1500, ChecksumValid: true},
+			ok:     true,
+		},
+		{
+			name:   "checksum not ready",
+			status: tpStatusCsumNotReady,
+			a:      &Auxdata{Length: 1514, Snaplen: 1500, ChecksumNotReady: true},
+			ok:     true,
+		},
+		{
+			name:   "VLAN",
+			status: tpStatusVLANValid | tpStatusVLANTPIDValid,
+			a: &Auxdata{
+				Length:    1514,
+				Snaplen:   1500,
+				VLANValid: true,
+				VLANTCI:   10,
+				VLANTPID:  0x8100,
+			},
+			ok: true,
+		},
+		{
+			name:   "VLAN TPID only",
+			status: tpStatusVLANTPIDValid,
+			a:      &Auxdata{Length: 1514, Snaplen: 1500, VLANTPID: 0x8100},
+			ok:     true,
+		},
+		{
+			name: "short",
+		},
+	}
+
+	for _, order := range testByteOrders {
+		for _, tt := range tests {
+			t.Run(order.String()+"/"+tt.name, func(t *testing.T) {
+				var b []byte
+				if tt.ok {
+					b = make([]byte, auxdataLen)
+					order.PutUint32(b[0:4], tt.status)
+					order.PutUint32(b[4:8], 1514)
+					order.PutUint32(b[8:12], 1500)
+					order.PutUint16(b[12:14], 0)
+					order.PutUint16(b[14:16], 14)
+					order.PutUint16(b[16:18], 10)
+					order.PutUint16(b[18:20], 0x8100)
+				}
+
+				var a Auxdata
+				err := a.unmarshal(b, order)
+				if tt.ok && err != nil {
+					t.Fatalf("failed to unmarshal: %v", err)
+				}
+				if !tt.ok {
+					if err == nil {
+						t.Fatal("expected an error, but none occurred")
+					}
+					return
+				}
+
+				if diff := cmp.Diff(tt.a, &a); diff != "" {
+					t.Fatalf("unexpected Auxdata (-want +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
+
+// testByteOrders are the byte orders used to test parsing of structures which
+// the kernel produces in the host's native byte order.
+var testByteOrders = []binary.ByteOrder{binary.LittleEndian, binary.BigEndian}
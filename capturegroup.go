@@ -0,0 +1,179 @@
+package packet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// A CaptureGroup is a group of Conns which share a PACKET_FANOUT group in
+// which an eBPF program steers frames to members, and whose frames are merged
+// onto a single channel. CaptureGroup packages the pattern used by high
+// performance capture tools: the program assigns each flow to a member, each
+// member is read by its own goroutine, and consumers receive all frames from
+// one place.
+//
+// Members are not ring-backed: each reads frames with recvfrom(2), copying
+// one frame per system call exactly as Conn.Stream does. Package packet does
+// not implement memory-mapped PACKET_RX_RING capture, so a CaptureGroup scales
+// reads across goroutines but does not offer the per-frame cost of a ring
+// buffer.
+type CaptureGroup struct {
+	group  *FanoutGroup
+	frames chan Frame
+	cancel context.CancelFunc
+}
+
+// A CaptureGroupConfig configures a CaptureGroup created by
+// ListenCaptureGroup.
+type CaptureGroupConfig struct {
+	// Protocol is the protocol passed to Listen for each member.
+	Protocol int
+
+	// Members is the number of Conns in the group, which must be at least
+	// one.
+	Members int
+
+	// EBPFProgram is the file descriptor of a loaded eBPF program of type
+	// BPF_PROG_TYPE_SOCKET_FILTER which steers frames to members, as
+	// described by FanoutConfig.EBPFProgram. Loading the program generally
+	// requires the CAP_BPF or CAP_SYS_ADMIN capability. The CaptureGroup does
+	// not take ownership of the program, which may be closed once
+	// ListenCaptureGroup returns.
+	EBPFProgram int
+
+	// BufferSize is the number of frames buffered by the channel returned by
+	// CaptureGroup.Frames.
+	BufferSize int
+
+	// Config, if non-nil, applies to each member. Its Fanout field must be
+	// nil.
+	Config *Config
+}
+
+// ListenCaptureGroup opens cfg.Members Conns using Listen, joins them to a new
+// fanout group of type FanoutEBPF which is steered by cfg.EBPFProgram, and
+// merges the frames read by all members onto the channel returned by Frames.
+// eBPF fanout requires Linux 4.3 or newer.
+//
+// The group is created with FanoutConfig.UniqueID so that it cannot collide
+// with groups created by other processes.
+//
+// Members are ordinary Conns which read with recvfrom(2); see CaptureGroup.
+//
+// Each member's frames are delivered in the order in which the member read
+// them, so all frames of a flow are delivered in order as long as the program
+// steers them to the same member, such as by hashing the flow's addresses.
+// Frames of different flows may be interleaved arbitrarily. As with
+// Conn.Stream, a member stops reading while the channel is full, and the
+// kernel drops frames once that member's receive buffer is full, which is
+// reported by the Stats of Group.
+func ListenCaptureGroup(ifi *net.Interface, socketType Type, cfg *CaptureGroupConfig) (*CaptureGroup, error) {
+	if cfg == nil || cfg.Members < 1 {
+		return nil, errors.New("packet: CaptureGroup requires at least one member")
+	}
+
+	var mcfg Config
+	if cfg.Config != nil {
+		mcfg = *cfg.Config
+	}
+	if mcfg.Fanout != nil {
+		return nil, errors.New("packet: CaptureGroup creates its own fanout group")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &CaptureGroup{
+		group:  NewFanoutGroup(),
+		frames: make(chan Frame, cfg.BufferSize),
+		cancel: cancel,
+	}
+
+	// The first member creates the group, and the remaining members join it
+	// using the ID chosen by the kernel.
+	mcfg.Fanout = &FanoutConfig{
+		Type:        FanoutEBPF,
+		UniqueID:    true,
+		EBPFProgram: cfg.EBPFProgram,
+	}
+
+	var (
+		wg      sync.WaitGroup
+		streams []<-chan Frame
+	)
+	for i := 0; i < cfg.Members; i++ {
+		c, err := Listen(ifi, socketType, cfg.Protocol, &mcfg)
+		if err != nil {
+			_ = g.Close()
+			return nil, err
+		}
+		g.group.conns = append(g.group.conns, c)
+
+		if i == 0 {
+			id, _, err := c.FanoutGroupID()
+			if err != nil {
+				_ = g.Close()
+				return nil, err
+			}
+
+			mcfg.Fanout = &FanoutConfig{
+				GroupID:     id,
+				Type:        FanoutEBPF,
+				EBPFProgram: cfg.EBPFProgram,
+			}
+		}
+
+		streams = append(streams, c.Stream(ctx, cfg.BufferSize))
+	}
+
+	// Start forwarding only once all members have joined, so that no stream
+	// is left unread if a member fails to join.
+	for i, frames := range streams {
+		wg.Add(1)
+		go func(c *Conn, frames <-chan Frame) {
+			defer wg.Done()
+			g.forward(ctx, c, frames)
+		}(g.group.conns[i], frames)
+	}
+
+	go func() {
+		wg.Wait()
+		close(g.frames)
+	}()
+
+	return g, nil
+}
+
+// forward sends each frame received on frames to g.frames until frames is
+// closed, discarding frames once ctx is canceled.
+func (g *CaptureGroup) forward(ctx context.Context, c *Conn, frames <-chan Frame) {
+	for f := range frames {
+		select {
+		case g.frames <- f:
+		case <-ctx.Done():
+			c.putBuffer(f.Data)
+		}
+	}
+}
+
+// Frames returns the channel on which frames read by all members are
+// delivered. The channel is closed once the CaptureGroup is closed, or once
+// reads on all members have failed.
+func (g *CaptureGroup) Frames() <-chan Frame { return g.frames }
+
+// Group returns a FanoutGroup of the CaptureGroup's members, in the order
+// they joined the group, which may be used to check how frames are
+// distributed among them. The Conns must not be read directly.
+func (g *CaptureGroup) Group() *FanoutGroup { return g.group }
+
+// Close stops reading and closes all members of the CaptureGroup.
+func (g *CaptureGroup) Close() error {
+	g.cancel()
+
+	var errs []error
+	for _, c := range g.group.conns {
+		errs = append(errs, c.Close())
+	}
+
+	return errors.Join(errs...)
+}
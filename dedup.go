@@ -0,0 +1,85 @@
+package packet
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// A Deduper drops duplicate frames when merging the frames received by
+// several Conns in a fanout group.
+//
+// When a fanout group uses rollover, there is a narrow window in which a frame
+// may be delivered to more than one member of the group. A Deduper remembers
+// the identities of the most recent frames it has seen, and reports a frame
+// as a duplicate if its identity matches one of them. A Deduper is safe for
+// concurrent use.
+type Deduper struct {
+	identity func(frame []byte) uint64
+
+	mu sync.Mutex
+	// ring holds the identities of the most recent frames in arrival order,
+	// and seen counts the occurrences of each identity within ring.
+	ring []uint64
+	next int
+	full bool
+	seen map[uint64]int
+}
+
+// NewDeduper creates a Deduper which remembers the identities of the most
+// recent window frames. It panics if window is not positive.
+//
+// The identity function computes the identity of a frame, such as a sequence
+// number carried in its payload. If identity is nil, frames are identified by
+// an FNV-1a hash of their contents, so only identical frames are considered
+// duplicates.
+func NewDeduper(window int, identity func(frame []byte) uint64) *Deduper {
+	if window <= 0 {
+		panic("packet: Deduper window must be positive")
+	}
+	if identity == nil {
+		identity = hashFrame
+	}
+
+	return &Deduper{
+		identity: identity,
+		ring:     make([]uint64, window),
+		seen:     make(map[uint64]int, window),
+	}
+}
+
+// Seen reports whether a frame with the same identity as frame was seen
+// within the Deduper's window, and then records frame as the most recent
+// frame. Callers should drop frame if Seen returns true.
+func (d *Deduper) Seen(frame []byte) bool {
+	id := d.identity(frame)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dup := d.seen[id] > 0
+
+	if d.full {
+		// Evict the oldest identity from the window.
+		old := d.ring[d.next]
+		if d.seen[old]--; d.seen[old] == 0 {
+			delete(d.seen, old)
+		}
+	}
+
+	d.ring[d.next] = id
+	d.seen[id]++
+
+	d.next++
+	if d.next == len(d.ring) {
+		d.next, d.full = 0, true
+	}
+
+	return dup
+}
+
+// hashFrame computes the FNV-1a hash of frame.
+func hashFrame(frame []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(frame)
+	return h.Sum64()
+}
@@ -0,0 +1,96 @@
+package packet_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/packet"
+)
+
+func TestDeduper(t *testing.T) {
+	// Identify frames by a sequence number in their first 4 bytes.
+	seq := func(b []byte) uint64 { return uint64(binary.BigEndian.Uint32(b)) }
+	frame := func(n uint32, payload string) []byte {
+		return append(binary.BigEndian.AppendUint32(nil, n), payload...)
+	}
+
+	tests := []struct {
+		name     string
+		window   int
+		identity func([]byte) uint64
+		frames   [][]byte
+		want     []bool
+	}{
+		{
+			name: "contents",
+			// Identical frames are collapsed, but differing frames are not.
+			window: 4,
+			frames: [][]byte{
+				frame(1, "foo"),
+				frame(1, "foo"),
+				frame(1, "bar"),
+				frame(2, "foo"),
+				frame(2, "foo"),
+			},
+			want: []bool{false, true, false, false, true},
+		},
+		{
+			name:     "sequence",
+			window:   4,
+			identity: seq,
+			frames: [][]byte{
+				frame(1, "foo"),
+				frame(2, "foo"),
+				frame(1, "bar"),
+				frame(3, "foo"),
+				frame(2, "bar"),
+			},
+			want: []bool{false, false, true, false, true},
+		},
+		{
+			name: "window",
+			// Identities which leave the window are forgotten.
+			window:   2,
+			identity: seq,
+			frames: [][]byte{
+				frame(1, ""),
+				frame(2, ""),
+				frame(3, ""),
+				frame(1, ""),
+				frame(3, ""),
+				frame(3, ""),
+			},
+			want: []bool{false, false, false, false, true, true},
+		},
+		{
+			name: "window duplicates",
+			// A duplicate within the window keeps its identity in the window
+			// after the first occurrence is evicted.
+			window:   2,
+			identity: seq,
+			frames: [][]byte{
+				frame(1, ""),
+				frame(1, ""),
+				frame(2, ""),
+				frame(1, ""),
+			},
+			want: []bool{false, true, false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := packet.NewDeduper(tt.window, tt.identity)
+
+			got := make([]bool, 0, len(tt.frames))
+			for _, f := range tt.frames {
+				got = append(got, d.Seen(f))
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected duplicates (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
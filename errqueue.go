@@ -0,0 +1,61 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+	"syscall"
+)
+
+// sockExtendedErrLen is the length of a sock_extended_err structure.
+const sockExtendedErrLen = 16
+
+// Possible SockExtendedErr.Origin values, from linux/errqueue.h.
+const (
+	SockExtendedErrOriginNone         uint8 = 0
+	SockExtendedErrOriginLocal        uint8 = 1
+	SockExtendedErrOriginICMP         uint8 = 2
+	SockExtendedErrOriginICMP6        uint8 = 3
+	SockExtendedErrOriginTimestamping uint8 = 4
+	SockExtendedErrOriginZerocopy     uint8 = 5
+	SockExtendedErrOriginTxStatus     uint8 = 6
+)
+
+// A SockExtendedErr is a sock_extended_err structure read from a socket's error
+// queue by Conn.ReadErrQueue. The meaning of Type, Code, Info, and Data
+// depends on Origin.
+type SockExtendedErr struct {
+	Errno  syscall.Errno
+	Origin uint8
+	Type   uint8
+	Code   uint8
+	Info   uint32
+	Data   uint32
+}
+
+// unmarshal unpacks a sock_extended_err structure in the specified byte order
+// into e.
+func (e *SockExtendedErr) unmarshal(b []byte, order binary.ByteOrder) error {
+	if len(b) < sockExtendedErrLen {
+		return errors.New("packet: sock_extended_err too short")
+	}
+
+	// struct sock_extended_err {
+	// 	__u32 ee_errno;
+	// 	__u8  ee_origin;
+	// 	__u8  ee_type;
+	// 	__u8  ee_code;
+	// 	__u8  ee_pad;
+	// 	__u32 ee_info;
+	// 	__u32 ee_data;
+	// };
+	*e = SockExtendedErr{
+		Errno:  syscall.Errno(order.Uint32(b[0:4])),
+		Origin: b[4],
+		Type:   b[5],
+		Code:   b[6],
+		Info:   order.Uint32(b[8:12]),
+		Data:   order.Uint32(b[12:16]),
+	}
+
+	return nil
+}
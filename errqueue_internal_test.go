@@ -0,0 +1,41 @@
+package packet
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSockExtendedErrUnmarshal(t *testing.T) {
+	want := &SockExtendedErr{
+		Errno:  syscall.ENOMSG,
+		Origin: SockExtendedErrOriginTimestamping,
+		Type:   1,
+		Code:   2,
+		Info:   0x01020304,
+		Data:   0x05060708,
+	}
+
+	for _, order := range testByteOrders {
+		t.Run(order.String(), func(t *testing.T) {
+			b := make([]byte, sockExtendedErrLen)
+			order.PutUint32(b[0:4], uint32(syscall.ENOMSG))
+			b[4], b[5], b[6] = SockExtendedErrOriginTimestamping, 1, 2
+			order.PutUint32(b[8:12], 0x01020304)
+			order.PutUint32(b[12:16], 0x05060708)
+
+			var got SockExtendedErr
+			if err := got.unmarshal(b, order); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+			if diff := cmp.Diff(want, &got); diff != "" {
+				t.Fatalf("unexpected SockExtendedErr (-want +got):\n%s", diff)
+			}
+
+			if err := got.unmarshal(b[:sockExtendedErrLen-1], order); err == nil {
+				t.Fatal("expected an error for short input, but none occurred")
+			}
+		})
+	}
+}
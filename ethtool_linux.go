@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package packet
+
+import (
+	"net"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ethtoolIfreq is a struct ifreq carrying a pointer to ethtool command data.
+type ethtoolIfreq struct {
+	name [unix.IFNAMSIZ]byte
+	data unsafe.Pointer
+	_    [16]byte
+}
+
+// ethtool issues the SIOCETHTOOL ioctl with command data b against the Conn's
+// network interface. The kernel may update b in place.
+func (c *Conn) ethtool(b []byte) error {
+	ifi, err := net.InterfaceByIndex(c.ifIndex)
+	if err != nil {
+		return c.opError(opIoctl, err)
+	}
+
+	ifr := ethtoolIfreq{data: unsafe.Pointer(&b[0])}
+	copy(ifr.name[:unix.IFNAMSIZ-1], ifi.Name)
+
+	return c.opError(opIoctl, c.control("ioctl", func(fd int) error {
+		_, _, errno := unix.Syscall(
+			unix.SYS_IOCTL,
+			uintptr(fd),
+			unix.SIOCETHTOOL,
+			uintptr(unsafe.Pointer(&ifr)),
+		)
+		runtime.KeepAlive(&ifr)
+		if errno != 0 {
+			return errno
+		}
+
+		return nil
+	}))
+}
@@ -0,0 +1,609 @@
+//go:build linux
+// +build linux
+
+package packet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+func Test_bindFake(t *testing.T) {
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	filter := []bpf.RawInstruction{{Op: 0x6, K: 0xffffffff}}
+
+	cfg := &Config{
+		Filter:    filter,
+		Direction: DirectionIn,
+		VnetHdr:   true,
+		LocalOnly: true,
+		Fanout: &FanoutConfig{
+			GroupID:  1,
+			Type:     FanoutCPU,
+			Rollover: true,
+		},
+		Promiscuous: true,
+	}
+
+	prefix, err := cfg.filterPrefix(Raw, mac)
+	if err != nil {
+		t.Fatalf("failed to build filter prefix: %v", err)
+	}
+
+	fc := &fakeConn{name: &unix.SockaddrLinklayer{Halen: 6, Addr: [8]byte{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}}}
+	c, err := bind(fc, 2, 0x0800, prefix, cfg)
+	if err != nil {
+		t.Fatalf("failed to bind: %v", err)
+	}
+
+	want := []string{
+		fmt.Sprintf("SetBPF(%d)", len(prefix)+len(filter)),
+		"SetsockoptInt(PACKET_IGNORE_OUTGOING, 0x1)",
+		"SetsockoptInt(PACKET_VNET_HDR, 0x1)",
+		"Bind(ifindex: 2, protocol: 0x0800)",
+		fmt.Sprintf("SetsockoptInt(PACKET_FANOUT, %#x)", (unix.PACKET_FANOUT_FLAG_ROLLOVER|int(FanoutCPU))<<16|1),
+		"SetsockoptPacketMreq(PACKET_ADD_MEMBERSHIP, ifindex: 2, type: PACKET_MR_PROMISC)",
+		"Getsockname",
+	}
+	if diff := cmp.Diff(want, fc.calls); diff != "" {
+		t.Fatalf("unexpected calls (-want +got):\n%s", diff)
+	}
+
+	// The Config's filter must follow the LocalOnly prefix.
+	if diff := cmp.Diff(append(prefix, filter...), fc.filter); diff != "" {
+		t.Fatalf("unexpected filter (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(&Addr{HardwareAddr: mac, Index: 2}, c.LocalAddr()); diff != "" {
+		t.Fatalf("unexpected local address (-want +got):\n%s", diff)
+	}
+}
+
+func Test_bindFakeErrors(t *testing.T) {
+	t.Run("auxdata unavailable", func(t *testing.T) {
+		fc := &fakeConn{
+			name: &unix.SockaddrLinklayer{},
+			setsockoptErr: map[string]error{
+				"PACKET_AUXDATA": unix.ENOPROTOOPT,
+			},
+		}
+
+		c, err := bind(fc, 1, unix.ETH_P_ALL, nil, &Config{Auxdata: true})
+		if err != nil {
+			t.Fatalf("failed to bind: %v", err)
+		}
+		if c.AuxdataDelivered() {
+			t.Fatal("auxdata should not be delivered")
+		}
+	})
+
+	t.Run("setsockopt", func(t *testing.T) {
+		fc := &fakeConn{
+			setsockoptErr: map[string]error{
+				"PACKET_VNET_HDR": unix.EPERM,
+			},
+		}
+
+		_, err := bind(fc, 1, unix.ETH_P_ALL, nil, &Config{VnetHdr: true})
+		if !errors.Is(err, unix.EPERM) {
+			t.Fatalf("expected EPERM, but got: %v", err)
+		}
+		for _, c := range fc.calls {
+			if c == "Bind(ifindex: 1, protocol: 0x0003)" {
+				t.Fatal("socket should not be bound after setsockopt failure")
+			}
+		}
+	})
+
+	t.Run("bind interface unavailable", func(t *testing.T) {
+		fc := &fakeConn{bindErr: unix.ENODEV}
+
+		_, err := bind(fc, 1, unix.ETH_P_ALL, nil, &Config{})
+		if !errors.Is(err, ErrInterfaceUnavailable) || !errors.Is(err, unix.ENODEV) {
+			t.Fatalf("expected ErrInterfaceUnavailable and ENODEV, but got: %v", err)
+		}
+	})
+
+	t.Run("bind", func(t *testing.T) {
+		fc := &fakeConn{bindErr: unix.EPERM}
+
+		_, err := bind(fc, 1, unix.ETH_P_ALL, nil, &Config{})
+		if !errors.Is(err, unix.EPERM) || errors.Is(err, ErrInterfaceUnavailable) {
+			t.Fatalf("expected only EPERM, but got: %v", err)
+		}
+	})
+}
+
+func Test_listenRetryFake(t *testing.T) {
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		want     error
+	}{
+		{
+			name:     "transient",
+			errs:     []error{unix.ENOBUFS, unix.EAGAIN},
+			attempts: 3,
+		},
+		{
+			name:     "transient bind",
+			errs:     []error{nil},
+			attempts: 2,
+		},
+		{
+			name:     "permanent",
+			errs:     []error{unix.EPERM},
+			attempts: 1,
+			want:     unix.EPERM,
+		},
+		{
+			name:     "exhausted",
+			errs:     []error{unix.EMFILE, unix.EMFILE, unix.EMFILE, unix.EMFILE},
+			attempts: 3,
+			want:     unix.EMFILE,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each attempt fails with the next error in tt.errs. A nil error
+			// opens a fakeConn which fails to bind with a transient error,
+			// and later attempts open a fakeConn which binds successfully.
+			var attempts int
+			defer func(fn func(int) (conn, error)) { newSocket = fn }(newSocket)
+			newSocket = func(_ int) (conn, error) {
+				attempts++
+
+				fc := &fakeConn{name: &unix.SockaddrLinklayer{}}
+				if attempts > len(tt.errs) {
+					return fc, nil
+				}
+
+				if err := tt.errs[attempts-1]; err != nil {
+					return nil, os.NewSyscallError("socket", err)
+				}
+
+				fc.bindErr = unix.ENOBUFS
+				return fc, nil
+			}
+
+			c, err := listen(&net.Interface{Index: 1}, Raw, unix.ETH_P_ALL, nil, &Config{
+				ListenRetry: &ListenRetry{Attempts: 3, Backoff: time.Millisecond},
+			})
+			if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err == nil {
+				_ = c.Close()
+			}
+
+			if diff := cmp.Diff(tt.attempts, attempts); diff != "" {
+				t.Fatalf("unexpected number of attempts (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListenRetryBackoff(t *testing.T) {
+	r := &ListenRetry{Backoff: time.Second}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 4, want: 8 * time.Second},
+		{attempt: 64, want: math.MaxInt64},
+		{attempt: math.MaxInt32, want: math.MaxInt64},
+	}
+
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.want, r.backoff(tt.attempt)); diff != "" {
+			t.Fatalf("unexpected backoff for attempt %d (-want +got):\n%s", tt.attempt, diff)
+		}
+	}
+}
+
+func TestConnReadFromFake(t *testing.T) {
+	fc := &fakeConn{
+		recv: func(p []byte) (int, unix.Sockaddr, error) {
+			return copy(p, "hello"), &unix.SockaddrLinklayer{
+				Protocol: 0x0008, // ETH_P_IP in network byte order.
+				Ifindex:  2,
+				Halen:    6,
+				Addr:     [8]byte{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+			}, nil
+		},
+	}
+	c := &Conn{c: fc, addr: &Addr{}}
+
+	b := make([]byte, 16)
+	n, addr, err := c.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff("hello", string(b[:n])); diff != "" {
+		t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+	}
+
+	want := &Addr{
+		HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		Protocol:     unix.ETH_P_IP,
+		Index:        2,
+	}
+	if diff := cmp.Diff(want, addr); diff != "" {
+		t.Fatalf("unexpected address (-want +got):\n%s", diff)
+	}
+
+	// Errors are wrapped in a *net.OpError.
+	fc.recv = func(_ []byte) (int, unix.Sockaddr, error) {
+		return 0, nil, os.NewSyscallError("recvfrom", unix.EIO)
+	}
+
+	_, _, err = c.ReadFrom(b)
+	var oerr *net.OpError
+	if !errors.As(err, &oerr) || oerr.Op != opRead || oerr.Net != network {
+		t.Fatalf("unexpected read error: %#v", err)
+	}
+	if !errors.Is(err, unix.EIO) {
+		t.Fatalf("expected EIO, but got: %v", err)
+	}
+}
+
+func TestConnWriteToFake(t *testing.T) {
+	fc := &fakeConn{}
+	c := &Conn{c: fc, addr: &Addr{}, ifIndex: 2, protocol: 0x0008}
+
+	frame := []byte("hello")
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	n, err := c.WriteTo(frame, &Addr{HardwareAddr: mac})
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if n != len(frame) {
+		t.Fatalf("unexpected number of bytes written: %d", n)
+	}
+
+	want := []fakeSend{{
+		b: frame,
+		to: &unix.SockaddrLinklayer{
+			Protocol: 0x0008,
+			Ifindex:  2,
+			Halen:    6,
+			Addr:     [8]byte{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+	}}
+	if diff := cmp.Diff(want, fc.sent, cmp.AllowUnexported(fakeSend{}, unix.SockaddrLinklayer{})); diff != "" {
+		t.Fatalf("unexpected sends (-want +got):\n%s", diff)
+	}
+
+	// An invalid address is rejected before any system call.
+	_, err = c.WriteTo(frame, &net.IPAddr{})
+	var oerr *net.OpError
+	if !errors.As(err, &oerr) || oerr.Op != opWrite || !errors.Is(err, unix.EINVAL) {
+		t.Fatalf("unexpected write error: %#v", err)
+	}
+	if len(fc.sent) != 1 {
+		t.Fatalf("unexpected number of sends: %d", len(fc.sent))
+	}
+}
+
+var _ conn = &fakeConn{}
+
+func TestReliableConnReconnectFake(t *testing.T) {
+	filter := []bpf.RawInstruction{{Op: 0x6, K: 0xffffffff}}
+
+	// The first Conn fails because its interface was removed, the first
+	// attempt to reconnect fails because the interface has not returned, and
+	// the second attempt succeeds.
+	var (
+		cfgs []Config
+		lost = &fakeConn{recv: func(_ []byte) (int, unix.Sockaddr, error) {
+			return 0, nil, os.NewSyscallError("recvfrom", unix.ENODEV)
+		}}
+		found = &fakeConn{recv: func(p []byte) (int, unix.Sockaddr, error) {
+			return copy(p, "hello"), &unix.SockaddrLinklayer{Ifindex: 3}, nil
+		}}
+	)
+
+	defer func(fn func(string, Type, int, *Config) (*Conn, error)) { listenReliable = fn }(listenReliable)
+	listenReliable = func(name string, _ Type, _ int, cfg *Config) (*Conn, error) {
+		if name != "eth0" {
+			t.Fatalf("unexpected interface name: %q", name)
+		}
+
+		cfgs = append(cfgs, *cfg)
+		switch len(cfgs) {
+		case 1:
+			return &Conn{c: lost, addr: &Addr{Index: 2}, paused: new(pauseState)}, nil
+		case 2:
+			return nil, fmt.Errorf("%w: %w", ErrInterfaceUnavailable, unix.ENODEV)
+		default:
+			return &Conn{c: found, addr: &Addr{Index: 3}, paused: new(pauseState)}, nil
+		}
+	}
+
+	events := make(chan ReconnectEventType, 3)
+	r, err := ListenReliable("eth0", Raw, unix.ETH_P_ALL, &Config{Direction: DirectionIn}, &ReconnectPolicy{
+		Backoff: time.Millisecond,
+		OnEvent: func(e ReconnectEvent) { events <- e.Type },
+	})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer r.Close()
+
+	if err := r.SetBPF(filter); err != nil {
+		t.Fatalf("failed to set filter: %v", err)
+	}
+
+	b := make([]byte, 16)
+	n, _, err := r.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if diff := cmp.Diff("hello", string(b[:n])); diff != "" {
+		t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+	}
+
+	// The ReconnectConnected event may be delivered after the read resumes.
+	var got []ReconnectEventType
+	for i := 0; i < cap(events); i++ {
+		got = append(got, <-events)
+	}
+
+	wantEvents := []ReconnectEventType{ReconnectDisconnected, ReconnectFailed, ReconnectConnected}
+	if diff := cmp.Diff(wantEvents, got); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+
+	// The filter set on the first Conn must be applied to later Conns along
+	// with the original Config.
+	want := []Config{
+		{Direction: DirectionIn},
+		{Direction: DirectionIn, Filter: filter},
+		{Direction: DirectionIn, Filter: filter},
+	}
+	if diff := cmp.Diff(want, cfgs); diff != "" {
+		t.Fatalf("unexpected configs (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(&Addr{Index: 3}, r.LocalAddr()); diff != "" {
+		t.Fatalf("unexpected local address (-want +got):\n%s", diff)
+	}
+
+	// Once closed, reads fail without reconnecting.
+	if err := r.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if _, _, err := r.ReadFrom(b); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected net.ErrClosed, but got: %v", err)
+	}
+}
+
+func TestReliableConnNetDownFake(t *testing.T) {
+	// The first Conn fails because its interface was removed. The interface
+	// returns but is still down, so the new Conn reports ENETDOWN before it
+	// receives frames. That must not cause another reconnection.
+	const downs = 3
+	var (
+		listens int
+		reads   int
+		lost    = &fakeConn{recv: func(_ []byte) (int, unix.Sockaddr, error) {
+			return 0, nil, os.NewSyscallError("recvfrom", unix.ENODEV)
+		}}
+		down = &fakeConn{recv: func(p []byte) (int, unix.Sockaddr, error) {
+			if reads++; reads <= downs {
+				return 0, nil, os.NewSyscallError("recvfrom", unix.ENETDOWN)
+			}
+
+			return copy(p, "hello"), &unix.SockaddrLinklayer{Ifindex: 3}, nil
+		}}
+	)
+
+	defer func(fn func(string, Type, int, *Config) (*Conn, error)) { listenReliable = fn }(listenReliable)
+	listenReliable = func(_ string, _ Type, _ int, _ *Config) (*Conn, error) {
+		listens++
+		if listens == 1 {
+			return &Conn{c: lost, addr: &Addr{Index: 2}, paused: new(pauseState)}, nil
+		}
+
+		return &Conn{c: down, addr: &Addr{Index: 3}, paused: new(pauseState)}, nil
+	}
+
+	events := make(chan ReconnectEventType, 2)
+	r, err := ListenReliable("eth0", Raw, unix.ETH_P_ALL, nil, &ReconnectPolicy{
+		Backoff: time.Millisecond,
+		OnEvent: func(e ReconnectEvent) { events <- e.Type },
+	})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer r.Close()
+
+	b := make([]byte, 16)
+	n, _, err := r.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if diff := cmp.Diff("hello", string(b[:n])); diff != "" {
+		t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+	}
+
+	var got []ReconnectEventType
+	for i := 0; i < cap(events); i++ {
+		got = append(got, <-events)
+	}
+
+	wantEvents := []ReconnectEventType{ReconnectDisconnected, ReconnectConnected}
+	if diff := cmp.Diff(wantEvents, got); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(2, listens); diff != "" {
+		t.Fatalf("unexpected number of listens (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(downs+1, reads); diff != "" {
+		t.Fatalf("unexpected number of reads (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinkMonitorNotificationsLostFake(t *testing.T) {
+	tests := []struct {
+		name    string
+		exists  bool
+		removed bool
+	}{
+		{name: "exists", exists: true},
+		{name: "removed", removed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(fn func(int) (bool, error)) { interfaceExists = fn }(interfaceExists)
+			interfaceExists = func(index int) (bool, error) {
+				if index != 2 {
+					t.Fatalf("unexpected interface index: %d", index)
+				}
+
+				return tt.exists, nil
+			}
+
+			// The first read reports lost notifications, and the second
+			// behaves as if the linkMonitor was closed.
+			var reads int
+			m := &linkMonitor{c: &fakeConn{recv: func(_ []byte) (int, unix.Sockaddr, error) {
+				if reads++; reads == 1 {
+					return 0, nil, os.NewSyscallError("recvfrom", unix.ENOBUFS)
+				}
+
+				return 0, nil, net.ErrClosed
+			}}}
+
+			var (
+				removed bool
+				changed []int
+			)
+			m.watch(2, func() { removed = true }, func(index int) { changed = append(changed, index) })
+
+			if diff := cmp.Diff(tt.removed, removed); diff != "" {
+				t.Fatalf("unexpected removal (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff([]int{0}, changed); diff != "" {
+				t.Fatalf("unexpected changed indices (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// A fakeConn is a conn which records the calls made to it, for testing Conn
+// logic without a real socket.
+type fakeConn struct {
+	// Inputs.
+	name          unix.Sockaddr
+	bindErr       error
+	setsockoptErr map[string]error
+	recv          func(p []byte) (int, unix.Sockaddr, error)
+
+	// Outputs.
+	calls  []string
+	filter []bpf.RawInstruction
+	sent   []fakeSend
+}
+
+// A fakeSend is a frame sent using a fakeConn.
+type fakeSend struct {
+	b  []byte
+	to unix.Sockaddr
+}
+
+// fakeSockopts maps socket option numbers to names for fakeConn.calls.
+var fakeSockopts = map[int]string{
+	unix.PACKET_ADD_MEMBERSHIP:  "PACKET_ADD_MEMBERSHIP",
+	unix.PACKET_AUXDATA:         "PACKET_AUXDATA",
+	unix.PACKET_FANOUT:          "PACKET_FANOUT",
+	unix.PACKET_IGNORE_OUTGOING: "PACKET_IGNORE_OUTGOING",
+	unix.PACKET_ORIGDEV:         "PACKET_ORIGDEV",
+	unix.PACKET_VNET_HDR:        "PACKET_VNET_HDR",
+}
+
+func (c *fakeConn) Bind(sa unix.Sockaddr) error {
+	sall := sa.(*unix.SockaddrLinklayer)
+	c.calls = append(c.calls, fmt.Sprintf("Bind(ifindex: %d, protocol: %#04x)", sall.Ifindex, ntohs(sall.Protocol)))
+	return c.bindErr
+}
+
+func (c *fakeConn) Getsockname() (unix.Sockaddr, error) {
+	c.calls = append(c.calls, "Getsockname")
+	return c.name, nil
+}
+
+func (c *fakeConn) SetBPF(filter []bpf.RawInstruction) error {
+	c.calls = append(c.calls, fmt.Sprintf("SetBPF(%d)", len(filter)))
+	c.filter = filter
+	return nil
+}
+
+func (c *fakeConn) SetsockoptInt(level, opt, value int) error {
+	name := fakeSockopts[opt]
+	c.calls = append(c.calls, fmt.Sprintf("SetsockoptInt(%s, %#x)", name, value))
+	return c.setsockoptErr[name]
+}
+
+func (c *fakeConn) SetsockoptPacketMreq(level, opt int, mreq *unix.PacketMreq) error {
+	typ := "PACKET_MR_PROMISC"
+	if mreq.Type != unix.PACKET_MR_PROMISC {
+		typ = fmt.Sprint(mreq.Type)
+	}
+
+	name := fakeSockopts[opt]
+	c.calls = append(c.calls, fmt.Sprintf("SetsockoptPacketMreq(%s, ifindex: %d, type: %s)", name, mreq.Ifindex, typ))
+	return c.setsockoptErr[name]
+}
+
+func (c *fakeConn) Recvfrom(_ context.Context, p []byte, _ int) (int, unix.Sockaddr, error) {
+	return c.recv(p)
+}
+
+func (c *fakeConn) Sendto(_ context.Context, p []byte, _ int, to unix.Sockaddr) error {
+	c.sent = append(c.sent, fakeSend{b: append([]byte(nil), p...), to: to})
+	return nil
+}
+
+// The remaining methods are not implemented by fakeConn.
+
+func (*fakeConn) Close() error                          { return nil }
+func (*fakeConn) GetsockoptInt(_, _ int) (int, error)   { return 0, unix.ENOSYS }
+func (*fakeConn) RemoveBPF() error                      { return unix.ENOSYS }
+func (*fakeConn) SetDeadline(_ time.Time) error         { return unix.ENOSYS }
+func (*fakeConn) SetReadDeadline(_ time.Time) error     { return unix.ENOSYS }
+func (*fakeConn) SetWriteDeadline(_ time.Time) error    { return unix.ENOSYS }
+func (*fakeConn) SyscallConn() (syscall.RawConn, error) { return nil, unix.ENOSYS }
+func (*fakeConn) GetsockoptTpacketStats(_, _ int) (*unix.TpacketStats, error) {
+	return nil, unix.ENOSYS
+}
+
+func (*fakeConn) GetsockoptTpacketStatsV3(_, _ int) (*unix.TpacketStatsV3, error) {
+	return nil, unix.ENOSYS
+}
+
+func (*fakeConn) Recvmsg(_ context.Context, _, _ []byte, _ int) (int, int, int, unix.Sockaddr, error) {
+	return 0, 0, 0, nil, unix.ENOSYS
+}
+
+func (*fakeConn) Sendmsg(_ context.Context, _, _ []byte, _ unix.Sockaddr, _ int) (int, error) {
+	return 0, unix.ENOSYS
+}
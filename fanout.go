@@ -0,0 +1,142 @@
+package packet
+
+// A FanoutType is a PACKET_FANOUT mode, which determines how received frames
+// are distributed among the members of a fanout group.
+//
+//enumcheck:exhaustive
+type FanoutType uint16
+
+// Possible FanoutType values, from linux/if_packet.h.
+//
+// FanoutEBPF distributes frames using the eBPF program specified by
+// FanoutConfig.EBPFProgram, and requires Linux 4.3 or newer.
+const (
+	FanoutHash     FanoutType = 0
+	FanoutLB       FanoutType = 1
+	FanoutCPU      FanoutType = 2
+	FanoutRollover FanoutType = 3
+	FanoutRandom   FanoutType = 4
+	FanoutQM       FanoutType = 5
+	FanoutEBPF     FanoutType = 7
+)
+
+// A FanoutConfig configures a Conn's membership in a PACKET_FANOUT group. All
+// Conns which join the same group must use the same network interface and
+// FanoutConfig.
+type FanoutConfig struct {
+	// GroupID identifies the fanout group within the network namespace.
+	GroupID uint16
+
+	// Type specifies how frames are distributed among the group's members.
+	Type FanoutType
+
+	// Defrag sets PACKET_FANOUT_FLAG_DEFRAG, which causes fragmented IP
+	// packets to be reassembled before distribution so that all fragments
+	// reach the same member.
+	Defrag bool
+
+	// Rollover sets PACKET_FANOUT_FLAG_ROLLOVER, which causes frames to be
+	// delivered to another member when the selected member's queue is full.
+	Rollover bool
+
+	// UniqueID sets PACKET_FANOUT_FLAG_UNIQUEID, which causes the kernel to
+	// create a new fanout group with an ID which is not used by any other
+	// group, avoiding collisions with groups created by other processes.
+	// GroupID must be zero when UniqueID is set.
+	//
+	// To add more Conns to the group, call Conn.FanoutGroupID on the first
+	// Conn and then set GroupID to the result, with UniqueID unset, in the
+	// FanoutConfig of each subsequent Conn.
+	UniqueID bool
+
+	// EBPFProgram is the file descriptor of an eBPF program which selects
+	// the member that receives each frame when Type is FanoutEBPF, and is
+	// ignored otherwise. The program must be of type
+	// BPF_PROG_TYPE_SOCKET_FILTER, and its return value, modulo the number of
+	// members, is the index of the selected member in the order the members
+	// joined the group. The program is shared by the whole group, and the
+	// Conn does not take ownership of the file descriptor.
+	EBPFProgram int
+}
+
+// A FanoutGroup is a set of Conns which are members of the same PACKET_FANOUT
+// group. It reports how the kernel has distributed frames among the members,
+// so that callers can detect a member which receives a disproportionate share
+// of the group's traffic.
+type FanoutGroup struct {
+	conns []*Conn
+}
+
+// NewFanoutGroup creates a FanoutGroup from Conns which were opened with the
+// same FanoutConfig. The FanoutGroup does not take ownership of the Conns,
+// which must be closed by the caller.
+func NewFanoutGroup(conns ...*Conn) *FanoutGroup {
+	return &FanoutGroup{conns: conns}
+}
+
+// Conns returns the FanoutGroup's Conns, in the order passed to
+// NewFanoutGroup.
+func (g *FanoutGroup) Conns() []*Conn { return g.conns }
+
+// FanoutStats contains statistics about a FanoutGroup.
+type FanoutStats struct {
+	// Total is the sum of the Stats of all members.
+	Total Stats `json:"total"`
+
+	// Members contains the Stats of each member, in the same order as
+	// FanoutGroup.Conns.
+	Members []Stats `json:"members"`
+
+	// Imbalance is the number of packets received by the busiest member
+	// divided by the mean number of packets received per member.
+	//
+	// An Imbalance of 1 indicates that packets were spread evenly across all
+	// members, while an Imbalance equal to the number of members indicates
+	// that every packet was received by a single member. Imbalance is 0 if no
+	// packets were received. Hash-based FanoutTypes only balance well when
+	// traffic consists of many flows, so a high Imbalance may be expected for
+	// few flows or when FanoutCPU is used with unevenly steered interrupts.
+	Imbalance float64 `json:"imbalance"`
+}
+
+// Stats retrieves the Stats of each member of the FanoutGroup and aggregates
+// them. The usual Conn.Stats semantics apply to each member, so the kernel's
+// counters are reset by each call unless the members were opened with
+// Config.CumulativeStats.
+func (g *FanoutGroup) Stats() (*FanoutStats, error) {
+	members := make([]Stats, 0, len(g.conns))
+	for _, c := range g.conns {
+		s, err := c.Stats()
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, *s)
+	}
+
+	return newFanoutStats(members), nil
+}
+
+// newFanoutStats aggregates the Stats of a FanoutGroup's members.
+func newFanoutStats(members []Stats) *FanoutStats {
+	fs := &FanoutStats{Members: members}
+
+	var busiest uint32
+	for _, s := range members {
+		fs.Total.Packets += s.Packets
+		fs.Total.Drops += s.Drops
+		fs.Total.BufferDrops += s.BufferDrops
+		fs.Total.FreezeQueueCount += s.FreezeQueueCount
+
+		if s.Packets > busiest {
+			busiest = s.Packets
+		}
+	}
+
+	if fs.Total.Packets > 0 {
+		mean := float64(fs.Total.Packets) / float64(len(members))
+		fs.Imbalance = float64(busiest) / mean
+	}
+
+	return fs
+}
@@ -0,0 +1,53 @@
+package packet
+
+import (
+	"sync"
+)
+
+// A Feature is an optional capability of packet sockets which may not be
+// supported by the running kernel.
+//enumcheck:exhaustive
+type Feature int
+
+// Possible Feature values, each corresponding to a socket option: PACKET_FANOUT,
+// PACKET_QDISC_BYPASS, PACKET_IGNORE_OUTGOING, PACKET_VNET_HDR, PACKET_VERSION
+// with TPACKET_V3, and SO_TXTIME.
+const (
+	_ Feature = iota
+	FeatureFanout
+	FeatureQdiscBypass
+	FeatureIgnoreOutgoing
+	FeatureVnetHdr
+	FeatureRxRingV3
+	FeatureTxTime
+)
+
+// Cached results of feature probes.
+var (
+	featuresMu sync.Mutex
+	features   = make(map[Feature]bool)
+)
+
+// Supported reports whether the running kernel supports feature f. Support is
+// probed by applying the relevant socket option to a temporary socket, and the
+// result is cached for subsequent calls.
+//
+// Probing requires the same privileges as Listen. If the temporary socket
+// cannot be created, Supported reports false and does not cache the result.
+func Supported(f Feature) bool {
+	featuresMu.Lock()
+	defer featuresMu.Unlock()
+
+	if ok, cached := features[f]; cached {
+		return ok
+	}
+
+	ok, err := probe(f)
+	if err != nil {
+		// Could not determine support; try again next time.
+		return false
+	}
+
+	features[f] = ok
+	return ok
+}
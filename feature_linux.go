@@ -0,0 +1,56 @@
+//go:build linux
+// +build linux
+
+package packet
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// probe determines whether feature f is supported by applying its socket
+// option to a temporary packet socket. A non-nil error indicates that support
+// could not be determined.
+func probe(f Feature) (bool, error) {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return false, err
+	}
+	defer unix.Close(fd)
+
+	switch f {
+	case FeatureFanout:
+		// Reports zero when the socket is not a member of a fanout group.
+		_, err = unix.GetsockoptInt(fd, unix.SOL_PACKET, unix.PACKET_FANOUT)
+	case FeatureQdiscBypass:
+		err = unix.SetsockoptInt(fd, unix.SOL_PACKET, unix.PACKET_QDISC_BYPASS, 0)
+	case FeatureIgnoreOutgoing:
+		err = unix.SetsockoptInt(fd, unix.SOL_PACKET, unix.PACKET_IGNORE_OUTGOING, 0)
+	case FeatureVnetHdr:
+		err = unix.SetsockoptInt(fd, unix.SOL_PACKET, unix.PACKET_VNET_HDR, 0)
+	case FeatureRxRingV3:
+		err = unix.SetsockoptInt(fd, unix.SOL_PACKET, unix.PACKET_VERSION, unix.TPACKET_V3)
+	case FeatureTxTime:
+		// CLOCK_MONOTONIC does not require CAP_NET_ADMIN.
+		txt := struct {
+			clockid int32
+			flags   uint32
+		}{clockid: unix.CLOCK_MONOTONIC}
+
+		err = setsockopt(fd, unix.SOL_SOCKET, unix.SO_TXTIME, unsafe.Pointer(&txt), unsafe.Sizeof(txt))
+	default:
+		return false, nil
+	}
+
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, unix.ENOPROTOOPT), errors.Is(err, unix.EINVAL):
+		// The kernel does not recognize the option or its value.
+		return false, nil
+	default:
+		return false, err
+	}
+}
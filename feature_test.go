@@ -0,0 +1,34 @@
+package packet_test
+
+import (
+	"testing"
+
+	"github.com/mdlayher/packet"
+)
+
+func TestSupported(t *testing.T) {
+	features := []struct {
+		name string
+		f    packet.Feature
+	}{
+		{name: "fanout", f: packet.FeatureFanout},
+		{name: "qdisc bypass", f: packet.FeatureQdiscBypass},
+		{name: "ignore outgoing", f: packet.FeatureIgnoreOutgoing},
+		{name: "vnet hdr", f: packet.FeatureVnetHdr},
+		{name: "RX ring v3", f: packet.FeatureRxRingV3},
+		{name: "TX time", f: packet.FeatureTxTime},
+		{name: "invalid", f: packet.Feature(-1)},
+	}
+
+	for _, f := range features {
+		t.Run(f.name, func(t *testing.T) {
+			// Probe twice to exercise the cache.
+			ok := packet.Supported(f.f)
+			if ok2 := packet.Supported(f.f); ok != ok2 {
+				t.Fatalf("inconsistent support results: %v, %v", ok, ok2)
+			}
+
+			t.Logf("supported: %v", ok)
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+
+	"golang.org/x/net/bpf"
+)
+
+// Offsets of fields within an Ethernet frame header.
+const (
+	offDestMAC   = 0
+	offSourceMAC = 6
+	offEtherType = 12
+)
+
+// filterAccept is the value returned by a BPF filter to accept an entire
+// frame.
+const filterAccept = math.MaxInt32
+
+// filterMaxLen is the maximum number of instructions in a classic BPF program
+// accepted by the kernel, BPF_MAXINSNS from linux/bpf_common.h.
+const filterMaxLen = 4096
+
+// ErrFilterTooLong is returned when a BPF filter, including any instructions
+// which a Conn's Config requires to precede it, exceeds the kernel's limit of
+// 4096 instructions. The error reports the length of the filter and the
+// limit.
+var ErrFilterTooLong = errors.New("packet: BPF filter too long")
+
+// checkFilterLen returns an error wrapping ErrFilterTooLong if the complete
+// filter exceeds the kernel's length limit.
+func checkFilterLen(filter []bpf.RawInstruction) error {
+	if len(filter) <= filterMaxLen {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %d instructions exceeds limit of %d", ErrFilterTooLong, len(filter), filterMaxLen)
+}
+
+// filterDropAll is a BPF filter which rejects all frames.
+var filterDropAll = func() []bpf.RawInstruction {
+	raw, err := bpf.Assemble([]bpf.Instruction{bpf.RetConstant{Val: 0}})
+	if err != nil {
+		panic(fmt.Sprintf("packet: failed to assemble drop filter: %v", err))
+	}
+
+	return raw
+}()
+
+// filterAcceptAll is a BPF filter which accepts all frames.
+var filterAcceptAll = func() []bpf.RawInstruction {
+	raw, err := bpf.Assemble([]bpf.Instruction{bpf.RetConstant{Val: filterAccept}})
+	if err != nil {
+		panic(fmt.Sprintf("packet: failed to assemble accept filter: %v", err))
+	}
+
+	return raw
+}()
+
+// filterOutgoing is a BPF filter prefix which rejects all frames that are not
+// outgoing from the local machine.
+var filterOutgoing = func() []bpf.RawInstruction {
+	raw, err := bpf.Assemble([]bpf.Instruction{
+		bpf.LoadExtension{Num: bpf.ExtType},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(PacketOutgoing), SkipTrue: 1},
+		bpf.RetConstant{Val: 0},
+	})
+	if err != nil {
+		panic(fmt.Sprintf("packet: failed to assemble outgoing filter: %v", err))
+	}
+
+	return raw
+}()
+
+// filterPrefix returns the BPF instructions which must precede any filter set
+// on a Conn of type typ created with cfg on an interface with address mac.
+func (cfg *Config) filterPrefix(typ Type, mac net.HardwareAddr) ([]bpf.RawInstruction, error) {
+	var prefix []bpf.RawInstruction
+	if cfg.LocalOnly {
+		if typ != Raw {
+			return nil, errors.New("packet: LocalOnly is only supported by Raw Conns")
+		}
+
+		local, err := MatchDestMAC(mac).Or(matchDestGroup()).prefix()
+		if err != nil {
+			return nil, err
+		}
+		prefix = append(prefix, local...)
+	}
+
+	if cfg.Direction == DirectionOut {
+		prefix = append(prefix, filterOutgoing...)
+	}
+
+	return prefix, nil
+}
+
+// composeFilter produces a BPF filter which runs prefix followed by filter.
+// The instructions of prefix must either return or fall through to the
+// instruction which follows them. If filter is empty, frames which pass
+// prefix are accepted.
+func composeFilter(prefix, filter []bpf.RawInstruction) []bpf.RawInstruction {
+	if len(prefix) == 0 {
+		return filter
+	}
+	if len(filter) == 0 {
+		filter = filterAcceptAll
+	}
+
+	// Jumps are relative, so filter is unaffected by the instructions which
+	// precede it.
+	out := make([]bpf.RawInstruction, 0, len(prefix)+len(filter))
+	out = append(out, prefix...)
+	return append(out, filter...)
+}
+
+// A filterKind indicates how a FilterBuilder matches a frame.
+type filterKind int
+
+// Possible filterKind values.
+const (
+	_ filterKind = iota
+	kindEtherType
+	kindMAC
+	kindGroup
+	kindProtocol
+	kindAnd
+	kindOr
+)
+
+// A FilterBuilder composes simple matches against the fields of an Ethernet
+// frame header into a BPF program suitable for Config.Filter or Conn.SetBPF.
+//
+// The programs produced by FilterBuilder assume that frames begin with an
+// Ethernet header, which is the case for Raw Conns bound to Ethernet
+// interfaces.
+type FilterBuilder struct {
+	kind filterKind
+
+	// Arguments for kindEtherType, kindMAC, and kindProtocol.
+	etherType uint16
+	offset    uint32
+	mac       net.HardwareAddr
+
+	// Arguments for kindAnd and kindOr.
+	children []*FilterBuilder
+}
+
+// MatchEtherType produces a FilterBuilder which matches frames with the
+// specified EtherType.
+func MatchEtherType(etherType uint16) *FilterBuilder {
+	return &FilterBuilder{
+		kind:      kindEtherType,
+		etherType: etherType,
+	}
+}
+
+// MatchSourceMAC produces a FilterBuilder which matches frames with a source
+// MAC address equal to any of the input addresses.
+func MatchSourceMAC(macs ...net.HardwareAddr) *FilterBuilder {
+	return matchMACs(offSourceMAC, macs)
+}
+
+// MatchDestMAC produces a FilterBuilder which matches frames with a
+// destination MAC address equal to any of the input addresses.
+func MatchDestMAC(macs ...net.HardwareAddr) *FilterBuilder {
+	return matchMACs(offDestMAC, macs)
+}
+
+// matchDestGroup produces a FilterBuilder which matches frames with a broadcast
+// or multicast destination MAC address.
+func matchDestGroup() *FilterBuilder {
+	return &FilterBuilder{kind: kindGroup}
+}
+
+// protocolsPrefix returns the BPF instructions which must precede any filter
+// set on a Conn of type typ created by ListenProtocols with protocols.
+func protocolsPrefix(typ Type, protocols []int) ([]bpf.RawInstruction, error) {
+	fb, err := matchProtocols(typ, protocols)
+	if err != nil {
+		return nil, err
+	}
+
+	return fb.prefix()
+}
+
+// matchProtocols produces a FilterBuilder which matches frames carrying any of
+// protocols on a Conn of type typ.
+//
+// Raw Conns match the EtherType in the frame's header. Datagram Conns receive
+// no header, so they match the protocol which the kernel associates with the
+// frame instead. For outgoing frames, that is the protocol of the sending
+// socket rather than the EtherType in the frame.
+func matchProtocols(typ Type, protocols []int) (*FilterBuilder, error) {
+	fb := &FilterBuilder{kind: kindOr}
+	for _, p := range protocols {
+		if p < 0 || p > math.MaxUint16 {
+			return nil, fmt.Errorf("packet: invalid protocol: %d", p)
+		}
+
+		if typ == Raw {
+			fb.children = append(fb.children, MatchEtherType(uint16(p)))
+			continue
+		}
+
+		fb.children = append(fb.children, &FilterBuilder{
+			kind:      kindProtocol,
+			etherType: uint16(p),
+		})
+	}
+
+	return fb, nil
+}
+
+// matchMACs produces a FilterBuilder which matches any of macs at offset.
+func matchMACs(offset uint32, macs []net.HardwareAddr) *FilterBuilder {
+	fb := &FilterBuilder{kind: kindOr}
+	for _, mac := range macs {
+		fb.children = append(fb.children, &FilterBuilder{
+			kind:   kindMAC,
+			offset: offset,
+			mac:    mac,
+		})
+	}
+
+	return fb
+}
+
+// And produces a FilterBuilder which matches frames matched by fb and all of
+// the input FilterBuilders.
+func (fb *FilterBuilder) And(others ...*FilterBuilder) *FilterBuilder {
+	return &FilterBuilder{
+		kind:     kindAnd,
+		children: append([]*FilterBuilder{fb}, others...),
+	}
+}
+
+// Or produces a FilterBuilder which matches frames matched by fb or any of the
+// input FilterBuilders.
+func (fb *FilterBuilder) Or(others ...*FilterBuilder) *FilterBuilder {
+	return &FilterBuilder{
+		kind:     kindOr,
+		children: append([]*FilterBuilder{fb}, others...),
+	}
+}
+
+// Assemble assembles the BPF program described by fb. Frames which match are
+// accepted in their entirety, and all other frames are rejected.
+func (fb *FilterBuilder) Assemble() ([]bpf.RawInstruction, error) {
+	insts, err := fb.instructions()
+	if err != nil {
+		return nil, err
+	}
+
+	return bpf.Assemble(insts)
+}
+
+// prefix assembles the BPF program described by fb for use as a filter prefix:
+// frames which match fall through to the instruction following the program,
+// and all other frames are rejected.
+func (fb *FilterBuilder) prefix() ([]bpf.RawInstruction, error) {
+	var a filterAsm
+	match, reject := a.label(), a.label()
+	if err := a.compile(fb, match, reject); err != nil {
+		return nil, err
+	}
+
+	a.bind(reject)
+	a.insts = append(a.insts, bpf.RetConstant{Val: 0})
+	a.bind(match)
+
+	insts, err := a.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	return bpf.Assemble(insts)
+}
+
+// instructions produces the BPF instructions described by fb.
+func (fb *FilterBuilder) instructions() ([]bpf.Instruction, error) {
+	var a filterAsm
+	accept, reject := a.label(), a.label()
+	if err := a.compile(fb, accept, reject); err != nil {
+		return nil, err
+	}
+
+	a.bind(accept)
+	a.insts = append(a.insts, bpf.RetConstant{Val: filterAccept})
+	a.bind(reject)
+	a.insts = append(a.insts, bpf.RetConstant{Val: 0})
+
+	return a.resolve()
+}
+
+// A filterAsm assembles a FilterBuilder into BPF instructions with symbolic
+// jump targets which are resolved once all instructions are known.
+type filterAsm struct {
+	insts []bpf.Instruction
+
+	// jumps maps the index of a bpf.JumpIf instruction to its true and false
+	// labels, and labels maps a label to its instruction index.
+	jumps  map[int][2]int
+	labels []int
+}
+
+// label allocates a new, unbound label.
+func (a *filterAsm) label() int {
+	a.labels = append(a.labels, -1)
+	return len(a.labels) - 1
+}
+
+// bind binds label l to the next instruction.
+func (a *filterAsm) bind(l int) { a.labels[l] = len(a.insts) }
+
+// jumpIf emits a conditional jump to labels t and f if the accumulator equals
+// val.
+func (a *filterAsm) jumpIf(val uint32, t, f int) { a.jumpIfCond(bpf.JumpEqual, val, t, f) }
+
+// jumpIfCond emits a conditional jump to labels t and f using cond.
+func (a *filterAsm) jumpIfCond(cond bpf.JumpTest, val uint32, t, f int) {
+	if a.jumps == nil {
+		a.jumps = make(map[int][2]int)
+	}
+
+	a.jumps[len(a.insts)] = [2]int{t, f}
+	a.insts = append(a.insts, bpf.JumpIf{Cond: cond, Val: val})
+}
+
+// compile emits instructions which jump to label t if fb matches and to label
+// f otherwise.
+func (a *filterAsm) compile(fb *FilterBuilder, t, f int) error {
+	if fb == nil {
+		return errors.New("packet: nil FilterBuilder")
+	}
+
+	switch fb.kind {
+	case kindEtherType:
+		a.insts = append(a.insts, bpf.LoadAbsolute{Off: offEtherType, Size: 2})
+		a.jumpIf(uint32(fb.etherType), t, f)
+	case kindMAC:
+		if len(fb.mac) != 6 {
+			return fmt.Errorf("packet: invalid Ethernet MAC address: %q", fb.mac)
+		}
+
+		// Compare the first four bytes, and then the final two.
+		next := a.label()
+		a.insts = append(a.insts, bpf.LoadAbsolute{Off: fb.offset, Size: 4})
+		a.jumpIf(binary.BigEndian.Uint32(fb.mac[0:4]), next, f)
+		a.bind(next)
+		a.insts = append(a.insts, bpf.LoadAbsolute{Off: fb.offset + 4, Size: 2})
+		a.jumpIf(uint32(binary.BigEndian.Uint16(fb.mac[4:6])), t, f)
+	case kindGroup:
+		// The least significant bit of the first octet is the group bit.
+		a.insts = append(a.insts, bpf.LoadAbsolute{Off: offDestMAC, Size: 1})
+		a.jumpIfCond(bpf.JumpBitsSet, 0x01, t, f)
+	case kindProtocol:
+		// The kernel reports the protocol in host byte order.
+		a.insts = append(a.insts, bpf.LoadExtension{Num: bpf.ExtProto})
+		a.jumpIf(uint32(fb.etherType), t, f)
+	case kindAnd, kindOr:
+		if len(fb.children) == 0 {
+			return errors.New("packet: filter must match at least one value")
+		}
+
+		for i, c := range fb.children {
+			if i == len(fb.children)-1 {
+				// The final child decides the result.
+				if err := a.compile(c, t, f); err != nil {
+					return err
+				}
+				break
+			}
+
+			// For And, a match continues to the next child and a mismatch
+			// fails immediately. Or is the inverse.
+			next := a.label()
+			ct, cf := next, f
+			if fb.kind == kindOr {
+				ct, cf = t, next
+			}
+
+			if err := a.compile(c, ct, cf); err != nil {
+				return err
+			}
+			a.bind(next)
+		}
+	default:
+		// The zero value FilterBuilder must be created by one of the Match
+		// functions.
+		return errors.New("packet: invalid FilterBuilder")
+	}
+
+	return nil
+}
+
+// resolve converts symbolic jump targets to relative skips.
+func (a *filterAsm) resolve() ([]bpf.Instruction, error) {
+	for i, tf := range a.jumps {
+		skipTrue, skipFalse := a.labels[tf[0]]-i-1, a.labels[tf[1]]-i-1
+		if skipTrue > math.MaxUint8 || skipFalse > math.MaxUint8 {
+			return nil, errors.New("packet: filter too large to assemble")
+		}
+
+		j := a.insts[i].(bpf.JumpIf)
+		j.SkipTrue, j.SkipFalse = uint8(skipTrue), uint8(skipFalse)
+		a.insts[i] = j
+	}
+
+	return a.insts, nil
+}
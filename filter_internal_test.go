@@ -0,0 +1,76 @@
+package packet
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestConfigFilterPrefixLocalOnly(t *testing.T) {
+	var (
+		local   = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+		foreign = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+		bcast   = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+		mcast   = net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0x01}
+	)
+
+	cfg := &Config{LocalOnly: true}
+	if _, err := cfg.filterPrefix(Datagram, local); err == nil {
+		t.Fatal("expected an error for Datagram Conn, but none occurred")
+	}
+
+	prefix, err := cfg.filterPrefix(Raw, local)
+	if err != nil {
+		t.Fatalf("failed to build filter prefix: %v", err)
+	}
+
+	arp, err := MatchEtherType(0x0806).Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter []bpf.RawInstruction
+		dst    net.HardwareAddr
+		et     uint16
+		ok     bool
+	}{
+		{name: "local", dst: local, ok: true},
+		{name: "broadcast", dst: bcast, ok: true},
+		{name: "multicast", dst: mcast, ok: true},
+		{name: "foreign", dst: foreign},
+		{name: "filter local ARP", filter: arp, dst: local, et: 0x0806, ok: true},
+		{name: "filter local IPv4", filter: arp, dst: local, et: 0x0800},
+		{name: "filter foreign ARP", filter: arp, dst: foreign, et: 0x0806},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			insts, ok := bpf.Disassemble(composeFilter(prefix, tt.filter))
+			if !ok {
+				t.Fatal("failed to disassemble filter")
+			}
+
+			vm, err := bpf.NewVM(insts)
+			if err != nil {
+				t.Fatalf("failed to create VM: %v", err)
+			}
+
+			frame := make([]byte, 0, 6+6+2+4)
+			frame = append(frame, tt.dst...)
+			frame = append(frame, foreign...)
+			frame = append(frame, byte(tt.et>>8), byte(tt.et))
+			frame = append(frame, 0xde, 0xad, 0xbe, 0xef)
+
+			n, err := vm.Run(frame)
+			if err != nil {
+				t.Fatalf("failed to run VM: %v", err)
+			}
+			if got := n > 0; got != tt.ok {
+				t.Fatalf("unexpected result for frame to %s: accepted: %v", tt.dst, got)
+			}
+		})
+	}
+}
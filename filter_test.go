@@ -0,0 +1,164 @@
+package packet_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mdlayher/packet"
+	"golang.org/x/net/bpf"
+)
+
+func TestFilterBuilder(t *testing.T) {
+	var (
+		macA = net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+		macB = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+		macC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	)
+
+	const (
+		etARP  = 0x0806
+		etIPv4 = 0x0800
+	)
+
+	tests := []struct {
+		name   string
+		fb     *packet.FilterBuilder
+		frames []testFrame
+	}{
+		{
+			name: "EtherType",
+			fb:   packet.MatchEtherType(etARP),
+			frames: []testFrame{
+				{dst: macB, src: macA, et: etARP, ok: true},
+				{dst: macB, src: macA, et: etIPv4},
+			},
+		},
+		{
+			name: "AND",
+			fb:   packet.MatchEtherType(etARP).And(packet.MatchSourceMAC(macA, macB)),
+			frames: []testFrame{
+				{dst: macC, src: macA, et: etARP, ok: true},
+				{dst: macC, src: macB, et: etARP, ok: true},
+				{dst: macC, src: macC, et: etARP},
+				{dst: macC, src: macA, et: etIPv4},
+			},
+		},
+		{
+			name: "OR",
+			fb:   packet.MatchEtherType(etARP).Or(packet.MatchDestMAC(macA)),
+			frames: []testFrame{
+				{dst: macB, src: macC, et: etARP, ok: true},
+				{dst: macA, src: macC, et: etIPv4, ok: true},
+				{dst: macB, src: macC, et: etIPv4},
+			},
+		},
+		{
+			name: "nested",
+			fb: packet.MatchDestMAC(macA).And(
+				packet.MatchEtherType(etARP).Or(packet.MatchEtherType(etIPv4)),
+				packet.MatchSourceMAC(macB),
+			),
+			frames: []testFrame{
+				{dst: macA, src: macB, et: etARP, ok: true},
+				{dst: macA, src: macB, et: etIPv4, ok: true},
+				{dst: macA, src: macB, et: 0x86dd},
+				{dst: macA, src: macC, et: etIPv4},
+				{dst: macC, src: macB, et: etIPv4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := testVM(t, tt.fb)
+
+			for _, f := range tt.frames {
+				n, err := vm.Run(f.marshal())
+				if err != nil {
+					t.Fatalf("failed to run VM: %v", err)
+				}
+
+				if ok := n > 0; ok != f.ok {
+					t.Fatalf("unexpected result for frame %s -> %s (%#04x): accepted: %v",
+						f.src, f.dst, f.et, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterBuilderInvalidMAC(t *testing.T) {
+	fb := packet.MatchSourceMAC(net.HardwareAddr{0xff})
+	if _, err := fb.Assemble(); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestFilterBuilderInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fb   *packet.FilterBuilder
+	}{
+		{
+			name: "zero value",
+			fb:   &packet.FilterBuilder{},
+		},
+		{
+			name: "nil",
+		},
+		{
+			name: "nil And",
+			fb:   packet.MatchEtherType(0x0800).And(nil),
+		},
+		{
+			name: "nil Or",
+			fb:   packet.MatchEtherType(0x0800).Or(nil, packet.MatchEtherType(0x86dd)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.fb.Assemble(); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// A testFrame is an Ethernet frame header used to test BPF filters.
+type testFrame struct {
+	dst, src net.HardwareAddr
+	et       uint16
+	ok       bool
+}
+
+// marshal packs the testFrame into an Ethernet frame with a small payload.
+func (f testFrame) marshal() []byte {
+	b := make([]byte, 0, 6+6+2+4)
+	b = append(b, f.dst...)
+	b = append(b, f.src...)
+	b = append(b, byte(f.et>>8), byte(f.et))
+	return append(b, 0xde, 0xad, 0xbe, 0xef)
+}
+
+// testVM assembles fb and loads it into a BPF virtual machine.
+func testVM(t *testing.T, fb *packet.FilterBuilder) *bpf.VM {
+	t.Helper()
+
+	raw, err := fb.Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+
+	insts, ok := bpf.Disassemble(raw)
+	if !ok {
+		t.Fatal("failed to disassemble filter")
+	}
+
+	vm, err := bpf.NewVM(insts)
+	if err != nil {
+		t.Fatalf("failed to create VM: %v", err)
+	}
+
+	return vm
+}
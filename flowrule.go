@@ -0,0 +1,54 @@
+package packet
+
+import "net"
+
+// FlowRuleLocationAny may be used as FlowRule.Location to allow the network
+// interface's driver to choose the location of a flow rule.
+const FlowRuleLocationAny = 0xffffffff // RX_CLS_LOC_ANY
+
+// A FlowRule is an ethtool flow steering rule, also known as an ntuple filter,
+// which directs received frames matching all of its non-zero fields to a
+// specific receive queue of a network interface.
+//
+// AF_PACKET sockets cannot bind to a single receive queue, but a FlowRule
+// combined with a fanout group using FanoutQM or FanoutCPU (with receive
+// queue interrupts pinned to CPUs) approximates per-queue capture.
+//
+// Flow rules are programmed into network interface hardware and require:
+//   - a driver which implements ETHTOOL_SRXCLSRLINS for Ethernet flows, which
+//     most virtual interfaces such as veth do not
+//   - ntuple filtering to be enabled on the interface, as with
+//     "ethtool -K eth0 ntuple on"
+//   - the CAP_NET_ADMIN capability
+//
+// Flow rules outlive the Conn which inserted them, and must be removed with
+// RemoveFlowRule when no longer needed.
+type FlowRule struct {
+	// EtherType, if non-zero, matches frames with the specified EtherType.
+	EtherType uint16
+
+	// Source and Destination, if set, match frames with the specified
+	// source and destination MAC addresses.
+	Source, Destination net.HardwareAddr
+
+	// Queue is the index of the receive queue to which matching frames are
+	// steered.
+	Queue uint32
+
+	// Location is the index of the rule in the interface's rule table. Use
+	// FlowRuleLocationAny to allow the driver to choose a location.
+	Location uint32
+}
+
+// InsertFlowRule inserts a flow rule into the Conn's network interface using
+// the ethtool ETHTOOL_SRXCLSRLINS command, and returns the location of the
+// inserted rule. See the FlowRule documentation for the requirements which
+// the interface must meet.
+//
+// If the interface does not support flow rules, an error compatible with
+// errors.Is(err, syscall.EOPNOTSUPP) is returned.
+func (c *Conn) InsertFlowRule(rule *FlowRule) (uint32, error) { return c.insertFlowRule(rule) }
+
+// RemoveFlowRule removes the flow rule at the specified location from the
+// Conn's network interface using the ethtool ETHTOOL_SRXCLSRLDEL command.
+func (c *Conn) RemoveFlowRule(location uint32) error { return c.removeFlowRule(location) }
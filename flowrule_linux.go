@@ -0,0 +1,82 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x)
+// +build linux
+// +build amd64 arm64 loong64 mips64 mips64le ppc64 ppc64le riscv64 s390x
+
+package packet
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/josharian/native"
+	"golang.org/x/sys/unix"
+)
+
+// Offsets and sizes within struct ethtool_rxnfc from linux/ethtool.h. These
+// assume the 8 byte alignment of __u64 used by 64-bit architectures, which
+// is why this file is only built for them.
+const (
+	sizeofEthtoolRxnfc = 192
+
+	offRxnfcCmd = 0
+	offRxnfcFS  = 16
+
+	// Offsets relative to the embedded struct ethtool_rx_flow_spec.
+	offFlowSpecType       = 0
+	offFlowSpecHeader     = 4
+	offFlowSpecMask       = 76
+	offFlowSpecRingCookie = 152
+	offFlowSpecLocation   = 160
+)
+
+// insertFlowRule wraps the ETHTOOL_SRXCLSRLINS ethtool command.
+func (c *Conn) insertFlowRule(rule *FlowRule) (uint32, error) {
+	b := make([]byte, sizeofEthtoolRxnfc)
+	native.Endian.PutUint32(b[offRxnfcCmd:], unix.ETHTOOL_SRXCLSRLINS)
+
+	fs := b[offRxnfcFS:]
+	native.Endian.PutUint32(fs[offFlowSpecType:], unix.ETHER_FLOW)
+	native.Endian.PutUint64(fs[offFlowSpecRingCookie:], uint64(rule.Queue))
+	native.Endian.PutUint32(fs[offFlowSpecLocation:], rule.Location)
+
+	// The header is a struct ethhdr. Each mask bit which is set indicates
+	// that the matching header bit is significant.
+	hdr, mask := fs[offFlowSpecHeader:], fs[offFlowSpecMask:]
+	for _, m := range []struct {
+		mac net.HardwareAddr
+		off int
+	}{
+		{mac: rule.Destination, off: 0},
+		{mac: rule.Source, off: 6},
+	} {
+		if m.mac == nil {
+			continue
+		}
+		if len(m.mac) != 6 {
+			return 0, c.opError(opIoctl, fmt.Errorf("packet: invalid Ethernet MAC address: %q", m.mac))
+		}
+
+		copy(hdr[m.off:m.off+6], m.mac)
+		copy(mask[m.off:m.off+6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	}
+	if rule.EtherType != 0 {
+		hdr[12], hdr[13] = byte(rule.EtherType>>8), byte(rule.EtherType)
+		mask[12], mask[13] = 0xff, 0xff
+	}
+
+	if err := c.ethtool(b); err != nil {
+		return 0, err
+	}
+
+	// The kernel reports the location chosen for FlowRuleLocationAny.
+	return native.Endian.Uint32(fs[offFlowSpecLocation:]), nil
+}
+
+// removeFlowRule wraps the ETHTOOL_SRXCLSRLDEL ethtool command.
+func (c *Conn) removeFlowRule(location uint32) error {
+	b := make([]byte, sizeofEthtoolRxnfc)
+	native.Endian.PutUint32(b[offRxnfcCmd:], unix.ETHTOOL_SRXCLSRLDEL)
+	native.Endian.PutUint32(b[offRxnfcFS+offFlowSpecLocation:], location)
+
+	return c.ethtool(b)
+}
@@ -0,0 +1,19 @@
+//go:build !linux || !(amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x)
+// +build !linux !amd64,!arm64,!loong64,!mips64,!mips64le,!ppc64,!ppc64le,!riscv64,!s390x
+
+package packet
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// errFlowRuleUnimplemented is returned on platforms where the layout of
+// struct ethtool_rxnfc is not known. It is compatible with
+// errors.Is(err, syscall.EOPNOTSUPP), as documented by InsertFlowRule.
+var errFlowRuleUnimplemented = fmt.Errorf("packet: flow rules not implemented on %s/%s: %w",
+	runtime.GOOS, runtime.GOARCH, syscall.EOPNOTSUPP)
+
+func (*Conn) removeFlowRule(_ uint32) error              { return errFlowRuleUnimplemented }
+func (*Conn) insertFlowRule(_ *FlowRule) (uint32, error) { return 0, errFlowRuleUnimplemented }
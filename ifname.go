@@ -0,0 +1,149 @@
+package packet
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// interfaceByIndex looks up a network interface. Tests may replace it to
+// observe concurrent invalidation.
+var interfaceByIndex = net.InterfaceByIndex
+
+// A nameCache caches the names and MTUs of network interfaces by index.
+type nameCache struct {
+	mu    sync.RWMutex
+	names map[int]string
+	mtus  map[int]int
+
+	// Incremented by invalidate, so that fetch does not cache attributes
+	// which may have been looked up before an invalidation.
+	gen uint64
+}
+
+// lookup returns the name of the interface with the specified index, querying
+// the kernel only if the name is not already cached.
+func (nc *nameCache) lookup(index int) (string, error) {
+	nc.mu.RLock()
+	name, ok := nc.names[index]
+	nc.mu.RUnlock()
+	if ok {
+		return name, nil
+	}
+
+	ifi, err := nc.fetch(index)
+	if err != nil {
+		return "", err
+	}
+
+	return ifi.Name, nil
+}
+
+// lookupMTU returns the MTU of the interface with the specified index,
+// querying the kernel only if the MTU is not already cached.
+func (nc *nameCache) lookupMTU(index int) (int, error) {
+	nc.mu.RLock()
+	mtu, ok := nc.mtus[index]
+	nc.mu.RUnlock()
+	if ok {
+		return mtu, nil
+	}
+
+	ifi, err := nc.fetch(index)
+	if err != nil {
+		return 0, err
+	}
+
+	return ifi.MTU, nil
+}
+
+// fetch queries the kernel for the interface with the specified index and
+// caches its attributes.
+func (nc *nameCache) fetch(index int) (*net.Interface, error) {
+	nc.mu.RLock()
+	gen := nc.gen
+	nc.mu.RUnlock()
+
+	ifi, err := interfaceByIndex(index)
+	if err != nil {
+		return nil, err
+	}
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	if nc.gen != gen {
+		// The cache was invalidated during the lookup, so ifi may be stale.
+		// Return it to this caller, but let the next lookup query again.
+		return ifi, nil
+	}
+
+	if nc.names == nil {
+		nc.names = make(map[int]string)
+		nc.mtus = make(map[int]int)
+	}
+	nc.names[index] = ifi.Name
+	nc.mtus[index] = ifi.MTU
+
+	return ifi, nil
+}
+
+// invalidate removes the cached attributes of the interface with the
+// specified index, or of all interfaces if index is 0.
+func (nc *nameCache) invalidate(index int) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	nc.gen++
+	if index == 0 {
+		nc.names = nil
+		nc.mtus = nil
+		return
+	}
+
+	delete(nc.names, index)
+	delete(nc.mtus, index)
+}
+
+// interfaceForIP returns the network interface which is assigned ip, or failing
+// that, the first network interface which is assigned a subnet containing ip.
+// Interfaces which are down are ignored.
+func interfaceForIP(ip net.IP) (*net.Interface, error) {
+	ifis, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var subnet *net.Interface
+	for i := range ifis {
+		ifi := &ifis[i]
+		if ifi.Flags&net.FlagUp == 0 {
+			continue
+		}
+
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range addrs {
+			ipn, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+
+			if ipn.IP.Equal(ip) {
+				return ifi, nil
+			}
+			if subnet == nil && ipn.Contains(ip) {
+				subnet = ifi
+			}
+		}
+	}
+
+	if subnet == nil {
+		return nil, fmt.Errorf("packet: no network interface found with an address or subnet matching %s", ip)
+	}
+
+	return subnet, nil
+}
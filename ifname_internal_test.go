@@ -0,0 +1,157 @@
+package packet
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNameCache(t *testing.T) {
+	ifi := testLoopback(t)
+
+	var nc nameCache
+	for i := 0; i < 2; i++ {
+		name, err := nc.lookup(ifi.Index)
+		if err != nil {
+			t.Fatalf("failed to look up name: %v", err)
+		}
+		if name != ifi.Name {
+			t.Fatalf("unexpected name: %q", name)
+		}
+	}
+
+	// Simulate a rename which has not yet been observed.
+	nc.names[ifi.Index] = "stale"
+	if name, _ := nc.lookup(ifi.Index); name != "stale" {
+		t.Fatalf("expected cached name, but got: %q", name)
+	}
+
+	for _, index := range []int{ifi.Index, 0} {
+		nc.names[ifi.Index] = "stale"
+		nc.invalidate(index)
+
+		name, err := nc.lookup(ifi.Index)
+		if err != nil {
+			t.Fatalf("failed to look up name: %v", err)
+		}
+		if name != ifi.Name {
+			t.Fatalf("unexpected name after invalidating %d: %q", index, name)
+		}
+	}
+
+	nc.mtus[ifi.Index] = 1
+	nc.invalidate(ifi.Index)
+	if mtu, err := nc.lookupMTU(ifi.Index); err != nil || mtu != ifi.MTU {
+		t.Fatalf("unexpected MTU after invalidating: %d, err: %v", mtu, err)
+	}
+
+	if _, err := nc.lookup(-1); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestNameCacheInvalidateDuringLookup(t *testing.T) {
+	ifi := testLoopback(t)
+
+	var nc nameCache
+	defer func(fn func(int) (*net.Interface, error)) { interfaceByIndex = fn }(interfaceByIndex)
+	interfaceByIndex = func(index int) (*net.Interface, error) {
+		// The interface changes after it was queried, but before the result
+		// is cached.
+		stale := *ifi
+		stale.Name = "stale"
+		nc.invalidate(index)
+		return &stale, nil
+	}
+
+	if name, err := nc.lookup(ifi.Index); err != nil || name != "stale" {
+		t.Fatalf("unexpected name: %q, err: %v", name, err)
+	}
+	if _, ok := nc.names[ifi.Index]; ok {
+		t.Fatal("name looked up before invalidation was cached")
+	}
+
+	// Once no invalidation races with the lookup, the result is cached.
+	interfaceByIndex = net.InterfaceByIndex
+	if name, err := nc.lookup(ifi.Index); err != nil || name != ifi.Name {
+		t.Fatalf("unexpected name: %q, err: %v", name, err)
+	}
+	if name := nc.names[ifi.Index]; name != ifi.Name {
+		t.Fatalf("unexpected cached name: %q", name)
+	}
+}
+
+func Test_interfaceForIP(t *testing.T) {
+	lo := testLoopback(t)
+	if lo.Flags&net.FlagUp == 0 {
+		t.Skip("skipping, loopback interface is down")
+	}
+
+	tests := []struct {
+		name string
+		ip   net.IP
+		ok   bool
+	}{
+		{name: "exact", ip: net.IPv4(127, 0, 0, 1), ok: true},
+		{name: "subnet", ip: net.IPv4(127, 0, 0, 2), ok: true},
+		{name: "no match", ip: net.ParseIP("2001:db8::1")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ifi, err := interfaceForIP(tt.ip)
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("expected an error, but got interface %q", ifi.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to find interface: %v", err)
+			}
+
+			if ifi.Index != lo.Index {
+				t.Fatalf("unexpected interface: %q", ifi.Name)
+			}
+		})
+	}
+}
+
+func BenchmarkNameCache(b *testing.B) {
+	ifi := testLoopback(b)
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := net.InterfaceByIndex(ifi.Index); err != nil {
+				b.Fatalf("failed to get interface: %v", err)
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		var nc nameCache
+		for i := 0; i < b.N; i++ {
+			if _, err := nc.lookup(ifi.Index); err != nil {
+				b.Fatalf("failed to look up name: %v", err)
+			}
+		}
+	})
+}
+
+// testLoopback returns a loopback interface, or skips the test if none exists.
+func testLoopback(tb testing.TB) *net.Interface {
+	tb.Helper()
+
+	ifis, err := net.Interfaces()
+	if err != nil {
+		tb.Fatalf("failed to get network interfaces: %v", err)
+	}
+
+	for _, ifi := range ifis {
+		if ifi.Flags&net.FlagLoopback != 0 {
+			return &ifi
+		}
+	}
+
+	tb.Skip("skipping, no loopback interface found")
+	return nil
+}
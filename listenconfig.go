@@ -0,0 +1,63 @@
+package packet
+
+import (
+	"net"
+
+	"golang.org/x/net/bpf"
+)
+
+// A ListenConfig builds a Config using chained method calls, and opens Conns
+// using the resulting Config. The zero value of ListenConfig applies the
+// default configuration.
+//
+// Each With method returns a modified copy of the ListenConfig, so a base
+// ListenConfig may be shared and specialized for several Conns:
+//
+//	lc := packet.ListenConfig{}.WithDirection(packet.DirectionIn)
+//	c, err := lc.WithPromiscuous(true).Listen(ifi, packet.Raw, protocol)
+type ListenConfig struct {
+	cfg Config
+}
+
+// WithFilter sets Config.Filter.
+func (lc ListenConfig) WithFilter(filter []bpf.RawInstruction) ListenConfig {
+	lc.cfg.Filter = filter
+	return lc
+}
+
+// WithDirection sets Config.Direction.
+func (lc ListenConfig) WithDirection(d Direction) ListenConfig {
+	lc.cfg.Direction = d
+	return lc
+}
+
+// WithFanout sets Config.Fanout. A nil FanoutConfig disables fanout.
+func (lc ListenConfig) WithFanout(f *FanoutConfig) ListenConfig {
+	if f != nil {
+		// Copy so that later modifications by the caller are not observed.
+		fc := *f
+		f = &fc
+	}
+
+	lc.cfg.Fanout = f
+	return lc
+}
+
+// WithPromiscuous sets Config.Promiscuous.
+func (lc ListenConfig) WithPromiscuous(enable bool) ListenConfig {
+	lc.cfg.Promiscuous = enable
+	return lc
+}
+
+// Config returns a copy of the Config built by lc.
+func (lc ListenConfig) Config() *Config {
+	cfg := lc.cfg
+	return &cfg
+}
+
+// Listen opens a packet sockets connection on the specified interface using
+// the Config built by lc. The parameters have the same meaning as those of
+// the Listen function.
+func (lc ListenConfig) Listen(ifi *net.Interface, socketType Type, protocol int) (*Conn, error) {
+	return Listen(ifi, socketType, protocol, lc.Config())
+}
@@ -0,0 +1,45 @@
+package packet_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/packet"
+	"golang.org/x/net/bpf"
+)
+
+func TestListenConfigConfig(t *testing.T) {
+	filter := []bpf.RawInstruction{{Op: 0x6, K: 0xffffffff}}
+	fanout := &packet.FanoutConfig{GroupID: 1, Type: packet.FanoutCPU, Rollover: true}
+
+	lc := packet.ListenConfig{}.
+		WithFilter(filter).
+		WithDirection(packet.DirectionIn).
+		WithFanout(fanout).
+		WithPromiscuous(true)
+
+	// Modifying the input after the fact must not affect the builder.
+	fanout.GroupID = 2
+
+	want := &packet.Config{
+		Filter:      filter,
+		Direction:   packet.DirectionIn,
+		Fanout:      &packet.FanoutConfig{GroupID: 1, Type: packet.FanoutCPU, Rollover: true},
+		Promiscuous: true,
+	}
+
+	if diff := cmp.Diff(want, lc.Config()); diff != "" {
+		t.Fatalf("unexpected Config (-want +got):\n%s", diff)
+	}
+
+	// Each With method must return a copy.
+	if diff := cmp.Diff(&packet.Config{}, packet.ListenConfig{}.Config()); diff != "" {
+		t.Fatalf("unexpected zero Config (-want +got):\n%s", diff)
+	}
+
+	base := packet.ListenConfig{}.WithDirection(packet.DirectionOut)
+	_ = base.WithPromiscuous(true)
+	if base.Config().Promiscuous {
+		t.Fatal("ListenConfig was modified in place")
+	}
+}
@@ -0,0 +1,140 @@
+package packet
+
+import (
+	"bytes"
+	"net"
+	"sync"
+)
+
+// A MembershipType is the type of a link layer membership which a Conn holds
+// on its network interface.
+//
+//enumcheck:exhaustive
+type MembershipType int
+
+// Possible MembershipType values, from the PACKET_MR_* constants in
+// linux/if_packet.h.
+const (
+	// MembershipMulticast receives frames sent to a multicast address, as
+	// added by Conn.JoinGroup.
+	MembershipMulticast MembershipType = 0
+
+	// MembershipPromiscuous places the interface in promiscuous mode, as
+	// added by Conn.SetPromiscuous or Config.Promiscuous.
+	MembershipPromiscuous MembershipType = 1
+
+	// MembershipAllMulticast receives frames sent to all multicast addresses,
+	// as added by Conn.SetAllMulticast.
+	MembershipAllMulticast MembershipType = 2
+)
+
+// A Membership is a link layer membership which a Conn holds on its network
+// interface. The kernel releases all of a Conn's memberships when its socket
+// is closed.
+type Membership struct {
+	// Type is the type of the membership.
+	Type MembershipType
+
+	// Addr is the multicast address of a MembershipMulticast membership, and
+	// is nil for other types.
+	Addr net.HardwareAddr
+}
+
+// A membershipSet tracks the memberships added to a socket, which the kernel
+// does not report. Like the kernel, it counts repeated additions of the same
+// membership, so that each must be dropped before the membership is removed.
+type membershipSet struct {
+	mu      sync.Mutex
+	entries []membershipEntry
+}
+
+// A membershipEntry is a Membership and the number of times it was added.
+type membershipEntry struct {
+	m     Membership
+	count int
+}
+
+// add records an addition of m.
+func (ms *membershipSet) add(m Membership) {
+	if ms == nil {
+		return
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if i := ms.index(m); i >= 0 {
+		ms.entries[i].count++
+		return
+	}
+
+	// Copy the address so that it cannot be modified by the caller.
+	m.Addr = append(net.HardwareAddr(nil), m.Addr...)
+	ms.entries = append(ms.entries, membershipEntry{m: m, count: 1})
+}
+
+// drop records a removal of m.
+func (ms *membershipSet) drop(m Membership) {
+	if ms == nil {
+		return
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	i := ms.index(m)
+	if i < 0 {
+		return
+	}
+
+	if ms.entries[i].count--; ms.entries[i].count == 0 {
+		ms.entries = append(ms.entries[:i], ms.entries[i+1:]...)
+	}
+}
+
+// take records the removal of all memberships, and returns the entries which
+// were present so that the caller may drop them from the socket.
+func (ms *membershipSet) take() []membershipEntry {
+	if ms == nil {
+		return nil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entries := ms.entries
+	ms.entries = nil
+	return entries
+}
+
+// list returns a copy of the memberships in the order they were first added.
+func (ms *membershipSet) list() []Membership {
+	if ms == nil {
+		return nil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	out := make([]Membership, 0, len(ms.entries))
+	for _, e := range ms.entries {
+		out = append(out, Membership{
+			Type: e.m.Type,
+			Addr: append(net.HardwareAddr(nil), e.m.Addr...),
+		})
+	}
+
+	return out
+}
+
+// index returns the index of m in ms.entries, or -1 if it is not present. The
+// caller must hold ms.mu.
+func (ms *membershipSet) index(m Membership) int {
+	for i, e := range ms.entries {
+		if e.m.Type == m.Type && bytes.Equal(e.m.Addr, m.Addr) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,111 @@
+//go:build linux
+// +build linux
+
+package packet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/josharian/native"
+	"github.com/mdlayher/socket"
+	"golang.org/x/sys/unix"
+)
+
+// A linkMonitor watches rtnetlink notifications for the removal of a network
+// interface.
+type linkMonitor struct {
+	c conn
+}
+
+// newLinkMonitor subscribes to rtnetlink link notifications. The caller must
+// start a goroutine which calls watch to process the notifications.
+func newLinkMonitor() (*linkMonitor, error) {
+	c, err := socket.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_ROUTE, "netlink", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Bind(&unix.SockaddrNetlink{Groups: unix.RTMGRP_LINK}); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return &linkMonitor{c: c}, nil
+}
+
+// Close stops the linkMonitor. It does not wait for the background goroutine
+// to exit, so it is safe to call from fn.
+func (m *linkMonitor) Close() error { return m.c.Close() }
+
+// watch reads rtnetlink messages until ifIndex is removed or the linkMonitor
+// is closed, and invokes fn when ifIndex is removed. changed is invoked with
+// the index of each interface which is added, modified, or removed, or with
+// index 0 if notifications were lost.
+func (m *linkMonitor) watch(ifIndex int, fn func(), changed func(index int)) {
+	// Link messages carry many attributes, so leave plenty of room to avoid
+	// truncation.
+	b := make([]byte, 32*1024)
+	for {
+		n, _, err := m.c.Recvfrom(context.Background(), b, 0)
+		if err != nil {
+			if errors.Is(err, unix.ENOBUFS) {
+				// The kernel dropped notifications because we could not keep
+				// up, but the socket is still usable. The removal of ifIndex
+				// may have been dropped, so check whether it still exists. If
+				// that fails, keep watching rather than reporting a removal
+				// which may not have happened.
+				changed(0)
+				if ok, err := interfaceExists(ifIndex); err == nil && !ok {
+					fn()
+					return
+				}
+				continue
+			}
+
+			// The linkMonitor was closed.
+			return
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(b[:n])
+		if err != nil {
+			continue
+		}
+
+		for _, msg := range msgs {
+			// struct ifinfomsg begins with family, padding, and type fields
+			// before the 32-bit interface index.
+			typ := msg.Header.Type
+			if (typ != unix.RTM_NEWLINK && typ != unix.RTM_DELLINK) || len(msg.Data) < unix.SizeofIfInfomsg {
+				continue
+			}
+
+			index := int(int32(native.Endian.Uint32(msg.Data[4:8])))
+			changed(index)
+
+			if typ == unix.RTM_DELLINK && index == ifIndex {
+				fn()
+				return
+			}
+		}
+	}
+}
+
+// interfaceExists reports whether a network interface with the specified index
+// exists. Tests may replace it.
+var interfaceExists = func(index int) (bool, error) {
+	ifis, err := net.Interfaces()
+	if err != nil {
+		return false, err
+	}
+
+	for _, ifi := range ifis {
+		if ifi.Index == index {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
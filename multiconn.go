@@ -0,0 +1,135 @@
+package packet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime"
+)
+
+// A MultiConn is a group of Conns which share a PACKET_FANOUT group, each of
+// which is read by its own goroutine pinned to a single CPU. MultiConn
+// packages the common pattern for scaling capture across CPUs: the kernel
+// distributes frames among the Conns, and each reader delivers frames on its
+// own channel so that consumers need not share any state.
+type MultiConn struct {
+	conns  []*Conn
+	frames []<-chan Frame
+	cancel context.CancelFunc
+}
+
+// ListenMulti opens one Conn per entry in cpus using Listen, and joins each
+// Conn to the same fanout group. Frames read by the Conn for cpus[i] are
+// delivered on the channel returned by Frames(i), which buffers up to bufSize
+// frames with the same backpressure semantics as Conn.Stream.
+//
+// Each Conn is read by a goroutine which is locked to its OS thread, and that
+// thread's CPU affinity is set to the matching CPU using sched_setaffinity(2).
+// The CPUs must be permitted by the process's CPU affinity mask or cgroup, or
+// ListenMulti returns an error. Pinned threads are dedicated to their readers
+// until the MultiConn is closed.
+//
+// If cfg.Fanout is nil, the Conns join a new fanout group using FanoutCPU,
+// which delivers each frame to the Conn for the CPU which received it. The
+// group is created with FanoutConfig.UniqueID so that it cannot collide with
+// groups created by other sockets. For this to map frames onto the pinned
+// readers, the interface's receive queue interrupts should be steered to the
+// same CPUs. Otherwise, cfg.Fanout must specify a group which is not used by
+// other sockets. If cfg.Fanout sets UniqueID, the first Conn creates the group
+// and the remaining Conns join it by its ID with the same Type and flags.
+func ListenMulti(ifi *net.Interface, socketType Type, protocol int, cpus []int, bufSize int, cfg *Config) (*MultiConn, error) {
+	if len(cpus) == 0 {
+		return nil, errors.New("packet: MultiConn requires at least one CPU")
+	}
+
+	var mcfg Config
+	if cfg != nil {
+		mcfg = *cfg
+	}
+	// By default, the first Conn creates the group, and the remaining Conns
+	// join it using the ID chosen by the kernel.
+	if mcfg.Fanout == nil {
+		mcfg.Fanout = &FanoutConfig{
+			Type:     FanoutCPU,
+			UniqueID: true,
+		}
+	}
+	unique := mcfg.Fanout.UniqueID
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &MultiConn{cancel: cancel}
+
+	for _, cpu := range cpus {
+		c, err := Listen(ifi, socketType, protocol, &mcfg)
+		if err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+		m.conns = append(m.conns, c)
+
+		if unique && len(m.conns) == 1 {
+			id, _, err := c.FanoutGroupID()
+			if err != nil {
+				_ = m.Close()
+				return nil, err
+			}
+
+			// Each further Conn with UniqueID set would create a group of
+			// its own, so join the first Conn's group by ID instead.
+			f := *mcfg.Fanout
+			f.GroupID, f.UniqueID = id, false
+			mcfg.Fanout = &f
+		}
+
+		frames := make(chan Frame, bufSize)
+		pinned := make(chan error)
+		go func(cpu int) {
+			// The thread remains locked for the lifetime of the reader, after
+			// which the runtime discards it along with its affinity.
+			runtime.LockOSThread()
+
+			if err := pinToCPU(cpu); err != nil {
+				close(frames)
+				pinned <- err
+				return
+			}
+			pinned <- nil
+
+			c.stream(ctx, frames)
+		}(cpu)
+
+		if err := <-pinned; err != nil {
+			_ = m.Close()
+			return nil, c.opError(opListen, err)
+		}
+		m.frames = append(m.frames, frames)
+	}
+
+	return m, nil
+}
+
+// Conns returns the MultiConn's Conns, in the same order as the CPUs passed to
+// ListenMulti. The Conns must not be read directly, but may be used to query
+// statistics or configure socket options.
+func (m *MultiConn) Conns() []*Conn { return m.conns }
+
+// Group returns a FanoutGroup of the MultiConn's Conns, which may be used to
+// check how evenly frames are distributed among the CPUs.
+func (m *MultiConn) Group() *FanoutGroup { return NewFanoutGroup(m.conns...) }
+
+// Frames returns the channel on which frames read by the i'th Conn are
+// delivered. The channel is closed when the MultiConn is closed or when a read
+// on that Conn fails.
+func (m *MultiConn) Frames(i int) <-chan Frame { return m.frames[i] }
+
+// Close stops all readers and closes all of the MultiConn's Conns.
+func (m *MultiConn) Close() error {
+	m.cancel()
+
+	var errs []error
+	for _, c := range m.conns {
+		errs = append(errs, c.Close())
+	}
+
+	return errors.Join(errs...)
+}
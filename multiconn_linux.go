@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package packet
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// pinToCPU sets the CPU affinity of the calling thread to cpu.
+func pinToCPU(cpu int) error {
+	var set unix.CPUSet
+	set.Set(cpu)
+
+	return os.NewSyscallError("sched_setaffinity", unix.SchedSetaffinity(0, &set))
+}
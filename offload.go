@@ -0,0 +1,32 @@
+package packet
+
+// Offloads describes the offload settings of a network interface, as reported
+// by ethtool.
+//
+// Offloads allow the kernel and network interface hardware to process frames
+// in ways which cause captured frames to differ from the frames on the wire:
+//   - GRO and LRO coalesce received frames into a single larger frame, so
+//     captured frames may exceed the interface's MTU
+//   - TSO and GSO segment transmitted frames after they are captured, so
+//     captured outgoing frames may also exceed the MTU
+//   - RxChecksum and TxChecksum offload checksum computation to hardware, so
+//     captured outgoing frames may carry incorrect checksums
+//
+// Capture tools which require frames exactly as seen on the wire should warn
+// users when GRO, LRO, TSO, or GSO are enabled.
+type Offloads struct {
+	RxChecksum    bool // Receive checksum offload.
+	TxChecksum    bool // Transmit checksum offload.
+	ScatterGather bool // Scatter-gather.
+	TSO           bool // TCP segmentation offload.
+	GSO           bool // Generic segmentation offload.
+	GRO           bool // Generic receive offload.
+	LRO           bool // Large receive offload.
+}
+
+// OffloadSettings reads the offload settings of the Conn's network interface
+// using ethtool ioctls.
+//
+// If the interface does not report a setting, an error compatible with
+// errors.Is(err, syscall.EOPNOTSUPP) is returned.
+func (c *Conn) OffloadSettings() (*Offloads, error) { return c.offloadSettings() }
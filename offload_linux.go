@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+package packet
+
+import (
+	"github.com/josharian/native"
+	"golang.org/x/sys/unix"
+)
+
+// ethFlagLRO is the ETH_FLAG_LRO flag from linux/ethtool.h.
+const ethFlagLRO = 1 << 15
+
+// offloadSettings wraps the ethtool commands which report offload settings.
+func (c *Conn) offloadSettings() (*Offloads, error) {
+	var o Offloads
+	for _, s := range []struct {
+		cmd  uint32
+		mask uint32
+		v    *bool
+	}{
+		{cmd: unix.ETHTOOL_GRXCSUM, mask: 1, v: &o.RxChecksum},
+		{cmd: unix.ETHTOOL_GTXCSUM, mask: 1, v: &o.TxChecksum},
+		{cmd: unix.ETHTOOL_GSG, mask: 1, v: &o.ScatterGather},
+		{cmd: unix.ETHTOOL_GTSO, mask: 1, v: &o.TSO},
+		{cmd: unix.ETHTOOL_GGSO, mask: 1, v: &o.GSO},
+		{cmd: unix.ETHTOOL_GGRO, mask: 1, v: &o.GRO},
+		{cmd: unix.ETHTOOL_GFLAGS, mask: ethFlagLRO, v: &o.LRO},
+	} {
+		// struct ethtool_value.
+		b := make([]byte, 8)
+		native.Endian.PutUint32(b[0:4], s.cmd)
+		if err := c.ethtool(b); err != nil {
+			return nil, err
+		}
+
+		*s.v = native.Endian.Uint32(b[4:8])&s.mask != 0
+	}
+
+	return &o, nil
+}
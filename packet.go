@@ -1,7 +1,13 @@
 package packet
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -13,19 +19,52 @@ const (
 	network = "packet"
 
 	// Operation names which may be returned in net.OpError.
-	opClose       = "close"
-	opGetsockopt  = "getsockopt"
-	opListen      = "listen"
-	opRawControl  = "raw-control"
-	opRawRead     = "raw-read"
-	opRawWrite    = "raw-write"
-	opRead        = "read"
-	opSet         = "set"
-	opSetsockopt  = "setsockopt"
-	opSyscallConn = "syscall-conn"
-	opWrite       = "write"
+	opBroadcastAddr = "broadcast-addr"
+	opClose         = "close"
+	opGetsockname   = "getsockname"
+	opGetsockopt    = "getsockopt"
+	opIoctl         = "ioctl"
+	opLinkSpeed     = "link-speed"
+	opListen        = "listen"
+	opRawControl    = "raw-control"
+	opRawRead       = "raw-read"
+	opRawWrite      = "raw-write"
+	opRead          = "read"
+	opSet           = "set"
+	opSetsockopt    = "setsockopt"
+	opSyscallConn   = "syscall-conn"
+	opWrite         = "write"
 )
 
+// ErrNoBroadcast is returned by Conn.BroadcastAddr when the network interface
+// does not support broadcast, as is the case for loopback and point-to-point
+// interfaces.
+var ErrNoBroadcast = errors.New("packet: interface does not support broadcast")
+
+// ErrLinkSpeedUnknown is returned by Conn.LinkSpeed when the network interface
+// does not report a link speed, as is common for virtual interfaces.
+var ErrLinkSpeedUnknown = errors.New("packet: link speed unknown")
+
+// ErrIdleTimeout is returned by reads on a Conn which was closed because no
+// frames arrived within Config.IdleTimeout.
+var ErrIdleTimeout = errors.New("packet: idle timeout")
+
+// ErrInterfaceUnavailable is returned by Listen when the network interface
+// cannot be bound, typically because it was removed or its index changed after
+// the caller looked it up. Such errors are transient from the perspective of a
+// caller which can look up the interface again and retry. The error also
+// matches the underlying system call error, such as syscall.ENODEV.
+var ErrInterfaceUnavailable = errors.New("packet: network interface unavailable")
+
+// ErrCaptureComplete is returned by reads on a Conn which has already read
+// Config.MaxPackets frames.
+var ErrCaptureComplete = errors.New("packet: capture complete")
+
+// ErrSourceMACMismatch is returned by writes on a Conn created with
+// Config.StrictSourceMAC when the source MAC address of a frame does not match
+// the hardware address of the Conn's network interface.
+var ErrSourceMACMismatch = errors.New("packet: frame source MAC address does not match interface")
+
 // Config contains options for a Conn.
 type Config struct {
 	// Filter is an optional assembled BPF filter which can be applied to the
@@ -35,7 +74,174 @@ type Config struct {
 	// been opened, but setting Filter applies the BPF filter before the Conn is
 	// bound. This ensures that unexpected packets will not be captured before
 	// the Conn is opened.
+	//
+	// If Filter and any filter required by the Config together exceed the
+	// kernel's limit of 4096 instructions, Listen returns an error compatible
+	// with errors.Is(err, ErrFilterTooLong).
 	Filter []bpf.RawInstruction
+
+	// FilterAfterBind reverses the default ordering so that Filter is applied
+	// after bind(2) is called, mirroring the behavior of libpcap.
+	//
+	// Frames which arrive between bind(2) and the application of Filter are
+	// captured regardless of Filter. To prevent those frames from leaking to
+	// the caller, the Conn first attaches a filter which rejects all frames,
+	// drains any frames which were queued in the meantime, and only then
+	// attaches Filter. Frames which match Filter and arrive during this brief
+	// window are also discarded.
+	//
+	// Most callers should leave this unset.
+	FilterAfterBind bool
+
+	// OnInterfaceRemoved is an optional callback which is invoked from a
+	// background goroutine when the network interface the Conn is bound to is
+	// removed from the system. Setting this field causes the Conn to monitor
+	// rtnetlink for link removal notifications.
+	//
+	// Without this notification, the removal of an interface is only observed
+	// when reads or writes fail with errors such as ENXIO or ENETDOWN.
+	OnInterfaceRemoved func()
+
+	// CloseOnInterfaceRemoved closes the Conn when the network interface the
+	// Conn is bound to is removed from the system. If OnInterfaceRemoved is
+	// also set, the Conn is closed before the callback is invoked.
+	CloseOnInterfaceRemoved bool
+
+	// VnetHdr enables the PACKET_VNET_HDR option, which causes the Linux kernel
+	// to prepend a virtio_net_hdr to each received frame and to expect one
+	// before each transmitted frame. Use Conn.ReadFromVnetHdr and
+	// Conn.WriteToVnetHdr to read and write frames with a parsed VnetHdr.
+	// Frames read or written using ReadFrom and WriteTo must begin with the raw
+	// virtio_net_hdr bytes.
+	//
+	// VnetHdr is only supported by Raw Conns.
+	VnetHdr bool
+
+	// Direction specifies which frames the Conn captures based on the direction
+	// in which they traverse the network interface. The zero value,
+	// DirectionInOut, captures frames in both directions.
+	Direction Direction
+
+	// Fanout, if non-nil, adds the Conn to a PACKET_FANOUT group so that
+	// received frames are load balanced among the members of the group.
+	Fanout *FanoutConfig
+
+	// LocalOnly attaches a BPF filter which rejects frames unless their
+	// destination MAC address is the network interface's own address or a
+	// broadcast or multicast address. This filters out frames destined for
+	// other hosts which are captured when the interface is promiscuous, such
+	// as when another program has left it in promiscuous mode. The filter
+	// precedes Filter and any filter set by Conn.SetBPF.
+	//
+	// LocalOnly is only supported by Raw Conns on interfaces with Ethernet
+	// addresses.
+	LocalOnly bool
+
+	// Promiscuous enables promiscuous mode on the Conn, as if by calling
+	// Conn.SetPromiscuous, before Listen returns.
+	Promiscuous bool
+
+	// StrictSourceMAC causes writes to return an error compatible with
+	// errors.Is(err, ErrSourceMACMismatch) unless the source MAC address in
+	// the frame's Ethernet header is the network interface's own address.
+	// This catches frames built with the wrong source address by mistake.
+	// Programs which intentionally send frames from other addresses should
+	// leave StrictSourceMAC unset, which is the default.
+	//
+	// StrictSourceMAC is only supported by Raw Conns on interfaces with
+	// Ethernet addresses, which excludes Conns created by ListenAll.
+	StrictSourceMAC bool
+
+	// IdleTimeout, if non-zero, closes the Conn automatically if no frame is
+	// read within the specified duration. The timer starts when Listen
+	// returns and is reset by each successful read. Once the Conn is closed,
+	// reads return an error compatible with errors.Is(err, ErrIdleTimeout).
+	//
+	// IdleTimeout is independent of read deadlines: a read which times out
+	// due to a deadline does not reset the timer, and the Conn is closed even
+	// if a read with a later deadline is in progress.
+	IdleTimeout time.Duration
+
+	// OriginalDevice enables the PACKET_ORIGDEV option, which causes
+	// Addr.Index to report the interface which originally received a frame
+	// rather than a logical interface stacked on top of it. For example, a
+	// frame received by a member of a bonded interface reports the member
+	// rather than the bond.
+	OriginalDevice bool
+
+	// Auxdata enables the PACKET_AUXDATA option, which causes the Linux kernel
+	// to attach metadata such as checksum validation status and stripped VLAN
+	// tags to each received frame. Use Conn.ReadFromAuxdata to read frames
+	// with their Auxdata.
+	//
+	// If the kernel does not support PACKET_AUXDATA or does not attach
+	// metadata to a frame, Conn.ReadFromAuxdata returns zero-valued Auxdata
+	// rather than an error. Use Conn.AuxdataDelivered to determine whether
+	// the metadata is actually being delivered.
+	Auxdata bool
+
+	// MaxReadRate, if non-zero, limits the rate at which Conn.ReadFrom (and
+	// therefore Conn.Stream) delivers frames to at most MaxReadRate frames
+	// per second, enforced in userspace using a token bucket which permits
+	// bursts of up to 10 milliseconds' worth of frames.
+	//
+	// By default, a read which exceeds the rate waits until the rate permits
+	// the frame to be delivered. Meanwhile, frames continue to queue in the
+	// kernel, which drops them once the socket's receive buffer is full, as
+	// reported by Conn.Stats. The wait is not interrupted by read deadlines
+	// or by Close.
+	//
+	// If MaxReadRateDrop is set, frames which exceed the rate are instead
+	// discarded in userspace and the read continues with the next frame.
+	// This keeps the kernel's queue short, so delivered frames are recent,
+	// at the cost of discarding frames which the kernel would have buffered.
+	MaxReadRate     int
+	MaxReadRateDrop bool
+
+	// MaxPackets, if non-zero, limits the Conn to reading MaxPackets frames
+	// with Conn.ReadFrom (and therefore Conn.Stream). Once MaxPackets frames
+	// have been read, further reads return an error compatible with
+	// errors.Is(err, ErrCaptureComplete) without reading from the socket.
+	// The count is kept separately by each Conn and is never reset.
+	MaxPackets int
+
+	// BufferPool, if non-nil, supplies the buffers into which Conn.Stream
+	// reads frames, instead of allocating a new buffer for each frame. This
+	// allows callers with sustained high capture rates to reuse buffers and
+	// avoid garbage collection pauses which may cause the kernel to drop
+	// frames. See BufferPool for the ownership contract.
+	BufferPool BufferPool
+
+	// ListenRetry, if non-nil, causes Listen to retry when opening or binding
+	// the socket fails with a transient error. See ListenRetry for details.
+	ListenRetry *ListenRetry
+
+	// CumulativeStats, if true, causes Conn.Stats to return totals accumulated
+	// since the Conn was created, rather than counts since the previous call.
+	// The kernel resets its counters each time they are read, so without
+	// CumulativeStats, concurrent callers of Stats each observe only a portion
+	// of the counts. With CumulativeStats, calls to Stats are serialized and
+	// no counts are lost. Conns created by Conn.Ref share the same totals.
+	CumulativeStats bool
+}
+
+// A ListenRetry configures Listen to retry transient failures to open or bind
+// a socket, which may occur on busy systems, such as while file descriptor or
+// memory exhaustion is being relieved.
+//
+// The errors considered transient are EAGAIN, ENOBUFS, ENOMEM, EMFILE, and
+// ENFILE. Other errors, such as EPERM or an error compatible with
+// errors.Is(err, ErrInterfaceUnavailable), are returned immediately. Errors
+// caused by an invalid Config are never retried. If every attempt fails, the
+// error from the final attempt is returned.
+type ListenRetry struct {
+	// Attempts is the maximum number of attempts, including the first.
+	// Values less than 2 disable retries.
+	Attempts int
+
+	// Backoff is the delay before the second attempt, which is doubled
+	// before each subsequent attempt up to the maximum time.Duration.
+	Backoff time.Duration
 }
 
 // Type is a socket type used when creating a Conn with Listen.
@@ -50,6 +256,27 @@ const (
 	Datagram
 )
 
+// Direction specifies which frames a Conn captures based on the direction in
+// which they traverse its network interface.
+//
+//enumcheck:exhaustive
+type Direction int
+
+// Possible Direction values.
+//
+// DirectionInOut captures frames received by the interface and frames
+// transmitted by the local machine, including frames written by the Conn
+// itself. Addr.PacketType reports the direction of each frame.
+//
+// DirectionIn uses the PACKET_IGNORE_OUTGOING socket option, which requires
+// Linux 4.20 or newer. DirectionOut attaches a BPF filter which matches the
+// packet type of each frame, in addition to any filter set by the caller.
+const (
+	DirectionInOut Direction = iota
+	DirectionIn
+	DirectionOut
+)
+
 // Listen opens a packet sockets connection on the specified interface, using
 // the given socket type and protocol values.
 //
@@ -57,15 +284,149 @@ const (
 //
 // The Config specifies optional configuration for the Conn. A nil *Config
 // applies the default configuration.
+//
+// If the interface no longer exists, an error compatible with
+// errors.Is(err, ErrInterfaceUnavailable) is returned.
 func Listen(ifi *net.Interface, socketType Type, protocol int, cfg *Config) (*Conn, error) {
-	l, err := listen(ifi, socketType, protocol, cfg)
+	return listenProtocols(ifi, socketType, protocol, nil, cfg)
+}
+
+// listenProtocols implements Listen and ListenProtocols. If protocols is not
+// empty, the Conn only receives frames carrying those protocols.
+func listenProtocols(ifi *net.Interface, socketType Type, protocol int, protocols []int, cfg *Config) (*Conn, error) {
+	l, err := listen(ifi, socketType, protocol, protocols, cfg)
 	if err != nil {
 		return nil, opError(opListen, err, &Addr{HardwareAddr: ifi.HardwareAddr})
 	}
 
+	if cfg != nil && cfg.MaxReadRate > 0 {
+		l.limiter = newRateLimiter(cfg.MaxReadRate, time.Now)
+		l.limiterDrop = cfg.MaxReadRateDrop
+	}
+
+	if cfg != nil && cfg.MaxPackets > 0 {
+		l.maxPackets = int64(cfg.MaxPackets)
+	}
+
+	if cfg != nil && cfg.IdleTimeout > 0 {
+		l.idleTimeout = cfg.IdleTimeout
+		l.idleTimer = time.AfterFunc(cfg.IdleTimeout, func() {
+			l.idleExpired.Store(true)
+			_ = l.Close()
+		})
+	}
+
 	return l, nil
 }
 
+// ValidateConfig reports whether Listen would accept the given socket type,
+// protocol, and Config, without opening a socket. This allows programs which
+// lack the privileges required by Listen to check their configuration in
+// advance. ValidateConfig returns the first error which Listen would return
+// for the arguments, or an error if packet sockets are not supported on this
+// platform.
+//
+// Because no network interface is specified, ValidateConfig assumes that the
+// interface has an Ethernet address. Listen may still fail for reasons which
+// depend on the interface, the running kernel, or the caller's privileges.
+func ValidateConfig(socketType Type, protocol int, cfg *Config) error {
+	return validateConfig(socketType, protocol, cfg)
+}
+
+// CheckCapabilities reports whether the calling thread has the effective
+// capabilities required to open packet sockets with Listen, so that programs
+// can print a helpful message before attempting to do so. If the CAP_NET_RAW
+// capability is missing, CheckCapabilities returns a descriptive error which
+// is compatible with errors.Is(err, os.ErrPermission).
+//
+// Some operations additionally require the CAP_NET_ADMIN capability, such as
+// SetInterfacePromiscuous, InsertFlowRule, and increasing SetBusyPoll.
+// CheckCapabilities does not require CAP_NET_ADMIN, but mentions it in its
+// error if it is also missing.
+func CheckCapabilities() error { return checkCapabilities() }
+
+// ListenAll opens a packet sockets connection which is not bound to a specific
+// network interface, and therefore receives frames from all interfaces. The
+// parameters have the same meaning as those of Listen.
+//
+// Each Addr returned by a read reports the index of the interface which
+// received the frame in Addr.Index, and each write must specify the index of
+// the interface which will transmit the frame in Addr.Index. This allows a
+// single Conn to forward frames between interfaces, as a userspace bridge
+// does: read a frame, choose an egress interface other than the ingress
+// interface reported in Addr.Index, and write the frame with that Addr.Index.
+// Frames written by the Conn are also received by it as outgoing frames on
+// the egress interface, so a forwarder should use Config.Direction to ignore
+// them.
+//
+// Frames from every interface are read into the same buffers, which must
+// therefore be large enough for the interface with the largest MTU. See
+// Conn.InterfaceMTU for details.
+//
+// Methods which apply to a single network interface, such as SetPromiscuous,
+// return an error for Conns created by ListenAll.
+func ListenAll(socketType Type, protocol int, cfg *Config) (*Conn, error) {
+	// Index 0 binds to all interfaces.
+	return Listen(&net.Interface{}, socketType, protocol, cfg)
+}
+
+// ListenProtocols opens a packet sockets connection on the specified
+// interface which receives only frames carrying any of the specified
+// protocols, such as EtherType values. The remaining parameters have the same
+// meaning as those of Listen.
+//
+// A packet socket can only be bound to a single protocol, so ListenProtocols
+// binds the socket to all protocols (ETH_P_ALL) and attaches a BPF filter
+// which rejects frames carrying other protocols. For Raw Conns, the filter
+// matches the EtherType in each frame's Ethernet header. Datagram Conns
+// receive no header, so the filter matches the protocol reported by the
+// kernel, which for outgoing frames is the protocol of the sending socket.
+//
+// As with Listen, the filter is attached before the socket is bound so that
+// no other frames are captured. The filter precedes any filter set by
+// Config.Filter or Conn.SetBPF, so the Conn never receives other protocols.
+// Because the socket is bound to ETH_P_ALL, the Conn also receives outgoing
+// frames for the protocols unless Config.Direction is set to DirectionIn.
+//
+// Frames written to the Conn are sent with the first of protocols, as if the
+// Conn was bound to that protocol by Listen.
+func ListenProtocols(ifi *net.Interface, socketType Type, protocols []int, cfg *Config) (*Conn, error) {
+	if len(protocols) == 0 {
+		return nil, opError(opListen, errors.New("packet: at least one protocol is required"),
+			&Addr{HardwareAddr: ifi.HardwareAddr})
+	}
+
+	c, err := listenProtocols(ifi, socketType, ethPAll, protocols, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The filter has already validated the protocols.
+	c.protocol, _ = htons(protocols[0])
+	return c, nil
+}
+
+// ethPAll is the value of ETH_P_ALL, which binds a packet socket to all
+// protocols.
+const ethPAll = 0x0003
+
+// ListenForIP opens a packet sockets connection on the network interface which
+// is assigned ip, or failing that, on the first network interface which is
+// assigned a subnet containing ip. The remaining parameters have the same
+// meaning as those of Listen.
+//
+// ListenForIP does not consult the routing table, so ip must be local to one
+// of the machine's directly connected networks. If no interface matches ip,
+// an error is returned.
+func ListenForIP(ip net.IP, socketType Type, protocol int, cfg *Config) (*Conn, error) {
+	ifi, err := interfaceForIP(ip)
+	if err != nil {
+		return nil, opError(opListen, err, nil)
+	}
+
+	return Listen(ifi, socketType, protocol, cfg)
+}
+
 // TODO(mdlayher): we want to support FileConn for advanced use cases, but this
 // library would also need a big endian protocol value and an interface index.
 // For now we won't bother, but reconsider in the future.
@@ -79,78 +440,1302 @@ var (
 // A Conn is an Linux packet sockets (AF_PACKET) implementation of a
 // net.PacketConn.
 type Conn struct {
-	c *conn
+	c conn
+
+	// Number of open Conns sharing c, and whether this Conn is closed.
+	refs   *atomic.Int32
+	closed atomic.Bool
+
+	// Optional rtnetlink monitor for interface removal.
+	monitor *linkMonitor
+
+	// Deadlines, memberships, and pause state of the socket shared by c and
+	// any Conns created by Ref.
+	deadlines   *deadlines
+	memberships *membershipSet
+	paused      *pauseState
 
 	// Metadata about the local connection.
+	typ      Type
 	addr     *Addr
 	ifIndex  int
 	protocol uint16
+	vnetHdr  bool
+	auxdata  bool
+	pool     BufferPool
+
+	// Totals accumulated by Stats, if Config.CumulativeStats is set.
+	statsTotal *cumulativeStats
+
+	// Userspace read rate limiting, if configured.
+	limiter     *rateLimiter
+	limiterDrop bool
+
+	// The maximum number of frames to read, and the number read so far.
+	maxPackets int64
+	packets    atomic.Int64
+
+	// Buffer installed by SwapReadBuffer for the next read.
+	swapMu  sync.Mutex
+	swapBuf []byte
+
+	// Buffer used by Probe when the Conn has no BufferPool.
+	probeMu  sync.Mutex
+	probeBuf []byte
+
+	// Whether the kernel delivers PACKET_AUXDATA, detected on the first read.
+	auxdataState atomic.Uint32
+
+	// BPF instructions which must precede any filter set on the Conn.
+	filterPrefix []bpf.RawInstruction
+
+	// Cached network interface names for InterfaceName.
+	names nameCache
+
+	// Socket options which are enabled on first use.
+	txtimeOnce sync.Once
+	txtimeErr  error
+
+	// Optional BPF program which must accept frames before they are written.
+	writeFilter atomic.Pointer[bpf.VM]
+
+	// Whether written frames must carry the interface's source MAC address.
+	strictSourceMAC bool
+
+	// Whether the Conn joined a fanout group when it was opened.
+	fanout bool
+
+	// Whether socket options which Pool.Put cannot restore were set.
+	sockoptsChanged atomic.Bool
+
+	// Frame buffered by WriteTo between WriteCork and WriteUncork.
+	corkMu   sync.Mutex
+	corked   bool
+	corkBuf  []byte
+	corkAddr net.Addr
+
+	// Optional timer which closes the Conn when no frames are read.
+	idleTimer   *time.Timer
+	idleTimeout time.Duration
+	idleExpired atomic.Bool
 }
 
 // Close closes the connection.
+//
+// If the Conn shares its socket with other Conns created by Ref, the socket is
+// only closed when the last of those Conns is closed.
+//
+// When the socket is closed, Close drops each membership added by the Conn,
+// such as by SetPromiscuous or SetAllMulticast, even if a duplicate of the
+// socket's file descriptor remains open. Because the kernel reference counts
+// memberships separately from the interface flags set by administrators or by
+// SetInterfacePromiscuous, this restores the interface to the state it had
+// before the Conn modified it: a flag set externally remains set, and
+// memberships held by other sockets are unaffected. Changes made by
+// SetInterfacePromiscuous are not undone.
 func (c *Conn) Close() error {
-	return c.opError(opClose, c.c.Close())
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+
+	if c.refs != nil {
+		if !c.closed.CompareAndSwap(false, true) {
+			return c.opError(opClose, net.ErrClosed)
+		}
+		if c.refs.Add(-1) > 0 {
+			// Other Conns still use the socket.
+			return nil
+		}
+	}
+
+	return c.opError(opClose, c.close())
+}
+
+// Ref returns a new Conn which shares the socket of c, and increments a
+// reference count shared by both Conns. Closing either Conn decrements the
+// count, and the socket is closed when the last Conn sharing it is closed.
+// Ref must not be called on a closed Conn.
+//
+// Conns which share a socket share all of its kernel state, including
+// deadlines, BPF filters, socket options, and queued frames: frames are
+// delivered to whichever Conn reads first. State kept by the Conn itself, such
+// as the filter set by SetWriteBPF, is not shared. Conns which share a socket
+// may be used concurrently.
+func (c *Conn) Ref() *Conn {
+	c.refs.Add(1)
+
+	r := &Conn{
+		c:    c.c,
+		refs: c.refs,
+
+		monitor:     c.monitor,
+		deadlines:   c.deadlines,
+		memberships: c.memberships,
+		paused:      c.paused,
+
+		typ:      c.typ,
+		addr:     c.addr,
+		ifIndex:  c.ifIndex,
+		protocol: c.protocol,
+		vnetHdr:  c.vnetHdr,
+		auxdata:  c.auxdata,
+		pool:     c.pool,
+
+		strictSourceMAC: c.strictSourceMAC,
+		fanout:          c.fanout,
+
+		statsTotal:  c.statsTotal,
+		limiter:     c.limiter,
+		limiterDrop: c.limiterDrop,
+		maxPackets:  c.maxPackets,
+
+		filterPrefix: c.filterPrefix,
+	}
+	r.auxdataState.Store(c.auxdataState.Load())
+
+	return r
 }
 
-// LocalAddr returns the local network address. The Addr returned is shared by
-// all invocations of LocalAddr, so do not modify it.
+// WillEgressInterface reports the index of the network interface from which
+// frames written to the Conn without an Addr.Index will be transmitted, as
+// reported by the kernel for the Conn's socket.
+//
+// Packet sockets bypass routing entirely: the kernel hands each frame written
+// to the Conn directly to the queueing discipline and driver of the interface
+// specified by Addr.Index or, if Addr.Index is zero, of the interface to which
+// the Conn is bound. The kernel never chooses a different egress interface,
+// although traffic control rules or upper devices configured on the
+// interface itself (such as a tc mirred redirect) may still forward frames
+// elsewhere.
+//
+// Conns created by ListenAll are not bound to an interface, so every write
+// must set Addr.Index. For those Conns, WillEgressInterface returns an error
+// compatible with errors.Is(err, syscall.ENXIO).
+func (c *Conn) WillEgressInterface() (int, error) { return c.willEgressInterface() }
+
+// Sockname queries the kernel for the Conn's current binding using
+// getsockname(2), and returns it as an Addr whose Index, Protocol, and
+// HardwareType fields are populated. Unlike LocalAddr, which reports the
+// hardware address at the time the Conn was created, Sockname always reflects
+// the current state of the socket.
+func (c *Conn) Sockname() (*Addr, error) { return c.sockname() }
+
+// LocalAddr returns the local network address. The Addr's Index field reports
+// the index of the network interface to which the Conn is bound, or zero for
+// Conns created by ListenAll. The Addr returned is shared by all invocations of
+// LocalAddr, so do not modify it.
 func (c *Conn) LocalAddr() net.Addr { return c.addr }
 
+// IsBoundToInterface reports whether the Conn is bound to a single network
+// interface. It reports false for Conns created by ListenAll, which receive
+// frames from all interfaces and must specify Addr.Index for each write.
+func (c *Conn) IsBoundToInterface() bool { return c.ifIndex != 0 }
+
+// String returns a description of the Conn's local address, including the
+// network interface to which it is bound, or that it is bound to all
+// interfaces.
+func (c *Conn) String() string {
+	switch {
+	case !c.IsBoundToInterface():
+		return "packet: all interfaces"
+	case len(c.addr.HardwareAddr) == 0:
+		return fmt.Sprintf("packet: interface %d", c.ifIndex)
+	default:
+		return fmt.Sprintf("packet: interface %d (%s)", c.ifIndex, c.addr.HardwareAddr)
+	}
+}
+
+// HardwareAddr returns the hardware address of the network interface to which
+// the Conn is bound, as reported by LocalAddr. The net.HardwareAddr returned is
+// shared by all invocations of HardwareAddr and LocalAddr, so do not modify it.
+func (c *Conn) HardwareAddr() net.HardwareAddr { return c.addr.HardwareAddr }
+
 // ReadFrom implements the net.PacketConn ReadFrom method.
+//
+// If the Conn's Config sets MaxReadRate or MaxPackets, ReadFrom limits the
+// frames it returns as described by those fields.
+//
+// ReadFrom never returns an empty frame without an error when len(b) is
+// non-zero: frames with no contents, such as Datagram frames which consist
+// only of a link layer header, are discarded while ReadFrom waits for the next
+// frame or for the read deadline to expire. ReadFromBy, ReadFromAuxdata,
+// ReadFromMetadata, SwapReadBuffer, and Stream discard empty frames in the
+// same way.
 func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
-	return c.readFrom(b)
+	return c.readFromWith(b, c.readFrom)
+}
+
+// ReadFromBy reads a frame like ReadFrom, but waits for a frame only until
+// deadline, without setting the Conn's read deadline. This allows several
+// goroutines which share a Conn to each bound their own reads. A zero deadline
+// means that the read does not time out.
+//
+// Any read deadline set by SetDeadline or SetReadDeadline still applies, so
+// ReadFromBy returns once the earlier of the two deadlines has expired, with
+// an error compatible with errors.Is(err, os.ErrDeadlineExceeded).
+//
+// ReadFromBy waits for frames on a thread of its own rather than using the Go
+// runtime network poller, so it is better suited to occasional reads, such as
+// those of request/response protocols, than to sustained capture.
+func (c *Conn) ReadFromBy(b []byte, deadline time.Time) (int, net.Addr, error) {
+	return c.readFromWith(b, func(b []byte) (int, net.Addr, error) {
+		return c.readFromBy(b, deadline)
+	})
+}
+
+// readFromWith implements ReadFrom using read, enforcing the Conn's
+// MaxPackets.
+func (c *Conn) readFromWith(b []byte, read func(b []byte) (int, net.Addr, error)) (int, net.Addr, error) {
+	if c.maxPackets > 0 && c.packets.Add(1) > c.maxPackets {
+		return 0, nil, c.opError(opRead, ErrCaptureComplete)
+	}
+
+	n, addr, err := c.readFromLimited(b, read)
+	if err != nil && c.maxPackets > 0 {
+		// No frame was read, so don't count this read.
+		c.packets.Add(-1)
+	}
+
+	return n, addr, err
+}
+
+// readFromLimited reads a frame using read, enforcing the Conn's MaxReadRate.
+func (c *Conn) readFromLimited(b []byte, read func(b []byte) (int, net.Addr, error)) (int, net.Addr, error) {
+	for {
+		n, addr, err := read(b)
+		if err != nil || c.limiter == nil {
+			return n, addr, c.idleRead(err)
+		}
+
+		if c.limiterDrop {
+			if !c.limiter.allow() {
+				// Discard this frame and read the next.
+				continue
+			}
+		} else if d := c.limiter.reserve(); d > 0 {
+			time.Sleep(d)
+		}
+
+		return n, addr, c.idleRead(nil)
+	}
+}
+
+// SwapReadBuffer supports double-buffering by transferring ownership of read
+// buffers between the caller and the Conn. SwapReadBuffer reads the next frame
+// into the buffer installed by the previous call, installs b in its place, and
+// returns the filled buffer along with the length of the frame it contains.
+//
+// The first call on a Conn only installs b, and returns a nil buffer without
+// reading. If a read fails, b is not installed and the previous buffer remains
+// installed for the next call, so that no frame is lost: frames which arrive
+// between calls are queued by the kernel until the next read.
+//
+// Once SwapReadBuffer returns a buffer, the Conn no longer uses it and the
+// caller may process it concurrently with further calls. The Conn owns b from
+// the time it is passed until it is returned by a later call, so the caller
+// must not access b in the meantime. Concurrent calls to SwapReadBuffer are
+// serialized.
+func (c *Conn) SwapReadBuffer(b []byte) (old []byte, n int, err error) {
+	c.swapMu.Lock()
+	defer c.swapMu.Unlock()
+
+	if c.swapBuf == nil {
+		c.swapBuf = b
+		return nil, 0, nil
+	}
+
+	n, _, err = c.ReadFrom(c.swapBuf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	old, c.swapBuf = c.swapBuf, b
+	return old, n, nil
+}
+
+// ReadFromVnetHdr reads a frame and the virtio_net_hdr which precedes it. The
+// Conn must have been created with Config.VnetHdr set.
+func (c *Conn) ReadFromVnetHdr(b []byte) (int, *VnetHdr, net.Addr, error) {
+	n, vh, addr, err := c.readFromVnetHdr(b)
+	return n, vh, addr, c.idleRead(err)
+}
+
+// ReadFromAuxdata reads a frame and the Auxdata which the kernel attached to
+// it. The Conn must have been created with Config.Auxdata set. If the kernel
+// did not attach Auxdata to the frame, zero-valued Auxdata is returned. Empty
+// frames are discarded as described by ReadFrom.
+func (c *Conn) ReadFromAuxdata(b []byte) (int, *Auxdata, net.Addr, error) {
+	n, a, addr, err := c.readFromAuxdata(b)
+	return n, a, addr, c.idleRead(err)
+}
+
+// RecvMeta contains the metadata for a frame read by Conn.ReadFromMetadata.
+// Fields which are unavailable for a frame are left zero.
+type RecvMeta struct {
+	// Addr is the source address of the frame. It also reports the frame's
+	// packet type, hardware type, protocol, and the index of the network
+	// interface which received or transmitted it.
+	Addr *Addr
+
+	// Timestamp is the time at which recvmsg(2) returned the frame to the
+	// Conn, as reported by time.Now. It is not the time at which the frame
+	// arrived at the network interface: kernel receive timestamps such as
+	// SO_TIMESTAMPING are not supported, so Timestamp includes any time the
+	// frame spent queued on the socket.
+	Timestamp time.Time
+
+	// Truncated reports whether the frame was larger than the buffer passed
+	// to ReadFromMetadata, in which case the remainder was discarded.
+	Truncated bool
+
+	// Auxdata contains the frame's original length, VLAN tag, and checksum
+	// status, as described by Config.Auxdata. It is nil unless the Conn was
+	// created with Config.Auxdata set and the kernel attached Auxdata to the
+	// frame.
+	Auxdata *Auxdata
+
+	// VLANTags is the frame's stack of VLAN tags, ordered from outermost to
+	// innermost, as reconstructed by the VLANTags function from Auxdata and
+	// the frame. Datagram Conns receive no Ethernet header, so only the tag
+	// reported in Auxdata is available for their frames. A tag stripped by
+	// the network interface is only reported if Config.Auxdata is set.
+	VLANTags []VLANTag
+}
+
+// ReadFromMetadata reads a frame and returns all of the metadata which is
+// available for it, consolidating the metadata returned by ReadFrom and
+// ReadFromAuxdata. Empty frames are discarded as described by ReadFrom.
+func (c *Conn) ReadFromMetadata(b []byte) (int, *RecvMeta, error) {
+	n, m, err := c.readFromMetadata(b)
+	return n, m, c.idleRead(err)
+}
+
+// Possible Conn.auxdataState values.
+const (
+	auxdataUnknown uint32 = iota
+	auxdataDelivered
+	auxdataUnavailable
+)
+
+// AuxdataDelivered reports whether the kernel attached PACKET_AUXDATA metadata
+// to the first frame read by ReadFromAuxdata. It returns false if no frame has
+// been read yet, or if the kernel does not support PACKET_AUXDATA.
+func (c *Conn) AuxdataDelivered() bool {
+	return c.auxdataState.Load() == auxdataDelivered
+}
+
+// ReadErrQueue reads a message from the socket's error queue, which is used by
+// the Linux kernel to report transmit timestamps and other errors related to
+// frames written to the Conn. It returns the number of bytes of the original
+// frame copied into b, the Addr associated with the message, if any, and the
+// SockExtendedErr which describes it.
+//
+// ReadErrQueue does not block or observe deadlines: if the error queue is
+// empty, it returns an error compatible with errors.Is(err, syscall.EAGAIN).
+// ReadErrQueue is only supported on Linux.
+func (c *Conn) ReadErrQueue(b []byte) (int, net.Addr, *SockExtendedErr, error) {
+	return c.readErrQueue(b)
+}
+
+// idleRead resets the idle timer after a successful read, or replaces err with
+// ErrIdleTimeout if the Conn was closed by the idle timer.
+func (c *Conn) idleRead(err error) error {
+	switch {
+	case c.idleTimer == nil:
+		return err
+	case err == nil:
+		c.idleTimer.Reset(c.idleTimeout)
+		return nil
+	case c.idleExpired.Load():
+		return c.opError(opRead, ErrIdleTimeout)
+	default:
+		return err
+	}
 }
 
 // WriteTo implements the net.PacketConn WriteTo method.
 func (c *Conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.corkMu.Lock()
+	if c.corked {
+		defer c.corkMu.Unlock()
+
+		if err := c.checkCorkLen(len(c.corkBuf) + len(b)); err != nil {
+			return 0, err
+		}
+
+		if c.corkAddr == nil {
+			c.corkAddr = addr
+		}
+		c.corkBuf = append(c.corkBuf, b...)
+		return len(b), nil
+	}
+	c.corkMu.Unlock()
+
+	if err := c.checkWriteFilter(b); err != nil {
+		return 0, err
+	}
+	if err := c.checkSourceMAC(b, c.vnetHdr); err != nil {
+		return 0, err
+	}
+
 	return c.writeTo(b, addr)
 }
 
+// WriteFrame builds an Ethernet frame addressed to dst with the specified
+// EtherType and payload, and writes it to dst using WriteTo. The source address
+// of the frame is the Conn's own hardware address, as reported by LocalAddr.
+// WriteFrame returns the number of bytes written, including the Ethernet
+// header.
+//
+// WriteFrame is intended for Raw Conns on Ethernet interfaces, for which the
+// caller would otherwise build the Ethernet header itself. It returns an error
+// if the Conn does not have an Ethernet hardware address, such as for Conns
+// created by ListenAll.
+func (c *Conn) WriteFrame(dst net.HardwareAddr, etherType uint16, payload []byte) (int, error) {
+	src := c.addr.HardwareAddr
+	if len(src) != 6 || len(dst) != 6 {
+		return 0, c.opError(opWrite, errors.New("packet: WriteFrame requires Ethernet hardware addresses"))
+	}
+
+	b := make([]byte, 0, 6+6+2+len(payload))
+	b = append(b, dst...)
+	b = append(b, src...)
+	b = append(b, byte(etherType>>8), byte(etherType))
+	b = append(b, payload...)
+
+	return c.WriteTo(b, &Addr{HardwareAddr: dst})
+}
+
+// Probe measures the round trip time to a peer which echoes frames. Probe
+// writes b to dst, and then reads frames until match reports true for a frame
+// or the timeout expires, returning the time elapsed between the write and
+// the read of the matching frame.
+//
+// Frames transmitted by the local machine, including b itself if the Conn
+// captures outgoing frames, are never passed to match. Frames for which match
+// reports false are discarded, so Probe consumes frames which would otherwise
+// be returned by ReadFrom or delivered by Stream, and should not be used while
+// the Conn is read elsewhere.
+//
+// Probe measures time using only the monotonic clock around the write and read
+// system calls, not kernel timestamps such as SO_TIMESTAMPING, so the result
+// includes scheduling delays in addition to the time spent on the network.
+//
+// Probe reads frames into a buffer from Config.BufferPool if one is set, or
+// otherwise into a buffer owned by the Conn, in which case concurrent calls to
+// Probe are serialized.
+//
+// Probe sets the Conn's read deadline to enforce the timeout, and restores the
+// previous read deadline before returning. If the timeout expires, Probe
+// returns an error compatible with errors.Is(err, os.ErrDeadlineExceeded).
+func (c *Conn) Probe(b []byte, dst *Addr, match func(frame []byte) bool, timeout time.Duration) (time.Duration, error) {
+	var buf []byte
+	if c.pool != nil {
+		buf = c.pool.Get()
+		defer c.pool.Put(buf)
+	} else {
+		c.probeMu.Lock()
+		defer c.probeMu.Unlock()
+
+		if c.probeBuf == nil {
+			c.probeBuf = make([]byte, streamReadSize)
+		}
+		buf = c.probeBuf
+	}
+
+	prev := c.ReadDeadline()
+	if err := c.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+	defer func() { _ = c.SetReadDeadline(prev) }()
+
+	start := time.Now()
+	if _, err := c.WriteTo(b, dst); err != nil {
+		return 0, err
+	}
+
+	for {
+		n, addr, err := c.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+
+		if a, ok := addr.(*Addr); ok && a.PacketType == PacketOutgoing {
+			continue
+		}
+		if match(buf[:n]) {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// WriteCork corks the Conn so that subsequent calls to WriteTo append to a
+// single frame rather than each writing a frame. The frame is written when
+// WriteUncork is called, to the address passed to the first call to WriteTo
+// after WriteCork. Calling WriteCork on a corked Conn has no effect.
+//
+// The frame may not exceed the network interface's MTU, plus the length of
+// the Ethernet header for Raw Conns. A call to WriteTo which would exceed it
+// appends nothing and returns an error compatible with
+// errors.Is(err, syscall.EMSGSIZE).
+//
+// This is similar to the MSG_MORE flag and the TCP_CORK socket option on
+// other socket types. Linux packet sockets do not coalesce writes which use
+// MSG_MORE, so the frame is buffered by the Conn instead.
+func (c *Conn) WriteCork() {
+	c.corkMu.Lock()
+	defer c.corkMu.Unlock()
+
+	c.corked = true
+}
+
+// WriteUncork uncorks the Conn and writes the frame built by calls to WriteTo
+// since WriteCork was called, returning the number of bytes written. If no
+// bytes were written while the Conn was corked, no frame is written.
+func (c *Conn) WriteUncork() (int, error) {
+	c.corkMu.Lock()
+	b, addr := c.corkBuf, c.corkAddr
+	c.corked, c.corkBuf, c.corkAddr = false, nil, nil
+	c.corkMu.Unlock()
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	// Don't call WriteTo, which would buffer the frame again if another
+	// goroutine corked the Conn in the meantime.
+	if err := c.checkWriteFilter(b); err != nil {
+		return 0, err
+	}
+	if err := c.checkSourceMAC(b, c.vnetHdr); err != nil {
+		return 0, err
+	}
+
+	return c.writeTo(b, addr)
+}
+
+// checkCorkLen returns an error if a corked frame of n bytes would exceed the
+// Conn's network interface MTU. Conns which are not bound to a single
+// interface have no limit.
+func (c *Conn) checkCorkLen(n int) error {
+	if c.ifIndex == 0 {
+		return nil
+	}
+
+	mtu, err := c.names.lookupMTU(c.ifIndex)
+	if err != nil {
+		return c.opError(opWrite, err)
+	}
+
+	// Raw frames carry an Ethernet header which the MTU does not account for.
+	const ethernetHeaderLen = 14
+
+	max := mtu
+	if c.typ == Raw {
+		max += ethernetHeaderLen
+	}
+	if c.vnetHdr {
+		max += vnetHdrLen
+	}
+
+	if n > max {
+		return c.opError(opWrite, os.NewSyscallError("sendto", syscall.EMSGSIZE))
+	}
+
+	return nil
+}
+
+// WriteToFlags writes a frame like WriteTo, passing flags to the underlying
+// send system call. flags is a bitmask of MSG_* constants for the current
+// platform, such as those in golang.org/x/sys/unix.
+//
+// On Linux, packet sockets accept MSG_DONTWAIT, MSG_CONFIRM, and MSG_NOSIGNAL.
+// With MSG_DONTWAIT, the write does not wait for space in the socket's send
+// buffer and instead returns an error compatible with
+// errors.Is(err, syscall.EAGAIN), ignoring any write deadline.
+//
+// Sends which are interrupted by a signal are retried rather than returning
+// EINTR, with or without MSG_DONTWAIT.
+func (c *Conn) WriteToFlags(b []byte, addr net.Addr, flags int) (int, error) {
+	if err := c.checkWriteFilter(b); err != nil {
+		return 0, err
+	}
+	if err := c.checkSourceMAC(b, c.vnetHdr); err != nil {
+		return 0, err
+	}
+
+	return c.writeToFlags(b, addr, flags)
+}
+
+// WriteToAt writes a frame which the Linux kernel will transmit at the
+// specified time, using the SO_TXTIME socket option and SCM_TXTIME control
+// messages. SO_TXTIME is enabled on the Conn on the first call to WriteToAt.
+//
+// The transmit time is interpreted against CLOCK_TAI, which differs from the
+// UTC time reported by package time by the current TAI-UTC offset (37 seconds
+// as of 2017), so callers must apply that offset to when. Transmit time
+// scheduling requires the network interface to be configured with a qdisc
+// which honors SO_TXTIME, such as ETF, and possibly hardware support for
+// launch time offload. Other qdiscs transmit the frame immediately.
+func (c *Conn) WriteToAt(b []byte, addr net.Addr, when time.Time) (int, error) {
+	if err := c.checkWriteFilter(b); err != nil {
+		return 0, err
+	}
+	if err := c.checkSourceMAC(b, c.vnetHdr); err != nil {
+		return 0, err
+	}
+
+	return c.writeToAt(b, addr, when)
+}
+
+// WriteToVnetHdr writes a frame preceded by the virtio_net_hdr vh. The Conn
+// must have been created with Config.VnetHdr set.
+func (c *Conn) WriteToVnetHdr(b []byte, vh *VnetHdr, addr net.Addr) (int, error) {
+	if err := c.checkWriteFilter(b); err != nil {
+		return 0, err
+	}
+	if err := c.checkSourceMAC(b, false); err != nil {
+		return 0, err
+	}
+
+	return c.writeToVnetHdr(b, vh, addr)
+}
+
+// checkSourceMAC enforces Config.StrictSourceMAC for the frame b, which begins
+// with a raw virtio_net_hdr if vnetHdr is true.
+func (c *Conn) checkSourceMAC(b []byte, vnetHdr bool) error {
+	if !c.strictSourceMAC {
+		return nil
+	}
+
+	off := 0
+	if vnetHdr {
+		off = vnetHdrLen
+	}
+
+	// Frames which are too short to carry a source address cannot match.
+	if len(b) < off+12 || !bytes.Equal(b[off+6:off+12], c.addr.HardwareAddr) {
+		return c.opError(opWrite, ErrSourceMACMismatch)
+	}
+
+	return nil
+}
+
+// checkWriteFilter runs the write filter set by SetWriteBPF, if any, against
+// the frame b.
+func (c *Conn) checkWriteFilter(b []byte) error {
+	vm := c.writeFilter.Load()
+	if vm == nil {
+		return nil
+	}
+
+	// Out of bounds loads cause the VM to reject the frame, so the error can
+	// be ignored.
+	if n, _ := vm.Run(b); n == 0 {
+		return c.opError(opWrite, os.NewSyscallError("sendto", syscall.EPERM))
+	}
+
+	return nil
+}
+
 // SetDeadline implements the net.PacketConn SetDeadline method.
 func (c *Conn) SetDeadline(t time.Time) error {
-	return c.opError(opSet, c.c.SetDeadline(t))
+	if err := c.c.SetDeadline(t); err != nil {
+		return c.opError(opSet, err)
+	}
+
+	c.deadlines.set(&t, &t)
+	return nil
 }
 
 // SetReadDeadline implements the net.PacketConn SetReadDeadline method.
 func (c *Conn) SetReadDeadline(t time.Time) error {
-	return c.opError(opSet, c.c.SetReadDeadline(t))
+	if err := c.c.SetReadDeadline(t); err != nil {
+		return c.opError(opSet, err)
+	}
+
+	c.deadlines.set(&t, nil)
+	return nil
 }
 
 // SetWriteDeadline implements the net.PacketConn SetWriteDeadline method.
 func (c *Conn) SetWriteDeadline(t time.Time) error {
-	return c.opError(opSet, c.c.SetWriteDeadline(t))
+	if err := c.c.SetWriteDeadline(t); err != nil {
+		return c.opError(opSet, err)
+	}
+
+	c.deadlines.set(nil, &t)
+	return nil
+}
+
+// ReadDeadline returns the read deadline most recently set on the Conn by
+// SetDeadline or SetReadDeadline, or the zero time.Time if no read deadline
+// is set. Conns created by Ref share their deadlines.
+//
+// ReadDeadline is useful to restore a deadline after temporarily overriding
+// it.
+func (c *Conn) ReadDeadline() time.Time {
+	read, _ := c.deadlines.get()
+	return read
+}
+
+// WriteDeadline returns the write deadline most recently set on the Conn by
+// SetDeadline or SetWriteDeadline, or the zero time.Time if no write deadline
+// is set. Conns created by Ref share their deadlines.
+func (c *Conn) WriteDeadline() time.Time {
+	_, write := c.deadlines.get()
+	return write
+}
+
+// deadlines records the deadlines set on a socket, which the socket itself
+// cannot report.
+type deadlines struct {
+	mu          sync.Mutex
+	read, write time.Time
+}
+
+// set updates the read and/or write deadlines if non-nil.
+func (d *deadlines) set(read, write *time.Time) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if read != nil {
+		d.read = *read
+	}
+	if write != nil {
+		d.write = *write
+	}
+}
+
+// get returns the read and write deadlines.
+func (d *deadlines) get() (read, write time.Time) {
+	if d == nil {
+		return time.Time{}, time.Time{}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.read, d.write
 }
 
 // SetBPF attaches an assembled BPF program to the Conn.
+//
+// If the Conn's Config requires a BPF filter of its own, such as when
+// Config.LocalOnly is set or Config.Direction is set to DirectionOut, that
+// filter is applied before the input program.
+//
+// If the complete program exceeds the kernel's length limit, SetBPF returns an
+// error compatible with errors.Is(err, ErrFilterTooLong). SetBPF returns an
+// error if the Conn is paused.
 func (c *Conn) SetBPF(filter []bpf.RawInstruction) error {
-	return c.opError(opSetsockopt, c.c.SetBPF(filter))
+	filter = composeFilter(c.filterPrefix, filter)
+	if err := checkFilterLen(filter); err != nil {
+		return c.opError(opSetsockopt, err)
+	}
+
+	return c.changeFilter(false, func() error {
+		return c.opError(opSetsockopt, c.c.SetBPF(filter))
+	})
+}
+
+// SeteBPF attaches an extended BPF (eBPF) program to the Conn using the
+// SO_ATTACH_BPF socket option. progFD must be the file descriptor of an eBPF
+// program of type BPF_PROG_TYPE_SOCKET_FILTER which has already been loaded
+// into the kernel, such as by using github.com/cilium/ebpf. The Conn does not
+// take ownership of progFD, which may be closed once SeteBPF returns.
+//
+// Unlike the classic BPF programs attached by SetBPF, eBPF programs may use
+// maps, helper functions, and a much larger instruction set, but loading them
+// generally requires the CAP_BPF or CAP_SYS_ADMIN capability. A socket has
+// at most one filter, so SeteBPF replaces any classic BPF program attached to
+// the Conn, including filters required by the Conn's Config such as those for
+// Config.LocalOnly or DirectionOut. The eBPF program must implement that
+// filtering itself if it is required.
+//
+// SeteBPF returns an error if the Conn is paused, and a Conn with an eBPF
+// program attached cannot be paused.
+func (c *Conn) SeteBPF(progFD int) error { return c.seteBPF(progFD) }
+
+// RemoveeBPF removes an eBPF program attached to the Conn by SeteBPF. It
+// returns an error if the Conn is paused.
+func (c *Conn) RemoveeBPF() error { return c.removeeBPF() }
+
+// Filter returns the BPF program which is attached to the Conn, or nil if no
+// program is attached. On Linux, the program is retrieved from the kernel using
+// the SO_GET_FILTER socket option.
+//
+// The program is returned exactly as it is attached to the socket. If the
+// Conn's Config requires a BPF filter of its own, such as when
+// Config.LocalOnly is set, those instructions precede the program set by the
+// caller.
+func (c *Conn) Filter() ([]bpf.RawInstruction, error) { return c.filter() }
+
+// Drain discards all frames which are queued on the Conn without blocking, and
+// returns the number of frames discarded. Frames which arrive while Drain is
+// running may also be discarded.
+func (c *Conn) Drain() (int, error) { return c.drain() }
+
+// ReplaceFilter replaces the Conn's BPF filter with filter, and guarantees that
+// no frames which were accepted by the previous filter but are not accepted by
+// filter will be read from the Conn after ReplaceFilter returns. A nil or empty
+// filter removes the Conn's filter so that all frames are accepted.
+//
+// ReplaceFilter uses the same technique as libpcap: it first attaches a filter
+// which rejects all frames, then discards all frames queued on the Conn, and
+// finally attaches filter. As a result, queued frames which are accepted by
+// both filters are also discarded, as are frames which arrive while the
+// filter is being replaced. Any concurrent reads may observe the discarded
+// frames before ReplaceFilter returns.
+//
+// ReplaceFilter returns an error if the Conn is paused.
+func (c *Conn) ReplaceFilter(filter []bpf.RawInstruction) error {
+	return c.changeFilter(false, func() error { return c.replaceFilter(filter) })
+}
+
+// Pause suspends capture on the Conn without closing its socket, so that
+// capture can later be resumed by Resume. Pause attaches a BPF filter which
+// rejects all frames, and then discards any frames which were already queued
+// on the Conn. While the Conn is paused, the kernel drops all frames destined
+// for it without counting them in Stats, and reads block until their deadline
+// expires or capture is resumed. Pause has no effect on a paused Conn.
+//
+// The filter attached to the Conn when Pause is called, as reported by
+// Filter, is restored by Resume. The kernel cannot report eBPF programs, so
+// Pause returns an error if a program attached by SeteBPF is the Conn's
+// filter. While the Conn is paused, SetBPF, SeteBPF, RemoveeBPF, and
+// ReplaceFilter return an error. Writes are not affected.
+func (c *Conn) Pause() error { return c.pause() }
+
+// Resume resumes capture on a Conn suspended by Pause, restoring the filter
+// which was attached when Pause was called. Frames which arrived while the
+// Conn was paused are not delivered. Resume has no effect on a Conn which is
+// not paused.
+func (c *Conn) Resume() error { return c.resume() }
+
+// pauseState tracks whether a socket's capture is suspended by Conn.Pause,
+// and the filter to restore when it is resumed. It also records whether the
+// socket's filter is an eBPF program, which Pause cannot restore.
+type pauseState struct {
+	mu     sync.Mutex
+	paused bool
+	filter []bpf.RawInstruction
+	ebpf   bool
+}
+
+// errPaused is returned when changing the filter of a paused Conn.
+var errPaused = errors.New("packet: cannot change the filter of a paused Conn")
+
+// changeFilter calls set to change the socket's filter unless the Conn is
+// paused, and records whether the new filter is an eBPF program.
+func (c *Conn) changeFilter(ebpf bool, set func() error) error {
+	c.paused.mu.Lock()
+	defer c.paused.mu.Unlock()
+
+	if c.paused.paused {
+		return c.opError(opSetsockopt, errPaused)
+	}
+	if err := set(); err != nil {
+		return err
+	}
+
+	c.paused.ebpf = ebpf
+	return nil
+}
+
+// SetWriteBPF sets an assembled BPF program which must accept each frame written
+// to the Conn, similar to the BIOCSETWF ioctl on BSD systems. Frames which the
+// program rejects by returning zero are not written, and the write returns an
+// error compatible with syscall.EPERM. A nil or empty filter removes any
+// existing write filter.
+//
+// The Linux kernel has no equivalent facility, so the program is run in
+// userspace before each write using golang.org/x/net/bpf.VM, and it cannot use
+// BPF extensions. The program is applied to the bytes passed to the write
+// methods: for Datagram Conns, these do not include a link-layer header.
+func (c *Conn) SetWriteBPF(filter []bpf.RawInstruction) error {
+	if len(filter) == 0 {
+		c.writeFilter.Store(nil)
+		return nil
+	}
+
+	insts, ok := bpf.Disassemble(filter)
+	if !ok {
+		return c.opError(opSet, errors.New("packet: write filter contains unsupported BPF instructions"))
+	}
+
+	vm, err := bpf.NewVM(insts)
+	if err != nil {
+		return c.opError(opSet, err)
+	}
+
+	c.writeFilter.Store(vm)
+	return nil
 }
 
 // SetPromiscuous enables or disables promiscuous mode on the Conn, allowing it
 // to receive traffic that is not addressed to the Conn's network interface.
+//
+// SetPromiscuous uses a PACKET_MR_PROMISC membership, which the Linux kernel
+// reference counts per interface: the interface remains promiscuous as long as
+// any socket holds such a membership or the interface's IFF_PROMISC flag is
+// set, and the membership is released when the Conn is closed. This makes
+// SetPromiscuous safe to use when multiple programs share an interface, and
+// it should be preferred over SetInterfacePromiscuous.
 func (c *Conn) SetPromiscuous(enable bool) error {
 	return c.setPromiscuous(enable)
 }
 
+// SetAllMulticast enables or disables all-multicast mode on the Conn, allowing
+// its network interface to receive frames sent to any multicast address.
+//
+// Unlike SetPromiscuous, all-multicast mode does not cause the interface to
+// receive unicast frames addressed to other machines, so it imposes far less
+// load on the machine when only multicast traffic is of interest. Like
+// SetPromiscuous, it uses a membership (PACKET_MR_ALLMULTI) which the kernel
+// reference counts per interface and releases when the Conn is closed.
+func (c *Conn) SetAllMulticast(enable bool) error { return c.setAllMulticast(enable) }
+
+// JoinGroup adds a PACKET_MR_MULTICAST membership so that the Conn's network
+// interface receives frames sent to the multicast MAC address addr. Like
+// SetPromiscuous, the kernel reference counts memberships and releases them
+// when the Conn is closed.
+func (c *Conn) JoinGroup(addr net.HardwareAddr) error { return c.joinGroup(addr) }
+
+// LeaveGroup drops a membership added by JoinGroup.
+func (c *Conn) LeaveGroup(addr net.HardwareAddr) error { return c.leaveGroup(addr) }
+
+// Memberships returns the link layer memberships which the Conn holds on its
+// network interface, as added by Config.Promiscuous, SetPromiscuous,
+// SetAllMulticast, and JoinGroup, in the order they were first added. The
+// kernel does not report the memberships of a socket, so they are tracked by
+// the Conn, and are shared with Conns created by Ref. A membership which was
+// added more than once is listed once, and remains until it has been dropped
+// the same number of times. Once the Conn's socket is closed, Memberships
+// returns no memberships.
+func (c *Conn) Memberships() ([]Membership, error) { return c.listMemberships() }
+
+// SetInterfacePromiscuous sets or clears the global IFF_PROMISC flag on the
+// Conn's network interface, as "ip link set promisc" does. This typically
+// requires elevated privileges (CAP_NET_ADMIN).
+//
+// Unlike SetPromiscuous, the flag is not reference counted and is not reset
+// when the Conn is closed. Disabling the flag affects every user of the
+// interface which relies on it, so most callers should use SetPromiscuous
+// instead.
+func (c *Conn) SetInterfacePromiscuous(enable bool) error {
+	return c.setInterfacePromiscuous(enable)
+}
+
+// SetNonblock sets or clears the O_NONBLOCK flag on the Conn's socket.
+//
+// A Conn's socket is non-blocking by default so that it can be integrated with
+// the Go runtime network poller, which is also what allows deadlines to
+// interrupt blocked calls. Clearing O_NONBLOCK causes reads and writes to block
+// the calling OS thread in the kernel, and deadlines will no longer apply to
+// those calls. SetNonblock is intended for advanced users who drive the socket
+// directly using SyscallConn.
+func (c *Conn) SetNonblock(nonblocking bool) error {
+	return c.setNonblock(nonblocking)
+}
+
+// SetReadLowWater sets the SO_RCVLOWAT socket option, the minimum number of
+// bytes which must be queued on the socket before it is considered readable.
+//
+// Note that the Linux kernel honors SO_RCVLOWAT only for stream sockets: reads
+// on a packet socket return as soon as a single frame is queued, regardless of
+// its size. SetReadLowWater is provided for symmetry with other socket types
+// and in case future kernels honor the option, but it should not be relied
+// upon to batch reads. As with any read, a deadline which expires while no
+// frame is queued causes the read to return a timeout error.
+func (c *Conn) SetReadLowWater(bytes int) error { return c.setReadLowWater(bytes) }
+
+// SetBusyPoll sets the SO_BUSY_POLL socket option, the approximate time in
+// microseconds for which a blocking read busy polls the network interface's
+// driver for new frames before sleeping. Zero disables busy polling.
+//
+// Busy polling trades CPU time for lower receive latency: the reading thread
+// spins on a CPU rather than waiting for an interrupt. It requires a driver
+// which supports NAPI busy polling, and increasing the value requires the
+// CAP_NET_ADMIN capability. Depending on the kernel, the net.core.busy_poll
+// and net.core.busy_read sysctls may also need to be set for reads made via
+// the Go runtime network poller to busy poll.
+func (c *Conn) SetBusyPoll(usec int) error { return c.setBusyPoll(usec) }
+
+// SetMaxPacingRate sets the SO_MAX_PACING_RATE socket option, the maximum rate
+// in bytes per second at which frames written to the Conn are transmitted.
+// math.MaxUint64 removes the limit.
+//
+// The kernel does not pace transmits itself: the rate is enforced by the fq
+// queueing discipline, which must be configured on the Conn's network
+// interface (for example, with "tc qdisc replace dev eth0 root fq"). With any
+// other queueing discipline, or if frames bypass the queueing discipline
+// entirely, SetMaxPacingRate succeeds but has no effect. Rates which do not
+// fit in 32 bits are only supported by Linux 4.20 and newer; older kernels
+// truncate the rate.
+func (c *Conn) SetMaxPacingRate(bytesPerSec uint64) error { return c.setMaxPacingRate(bytesPerSec) }
+
+// SetNoFCS sets the SO_NOFCS socket option. By default, the network interface
+// computes and appends the Ethernet frame check sequence (FCS) to each frame
+// written to the Conn. When SO_NOFCS is enabled, the interface instead
+// transmits each frame exactly as written, so the caller must append an FCS of
+// its own, which may be intentionally invalid to test a receiver's behavior.
+//
+// SO_NOFCS is only supported by a few network interface drivers. If the
+// driver does not support it, writes return an error compatible with
+// errors.Is(err, syscall.EPROTONOSUPPORT) while SO_NOFCS is enabled.
+func (c *Conn) SetNoFCS(enable bool) error { return c.setNoFCS(enable) }
+
+// SetsockoptInt sets an integer socket option on the Conn's socket, for
+// options which have no dedicated method. level and opt are constants for the
+// current platform, such as those in golang.org/x/sys/unix.
+//
+// Packet sockets have no ports, and any number of them may be bound to the
+// same interface and protocol, so address reuse options are not meaningful.
+// SO_REUSEADDR is accepted so that code which sets it on all sockets does not
+// fail, but has no effect. SO_REUSEPORT has no effect either, and recent
+// kernels reject it with an error compatible with
+// errors.Is(err, syscall.EOPNOTSUPP). To distribute received frames among
+// several Conns, use Config.Fanout, which uses PACKET_FANOUT, rather than
+// SO_REUSEPORT.
+func (c *Conn) SetsockoptInt(level, opt, value int) error { return c.setsockoptInt(level, opt, value) }
+
+// GetsockoptInt retrieves an integer socket option from the Conn's socket.
+// See SetsockoptInt for details.
+func (c *Conn) GetsockoptInt(level, opt int) (int, error) { return c.getsockoptInt(level, opt) }
+
+// IncomingNAPIID returns the ID of the NAPI context, which corresponds to a
+// network interface receive queue, that delivered the frame most recently
+// received by the Conn. It reports zero if no frame has been received or the
+// network interface driver does not support NAPI.
+//
+// The result reflects only the most recent receive, and may be used to direct
+// further processing to the CPU which services that receive queue.
+func (c *Conn) IncomingNAPIID() (uint32, error) {
+	return c.incomingNAPIID()
+}
+
+// IncomingCPU returns the CPU which most recently processed a frame received
+// by the Conn, as reported by the SO_INCOMING_CPU socket option, or -1 if the
+// kernel has not recorded a CPU for the Conn. Packet sockets do not record the
+// CPU on all kernels, in which case IncomingCPU always reports -1.
+//
+// For a Conn in a fanout group using FanoutCPU, frames are delivered to the
+// member selected by the CPU which received them, so IncomingCPU may be used
+// to verify that each member only receives frames from the CPU it expects.
+// With receive packet steering (RPS), configured through the rps_cpus sysfs
+// attribute of each receive queue, that CPU is the one selected by RPS rather
+// than the CPU which serviced the interrupt.
+func (c *Conn) IncomingCPU() (int, error) { return c.incomingCPU() }
+
+// SendBuffered returns the number of bytes written to the Conn which the
+// kernel has not yet transmitted, such as frames held by the network
+// interface's queueing discipline. It may be used to apply backpressure to a
+// high-rate writer so that it does not overrun the queue.
+func (c *Conn) SendBuffered() (int, error) { return c.sendBuffered() }
+
+// FanoutGroupID returns the ID of the PACKET_FANOUT group which the Conn has
+// joined. ok reports whether the Conn is a member of a fanout group at all,
+// because zero is a valid group ID which the kernel may allocate for
+// FanoutConfig.UniqueID.
+//
+// FanoutGroupID is primarily useful to discover the ID allocated by the kernel
+// for a group created with FanoutConfig.UniqueID, so that other Conns may join
+// it.
+func (c *Conn) FanoutGroupID() (id uint16, ok bool, err error) { return c.fanoutGroupID() }
+
 // Stats contains statistics about a Conn reported by the Linux kernel.
 type Stats struct {
 	// The total number of packets received.
-	Packets uint32
+	Packets uint32 `json:"packets"`
 
 	// The number of packets dropped.
-	Drops uint32
+	Drops uint32 `json:"drops"`
+
+	// The number of packets dropped because the Conn's receive buffer was
+	// full, indicating that the buffer should be enlarged or that frames
+	// should be read more quickly. On Linux, the kernel only counts drops for
+	// this reason, so BufferDrops is equal to Drops. Frames which are rejected
+	// by a BPF filter are not counted as drops.
+	BufferDrops uint32 `json:"buffer_drops"`
 
 	// The total number of times that a receive queue is frozen. May be zero if
 	// the Linux kernel is not new enough to support TPACKET_V3 statistics.
-	FreezeQueueCount uint32
+	FreezeQueueCount uint32 `json:"freeze_queue_count"`
+}
+
+// String returns a concise summary of the Stats.
+func (s *Stats) String() string {
+	return fmt.Sprintf(
+		"packets: %d, drops: %d, buffer drops: %d, freeze queue count: %d",
+		s.Packets, s.Drops, s.BufferDrops, s.FreezeQueueCount,
+	)
 }
 
 // Stats retrieves statistics about the Conn from the Linux kernel.
 //
 // Note that calling Stats will reset the kernel's internal counters for this
-// Conn. If you want to maintain cumulative statistics by polling Stats over
-// time, you must do so in your calling code.
-func (c *Conn) Stats() (*Stats, error) { return c.stats() }
+// Conn, unless Config.CumulativeStats is set. If you want to maintain
+// cumulative statistics by polling Stats over time without that option, you
+// must do so in your calling code.
+func (c *Conn) Stats() (*Stats, error) {
+	if c.statsTotal == nil {
+		return c.stats()
+	}
+
+	return c.statsTotal.add(c.stats)
+}
+
+// cumulativeStats accumulates the counters reported by the kernel, which are
+// reset each time they are read.
+type cumulativeStats struct {
+	mu    sync.Mutex
+	total Stats
+}
+
+// add fetches counters with fn and adds them to the totals, returning a copy
+// of the updated totals. The lock is held while fetching so that concurrent
+// callers cannot observe totals which omit counts fetched by another caller.
+func (cs *cumulativeStats) add(fn func() (*Stats, error)) (*Stats, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	s, err := fn()
+	if err != nil {
+		return nil, err
+	}
+
+	cs.total.Packets += s.Packets
+	cs.total.Drops += s.Drops
+	cs.total.BufferDrops += s.BufferDrops
+	cs.total.FreezeQueueCount += s.FreezeQueueCount
+
+	total := cs.total
+	return &total, nil
+}
+
+// RolloverStats contains statistics about PACKET_FANOUT_FLAG_ROLLOVER events for
+// a Conn, reported by the Linux kernel.
+type RolloverStats struct {
+	// The total number of frames which were rolled over from this Conn to
+	// another member of its fanout group.
+	All uint64
+
+	// The number of frames which were rolled over because this Conn's receive
+	// buffer was nearly full, indicating that a large flow dominates it.
+	Huge uint64
+
+	// The number of frames which could not be rolled over because no other
+	// member of the fanout group had room for them.
+	Failed uint64
+}
+
+// RolloverStats retrieves rollover statistics about the Conn from the Linux
+// kernel using the PACKET_ROLLOVER_STATS socket option.
+//
+// RolloverStats is only meaningful for Conns in a fanout group with rollover
+// enabled, either by FanoutConfig.Rollover or by FanoutRollover. For other
+// Conns, an error compatible with errors.Is(err, syscall.EINVAL) is returned.
+// Unlike Stats, calling RolloverStats does not reset the kernel's counters.
+func (c *Conn) RolloverStats() (*RolloverStats, error) { return c.rolloverStats() }
+
+// InterfaceName returns the name of the network interface with the specified
+// index, such as an index carried by a received Addr. Names are cached after
+// the first lookup so that repeated calls do not query the kernel.
+//
+// If the Conn monitors its interface for removal due to
+// Config.OnInterfaceRemoved or Config.CloseOnInterfaceRemoved, cached names
+// are invalidated automatically when interfaces change. Otherwise, call
+// FlushInterfaceNames when names may have changed.
+func (c *Conn) InterfaceName(index int) (string, error) { return c.names.lookup(index) }
+
+// FlushInterfaceNames clears the cache of network interface names and MTUs
+// used by InterfaceName and InterfaceMTU.
+func (c *Conn) FlushInterfaceNames() { c.names.invalidate(0) }
+
+// InterfaceMTU returns the MTU of the network interface with the specified
+// index, such as the index of the interface which received a frame. MTUs are
+// cached in the same way as names are cached by InterfaceName, and are
+// invalidated along with them, so a changed MTU is only observed after the
+// cache is invalidated.
+//
+// A Conn created by ListenAll receives frames from interfaces with different
+// MTUs into the buffer passed to each read, so that buffer must be sized for
+// the largest MTU of any interface, plus the length of the link layer header
+// for Raw Conns. Frames which do not fit are truncated, which ReadFromMetadata
+// reports in RecvMeta.Truncated. The ingress interface of a frame is only
+// known once the frame has been read, so InterfaceMTU cannot be used to size
+// the buffer for a single read, but helps callers to size their buffers for
+// the interfaces which are in use, and to identify the interface whose MTU
+// exceeds the buffer when a frame is truncated.
+func (c *Conn) InterfaceMTU(index int) (int, error) { return c.names.lookupMTU(index) }
+
+// LinkSpeed reports the negotiated link speed of the Conn's network interface
+// in bits per second.
+//
+// If the interface does not report a link speed, an error compatible with
+// errors.Is(err, ErrLinkSpeedUnknown) is returned.
+func (c *Conn) LinkSpeed() (uint64, error) { return c.linkSpeed() }
+
+// BroadcastAddr returns the link-layer broadcast address of the Conn's network
+// interface, as reported by the kernel for the interface's hardware type. For
+// Ethernet interfaces, this is ff:ff:ff:ff:ff:ff, but other link types such as
+// InfiniBand use addresses of a different length and form.
+//
+// If the interface does not support broadcast, an error compatible with
+// errors.Is(err, ErrNoBroadcast) is returned.
+func (c *Conn) BroadcastAddr() (net.HardwareAddr, error) { return c.broadcastAddr() }
+
+// PHCIndex reports the index of the PTP hardware clock (PHC) which the Conn's
+// network interface uses for hardware timestamps, as reported by the ethtool
+// ETHTOOL_GET_TS_INFO command. The clock is available as /dev/ptp followed by
+// the index, and tools which capture on several interfaces can use the index
+// to determine which interfaces share a clock.
+//
+// If the interface has no PTP hardware clock, PHCIndex returns -1 and a nil
+// error.
+func (c *Conn) PHCIndex() (int, error) { return c.phcIndex() }
+
+// TSCaps describes the timestamping capabilities of a network interface, as
+// reported by Conn.TimestampCapabilities.
+type TSCaps struct {
+	// SoftwareRX and SoftwareTX report whether the kernel can generate
+	// software timestamps for received and transmitted frames.
+	SoftwareRX, SoftwareTX bool
+
+	// HardwareRX and HardwareTX report whether the network interface can
+	// generate hardware timestamps for received and transmitted frames.
+	HardwareRX, HardwareTX bool
+
+	// RawHardware reports whether hardware timestamps can be reported in the
+	// time base of the interface's PTP hardware clock.
+	RawHardware bool
+
+	// PHCIndex is the index of the interface's PTP hardware clock, or -1 if
+	// it has none, as reported by Conn.PHCIndex.
+	PHCIndex int
+
+	// TXTypes and RXFilters are bitmasks of the hardware timestamping modes
+	// supported by the interface: bit N of TXTypes is set if HWTSTAMP_TX_*
+	// value N is supported, and bit N of RXFilters is set if
+	// HWTSTAMP_FILTER_* value N is supported.
+	TXTypes, RXFilters uint32
+}
+
+// TimestampCapabilities reports the timestamping capabilities of the Conn's
+// network interface, so that applications can choose a timing strategy before
+// relying on timestamps. On Linux, the capabilities are reported by the
+// ethtool ETHTOOL_GET_TS_INFO command, and interfaces whose drivers do not
+// implement the command report software timestamping only. On other
+// platforms, TimestampCapabilities returns an error.
+//
+// TimestampCapabilities reports what the interface supports; it does not
+// enable timestamping on the Conn.
+func (c *Conn) TimestampCapabilities() (*TSCaps, error) { return c.timestampCapabilities() }
 
 // SyscallConn returns a raw network connection. This implements the
 // syscall.Conn interface.
@@ -207,11 +1792,62 @@ func (rc *rawConn) opError(op string, err error) error {
 
 var _ net.Addr = &Addr{}
 
-// TODO(mdlayher): expose sll_hatype and sll_pkttype on receive Addr only.
+// A PacketType is the type of a frame received by a Conn, as reported by the
+// kernel in sll_pkttype.
+//
+//enumcheck:exhaustive
+type PacketType uint8
+
+// Possible PacketType values, from linux/if_packet.h.
+//
+// A transparent tap which reads frames from one interface with
+// DirectionInOut and writes them to another must not forward frames with
+// PacketType PacketOutgoing: if the tap reads from both interfaces, those
+// include the frames the tap itself wrote, and forwarding them would loop
+// frames between the interfaces forever.
+const (
+	// The frame is addressed to the local machine.
+	PacketHost PacketType = 0
+	// The frame is a link layer broadcast.
+	PacketBroadcast PacketType = 1
+	// The frame is a link layer multicast.
+	PacketMulticast PacketType = 2
+	// The frame is addressed to another machine, and was received because
+	// the interface is in promiscuous mode.
+	PacketOtherHost PacketType = 3
+	// The frame was transmitted by the local machine.
+	PacketOutgoing PacketType = 4
+)
 
 // An Addr is a physical-layer address.
 type Addr struct {
 	HardwareAddr net.HardwareAddr
+
+	// Protocol is the EtherType of a received frame, in host byte order,
+	// as reported by the kernel in sll_protocol. It is only populated on
+	// Addrs returned by reads, and is ignored by writes, which always use
+	// the protocol the Conn was bound to. For frames sent by the local
+	// machine, Protocol reports the protocol specified by the sender, which
+	// may differ from the EtherType in the frame's header.
+	Protocol uint16
+
+	// Index is the index of the network interface associated with a frame.
+	// On Addrs returned by reads, Index reports the interface which received
+	// or transmitted the frame. On writes, a non-zero Index overrides the
+	// interface which transmits the frame, and is required for Conns created
+	// by ListenAll.
+	Index int
+
+	// HardwareType is the ARP hardware type (ARPHRD_*) of the network
+	// interface, such as 1 for Ethernet, as reported by the kernel in
+	// sll_hatype. It is populated on Addrs returned by reads and by
+	// Conn.Sockname, and is ignored by writes.
+	HardwareType uint16
+
+	// PacketType reports the type of a received frame, including whether
+	// it was transmitted by the local machine. It is only populated on Addrs
+	// returned by reads, and is ignored by writes.
+	PacketType PacketType
 }
 
 // Network returns the address's network name, "packet".
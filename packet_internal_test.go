@@ -7,10 +7,13 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"net"
 	"testing"
+	"unsafe"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/josharian/native"
+	"golang.org/x/sys/unix"
 )
 
 func Test_htons(t *testing.T) {
@@ -73,6 +76,143 @@ func Test_htons(t *testing.T) {
 	}
 }
 
+func Test_nativeEndian(t *testing.T) {
+	// Detect the host's byte order at runtime and verify that it matches the
+	// byte order used to parse kernel structures.
+	v := uint16(0x0102)
+	want := binary.ByteOrder(binary.LittleEndian)
+	if *(*byte)(unsafe.Pointer(&v)) == 0x01 {
+		want = binary.BigEndian
+	}
+
+	if want != native.Endian {
+		t.Fatalf("unexpected native byte order: want %s, got %s", want, native.Endian)
+	}
+}
+
+func Test_fromSockaddr(t *testing.T) {
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+
+	tests := []struct {
+		name     string
+		protocol int
+	}{
+		{name: "ARP", protocol: unix.ETH_P_ARP},
+		{name: "IPv4", protocol: unix.ETH_P_IP},
+		{name: "IPv6", protocol: unix.ETH_P_IPV6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The kernel reports sll_protocol in network byte order.
+			pnet, err := htons(tt.protocol)
+			if err != nil {
+				t.Fatalf("failed to perform htons: %v", err)
+			}
+
+			sa := &unix.SockaddrLinklayer{Protocol: pnet, Halen: 6}
+			copy(sa.Addr[:], mac)
+
+			want := &Addr{HardwareAddr: mac, Protocol: uint16(tt.protocol)}
+			if diff := cmp.Diff(want, fromSockaddr(sa)); diff != "" {
+				t.Fatalf("unexpected Addr (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_parseAuxdata(t *testing.T) {
+	// Craft a PACKET_AUXDATA control message with TP_STATUS_CSUM_VALID set.
+	aux := make([]byte, unix.CmsgSpace(auxdataLen))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&aux[0]))
+	h.Level = unix.SOL_PACKET
+	h.Type = unix.PACKET_AUXDATA
+	h.SetLen(unix.CmsgLen(auxdataLen))
+	native.Endian.PutUint32(aux[unix.CmsgLen(0):], unix.TP_STATUS_CSUM_VALID)
+
+	tests := []struct {
+		name string
+		oob  []byte
+		a    *Auxdata
+		ok   bool
+	}{
+		{
+			name: "absent",
+			a:    &Auxdata{},
+		},
+		{
+			name: "other",
+			oob:  unix.UnixRights(0),
+			a:    &Auxdata{},
+		},
+		{
+			name: "auxdata",
+			oob:  aux,
+			a:    &Auxdata{ChecksumValid: true},
+			ok:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, ok, err := parseAuxdata(tt.oob)
+			if err != nil {
+				t.Fatalf("failed to parse auxdata: %v", err)
+			}
+			if ok != tt.ok {
+				t.Fatalf("unexpected auxdata presence: %v", ok)
+			}
+
+			if diff := cmp.Diff(tt.a, a); diff != "" {
+				t.Fatalf("unexpected Auxdata (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_stats(t *testing.T) {
+	tests := []struct {
+		name string
+		s    *Stats
+		want *Stats
+	}{
+		{
+			name: "v3",
+			s: statsV3(&unix.TpacketStatsV3{
+				Packets:      10,
+				Drops:        2,
+				Freeze_q_cnt: 1,
+			}),
+			want: &Stats{
+				Packets:          10,
+				Drops:            2,
+				BufferDrops:      2,
+				FreezeQueueCount: 1,
+			},
+		},
+		{
+			name: "v2",
+			s: statsV2(&unix.TpacketStats{
+				Packets: 10,
+				Drops:   2,
+			}),
+			want: &Stats{
+				Packets:     10,
+				Drops:       2,
+				BufferDrops: 2,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, tt.s); diff != "" {
+				t.Fatalf("unexpected Stats (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func hex(v uint16) string {
 	return fmt.Sprintf("%#04x", v)
 }
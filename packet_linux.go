@@ -5,67 +5,934 @@ package packet
 
 import (
 	"context"
-	"encoding/binary"
 	"errors"
+	"fmt"
 	"math"
 	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
 
 	"github.com/josharian/native"
 	"github.com/mdlayher/socket"
+	"golang.org/x/net/bpf"
 	"golang.org/x/sys/unix"
 )
 
-// A conn is the net.PacketConn implementation for packet sockets. We can use
-// socket.Conn directly on Linux to implement most of the necessary methods.
-type conn = socket.Conn
+// A conn is the net.PacketConn implementation for packet sockets. On Linux it
+// is implemented by *socket.Conn, and tests may substitute a fake
+// implementation to exercise Conn without a real socket.
+type conn interface {
+	Bind(sa unix.Sockaddr) error
+	Close() error
+	Getsockname() (unix.Sockaddr, error)
+	GetsockoptInt(level, opt int) (int, error)
+	GetsockoptTpacketStats(level, name int) (*unix.TpacketStats, error)
+	GetsockoptTpacketStatsV3(level, name int) (*unix.TpacketStatsV3, error)
+	Recvfrom(ctx context.Context, p []byte, flags int) (int, unix.Sockaddr, error)
+	Recvmsg(ctx context.Context, p, oob []byte, flags int) (int, int, int, unix.Sockaddr, error)
+	RemoveBPF() error
+	Sendmsg(ctx context.Context, p, oob []byte, to unix.Sockaddr, flags int) (int, error)
+	Sendto(ctx context.Context, p []byte, flags int, to unix.Sockaddr) error
+	SetBPF(filter []bpf.RawInstruction) error
+	SetDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetsockoptInt(level, opt, value int) error
+	SetsockoptPacketMreq(level, opt int, mreq *unix.PacketMreq) error
+	SyscallConn() (syscall.RawConn, error)
+}
+
+var _ conn = &socket.Conn{}
+
+// readFrom implements the net.PacketConn ReadFrom method using recvfrom(2).
+func (c *Conn) readFrom(b []byte) (int, net.Addr, error) {
+	// From net.PacketConn documentation:
+	//
+	// "[ReadFrom] returns the number of bytes read (0 <= n <= len(p)) and any
+	// error encountered. Callers should always process the n > 0 bytes returned
+	// before considering the error err."
+	//
+	// c.opError will return nil if no error, but either way we return all the
+	// information that we have.
+	for {
+		n, sa, err := c.c.Recvfrom(context.Background(), b, 0)
+		if err == nil && n == 0 && len(b) > 0 {
+			// An empty frame, such as a Datagram frame which consists only
+			// of a link layer header. Callers may mistake it for EOF, so
+			// discard it and wait for the next frame. Any deadline still
+			// applies to the next read.
+			continue
+		}
+
+		return n, fromSockaddr(sa), c.opError(opRead, err)
+	}
+}
+
+// readFromByInterval is the longest interval for which readFromBy waits for a
+// frame without checking whether the Conn was closed or its read deadline
+// changed.
+const readFromByInterval = 100 * time.Millisecond
+
+// readFromBy implements Conn.ReadFromBy by polling the socket directly, so
+// that deadline applies only to this call.
+func (c *Conn) readFromBy(b []byte, deadline time.Time) (int, net.Addr, error) {
+	for {
+		var (
+			n  int
+			sa unix.Sockaddr
+		)
+		err := c.control("recvfrom", func(fd int) error {
+			var err error
+			n, sa, err = unix.Recvfrom(fd, b, unix.MSG_DONTWAIT)
+			return err
+		})
+		switch {
+		case err == nil && n == 0 && len(b) > 0:
+			// Discard empty frames, as readFrom does.
+			continue
+		case err == nil:
+			return n, fromSockaddr(sa), nil
+		case !errors.Is(err, unix.EAGAIN) && !errors.Is(err, unix.EINTR):
+			return 0, nil, c.opError(opRead, err)
+		}
+
+		// The Conn's deadline may change while waiting, so check it on each
+		// iteration.
+		d := deadline
+		if rd := c.ReadDeadline(); !rd.IsZero() && (d.IsZero() || rd.Before(d)) {
+			d = rd
+		}
+
+		timeout := readFromByInterval
+		if !d.IsZero() {
+			remaining := time.Until(d)
+			if remaining <= 0 {
+				return 0, nil, c.opError(opRead, os.ErrDeadlineExceeded)
+			}
+			if remaining < timeout {
+				timeout = remaining
+			}
+		}
+
+		// Round up so that the deadline has passed once poll times out.
+		ms := int((timeout + time.Millisecond - 1) / time.Millisecond)
+		err = c.control("poll", func(fd int) error {
+			_, err := unix.Poll([]unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}, ms)
+			if err == unix.EINTR {
+				return nil
+			}
+
+			return err
+		})
+		if err != nil {
+			return 0, nil, c.opError(opRead, err)
+		}
+	}
+}
+
+// readFromVnetHdr reads a frame and its virtio_net_hdr using recvmsg(2) with
+// separate buffers for the header and the frame.
+func (c *Conn) readFromVnetHdr(b []byte) (int, *VnetHdr, net.Addr, error) {
+	if !c.vnetHdr {
+		return 0, nil, nil, c.opError(opRead, os.NewSyscallError("recvmsg", unix.EINVAL))
+	}
+
+	rc, err := c.c.SyscallConn()
+	if err != nil {
+		return 0, nil, nil, c.opError(opRead, err)
+	}
+
+	var (
+		hdr  [vnetHdrLen]byte
+		n    int
+		from unix.Sockaddr
+		rerr error
+	)
+
+	err = rc.Read(func(fd uintptr) bool {
+		n, _, _, from, rerr = unix.RecvmsgBuffers(int(fd), [][]byte{hdr[:], b}, nil, 0)
+		return rerr != unix.EAGAIN
+	})
+	if err == nil {
+		err = os.NewSyscallError("recvmsg", rerr)
+	}
+	if err != nil {
+		return 0, nil, nil, c.opError(opRead, err)
+	}
+
+	if n < vnetHdrLen {
+		return 0, nil, nil, c.opError(opRead, os.NewSyscallError("recvmsg", unix.EBADMSG))
+	}
+
+	var vh VnetHdr
+	vh.unmarshal(hdr[:], native.Endian)
+
+	return n - vnetHdrLen, &vh, fromSockaddr(from), nil
+}
+
+// readFromAuxdata reads a frame and its PACKET_AUXDATA control message using
+// recvmsg(2).
+func (c *Conn) readFromAuxdata(b []byte) (int, *Auxdata, net.Addr, error) {
+	if !c.auxdata {
+		return 0, nil, nil, c.opError(opRead, os.NewSyscallError("recvmsg", unix.EINVAL))
+	}
+
+	oob := make([]byte, unix.CmsgSpace(auxdataLen))
+	var (
+		n, oobn int
+		from    unix.Sockaddr
+		err     error
+	)
+	for {
+		n, oobn, _, from, err = c.c.Recvmsg(context.Background(), b, oob, 0)
+		if err != nil {
+			return n, nil, nil, c.opError(opRead, err)
+		}
+
+		// Discard empty frames, as readFrom does.
+		if n > 0 || len(b) == 0 {
+			break
+		}
+	}
+
+	a, ok, err := parseAuxdata(oob[:oobn])
+	if err != nil {
+		return n, nil, fromSockaddr(from), c.opError(opRead, err)
+	}
+
+	// Record whether the kernel delivered auxdata with the first frame.
+	state := auxdataUnavailable
+	if ok {
+		state = auxdataDelivered
+	}
+	c.auxdataState.CompareAndSwap(auxdataUnknown, state)
+
+	return n, a, fromSockaddr(from), nil
+}
+
+// readFromMetadata implements Conn.ReadFromMetadata using recvmsg(2).
+func (c *Conn) readFromMetadata(b []byte) (int, *RecvMeta, error) {
+	var oob []byte
+	if c.auxdata {
+		oob = make([]byte, unix.CmsgSpace(auxdataLen))
+	}
+
+	var (
+		n, oobn, flags int
+		from           unix.Sockaddr
+		err            error
+	)
+	for {
+		n, oobn, flags, from, err = c.c.Recvmsg(context.Background(), b, oob, 0)
+		if err != nil {
+			return n, nil, c.opError(opRead, err)
+		}
+
+		// Discard empty frames, as readFrom does.
+		if n > 0 || len(b) == 0 {
+			break
+		}
+	}
+
+	m := &RecvMeta{
+		Addr:      fromSockaddr(from),
+		Timestamp: time.Now(),
+		Truncated: flags&unix.MSG_TRUNC != 0,
+	}
+
+	if c.auxdata {
+		a, ok, err := parseAuxdata(oob[:oobn])
+		if err != nil {
+			return n, m, c.opError(opRead, err)
+		}
+		if ok {
+			m.Auxdata = a
+		}
+	}
+
+	// Only Raw Conns receive the frame's Ethernet header.
+	var frame []byte
+	if c.typ == Raw {
+		frame = b[:n]
+	}
+	m.VLANTags = VLANTags(frame, m.Auxdata)
+
+	return n, m, nil
+}
+
+// parseAuxdata finds and parses a PACKET_AUXDATA control message in oob. If no
+// such message is present, it returns zero-valued Auxdata and false.
+func parseAuxdata(oob []byte) (*Auxdata, bool, error) {
+	scms, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, false, os.NewSyscallError("recvmsg", err)
+	}
+
+	for _, scm := range scms {
+		if scm.Header.Level != unix.SOL_PACKET || scm.Header.Type != unix.PACKET_AUXDATA {
+			continue
+		}
+
+		var a Auxdata
+		if err := a.unmarshal(scm.Data, native.Endian); err != nil {
+			return nil, false, err
+		}
+
+		return &a, true, nil
+	}
+
+	return &Auxdata{}, false, nil
+}
+
+// readErrQueue implements Conn.ReadErrQueue using recvmsg(2) with
+// MSG_ERRQUEUE.
+func (c *Conn) readErrQueue(b []byte) (int, net.Addr, *SockExtendedErr, error) {
+	var (
+		// Leave room for other control messages such as SCM_TIMESTAMPING.
+		oob  = make([]byte, 512)
+		n    int
+		oobn int
+		from unix.Sockaddr
+	)
+
+	// The error queue does not make the socket readable, so read it
+	// directly rather than waiting for readability.
+	err := c.control("recvmsg", func(fd int) error {
+		var err error
+		n, oobn, _, from, err = unix.Recvmsg(fd, b, oob, unix.MSG_ERRQUEUE|unix.MSG_DONTWAIT)
+		return err
+	})
+	if err != nil {
+		return 0, nil, nil, c.opError(opRead, err)
+	}
+
+	scms, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return n, nil, nil, c.opError(opRead, os.NewSyscallError("recvmsg", err))
+	}
+
+	var addr net.Addr
+	if from != nil {
+		addr = fromSockaddr(from)
+	}
+
+	for _, scm := range scms {
+		// Packet sockets report errors using PACKET_TX_TIMESTAMP regardless of
+		// their origin.
+		if scm.Header.Level != unix.SOL_PACKET || scm.Header.Type != unix.PACKET_TX_TIMESTAMP {
+			continue
+		}
+
+		var ee SockExtendedErr
+		if err := ee.unmarshal(scm.Data, native.Endian); err != nil {
+			return n, addr, nil, c.opError(opRead, err)
+		}
+
+		return n, addr, &ee, nil
+	}
+
+	return n, addr, nil, c.opError(opRead, os.NewSyscallError("recvmsg", unix.EBADMSG))
+}
+
+// writeTo implements the net.PacketConn WriteTo method.
+func (c *Conn) writeTo(b []byte, addr net.Addr) (int, error) { return c.writeToFlags(b, addr, 0) }
+
+// writeToFlags implements Conn.WriteToFlags using sendto(2).
+func (c *Conn) writeToFlags(b []byte, addr net.Addr, flags int) (int, error) {
+	sa, err := c.toSockaddr("sendto", addr)
+	if err != nil {
+		return 0, c.opError(opWrite, err)
+	}
+
+	if flags&unix.MSG_DONTWAIT != 0 {
+		// package socket waits for the socket to become writable on EAGAIN,
+		// so make a single attempt directly instead. A non-blocking send can
+		// still be interrupted by a signal, in which case it is safe to retry
+		// immediately.
+		err := c.control("sendto", func(fd int) error {
+			for {
+				if err := unix.Sendto(fd, b, flags, sa); err != unix.EINTR {
+					return err
+				}
+			}
+		})
+		if err != nil {
+			return 0, c.opError(opWrite, err)
+		}
+
+		return len(b), nil
+	}
+
+	// package socket retries on EINTR until the write deadline expires, so
+	// signals delivered during a blocking send are not surfaced to callers.
+	//
+	// TODO(mdlayher): it's curious that unix.Sendto does not return the number
+	// of bytes actually sent. Fake it for now, but investigate upstream.
+	if err := c.c.Sendto(context.Background(), b, flags, sa); err != nil {
+		return 0, c.opError(opWrite, err)
+	}
+
+	return len(b), nil
+}
+
+// close closes the Conn's socket and stops any background monitoring.
+func (c *Conn) close() error {
+	if c.monitor != nil {
+		_ = c.monitor.Close()
+	}
+
+	// The kernel only releases memberships when the last file descriptor for
+	// the socket is closed, which may be held open by a descriptor duplicated
+	// through SyscallConn. Drop each membership as many times as it was added
+	// so that the interface is restored to its prior state regardless, while
+	// memberships held by other sockets, and flags set by other means, are
+	// left alone. Errors are ignored as the socket is being closed anyway.
+	for _, e := range c.memberships.take() {
+		mreq, err := c.packetMreq(e.m)
+		if err != nil {
+			continue
+		}
+
+		for i := 0; i < e.count; i++ {
+			_ = c.c.SetsockoptPacketMreq(unix.SOL_PACKET, unix.PACKET_DROP_MEMBERSHIP, mreq)
+		}
+	}
+
+	return c.c.Close()
+}
+
+// writeToAt writes a frame using sendmsg(2) with an SCM_TXTIME control message,
+// enabling SO_TXTIME on first use.
+func (c *Conn) writeToAt(b []byte, addr net.Addr, when time.Time) (int, error) {
+	c.txtimeOnce.Do(func() {
+		// The kernel provides no way to disable SO_TXTIME again.
+		c.sockoptsChanged.Store(true)
+
+		// struct sock_txtime.
+		txt := struct {
+			clockid int32
+			flags   uint32
+		}{clockid: unix.CLOCK_TAI}
+
+		c.txtimeErr = c.control("setsockopt", func(fd int) error {
+			return setsockopt(fd, unix.SOL_SOCKET, unix.SO_TXTIME, unsafe.Pointer(&txt), unsafe.Sizeof(txt))
+		})
+	})
+	if c.txtimeErr != nil {
+		return 0, c.opError(opSetsockopt, c.txtimeErr)
+	}
+
+	sa, err := c.toSockaddr("sendmsg", addr)
+	if err != nil {
+		return 0, c.opError(opWrite, err)
+	}
+
+	// The SCM_TXTIME control message carries a 64-bit nanosecond timestamp.
+	oob := make([]byte, unix.CmsgSpace(8))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level = unix.SOL_SOCKET
+	h.Type = unix.SCM_TXTIME
+	h.SetLen(unix.CmsgLen(8))
+	native.Endian.PutUint64(oob[unix.CmsgLen(0):], uint64(when.UnixNano()))
+
+	if _, err := c.c.Sendmsg(context.Background(), b, oob, sa, 0); err != nil {
+		return 0, c.opError(opWrite, err)
+	}
+
+	return len(b), nil
+}
+
+// writeToVnetHdr writes a frame and its virtio_net_hdr using sendmsg(2) with
+// separate buffers for the header and the frame.
+func (c *Conn) writeToVnetHdr(b []byte, vh *VnetHdr, addr net.Addr) (int, error) {
+	if !c.vnetHdr || vh == nil {
+		return 0, c.opError(opWrite, os.NewSyscallError("sendmsg", unix.EINVAL))
+	}
+	if err := vh.validate(len(b)); err != nil {
+		return 0, c.opError(opWrite, err)
+	}
+
+	sa, err := c.toSockaddr("sendmsg", addr)
+	if err != nil {
+		return 0, c.opError(opWrite, err)
+	}
+
+	rc, err := c.c.SyscallConn()
+	if err != nil {
+		return 0, c.opError(opWrite, err)
+	}
+
+	var (
+		hdr  [vnetHdrLen]byte
+		n    int
+		werr error
+	)
+	vh.marshal(hdr[:], native.Endian)
+
+	err = rc.Write(func(fd uintptr) bool {
+		n, werr = unix.SendmsgBuffers(int(fd), [][]byte{hdr[:], b}, nil, sa, 0)
+		return werr != unix.EAGAIN
+	})
+	if err == nil {
+		err = os.NewSyscallError("sendmsg", werr)
+	}
+	if err != nil {
+		return 0, c.opError(opWrite, err)
+	}
+
+	return n - vnetHdrLen, nil
+}
+
+// filter wraps getsockopt(2) for the SO_GET_FILTER option.
+func (c *Conn) filter() ([]bpf.RawInstruction, error) {
+	var filter []bpf.RawInstruction
+	err := c.control("getsockopt", func(fd int) error {
+		// The option length is measured in instructions rather than bytes. A
+		// zero length queries the number of instructions in the filter.
+		var l uint32
+		if err := getsockopt(fd, unix.SOL_SOCKET, unix.SO_GET_FILTER, nil, &l); err != nil {
+			return err
+		}
+		if l == 0 {
+			return nil
+		}
+
+		filter = make([]bpf.RawInstruction, l)
+		if err := getsockopt(fd, unix.SOL_SOCKET, unix.SO_GET_FILTER, unsafe.Pointer(&filter[0]), &l); err != nil {
+			return err
+		}
+
+		filter = filter[:l]
+		return nil
+	})
+	if err != nil {
+		return nil, c.opError(opGetsockopt, err)
+	}
+
+	return filter, nil
+}
+
+// drain implements Conn.Drain.
+func (c *Conn) drain() (int, error) {
+	n, err := drain(c.c)
+	return n, c.opError(opRead, err)
+}
+
+// reset restores c to the state specified by cfg immediately after Listen.
+func (c *Conn) reset(cfg *Config) error {
+	// The idle timer must not close c while it is idle, and is restarted by
+	// Pool.Get. If it already fired, c is closed and the calls below fail.
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+
+	if err := c.SetDeadline(time.Time{}); err != nil {
+		return err
+	}
+	if err := c.setNonblock(true); err != nil {
+		return err
+	}
+
+	c.writeFilter.Store(nil)
+	c.packets.Store(0)
+	if c.limiter != nil {
+		c.limiter.reset()
+	}
+
+	c.corkMu.Lock()
+	c.corked, c.corkBuf, c.corkAddr = false, nil, nil
+	c.corkMu.Unlock()
+
+	c.swapMu.Lock()
+	c.swapBuf = nil
+	c.swapMu.Unlock()
+
+	if err := c.resetMemberships(cfg.Promiscuous); err != nil {
+		return err
+	}
+
+	// Resuming is unnecessary because the filter is replaced below, which
+	// also discards frames captured by a previous user's filter.
+	c.paused.mu.Lock()
+	c.paused.paused, c.paused.filter = false, nil
+	c.paused.mu.Unlock()
+
+	return c.changeFilter(false, func() error { return c.replaceFilter(cfg.Filter) })
+}
+
+// resetMemberships drops all memberships added since Listen, leaving only the
+// promiscuous membership added by Config.Promiscuous if promiscuous is set.
+func (c *Conn) resetMemberships(promiscuous bool) error {
+	var found bool
+	for _, e := range c.memberships.take() {
+		mreq, err := c.packetMreq(e.m)
+		if err != nil {
+			return c.opError(opSetsockopt, err)
+		}
+
+		n := e.count
+		if promiscuous && e.m.Type == MembershipPromiscuous {
+			// Keep a single membership, as added by Listen.
+			found = true
+			n--
+			c.memberships.add(e.m)
+		}
+
+		for i := 0; i < n; i++ {
+			if err := c.c.SetsockoptPacketMreq(unix.SOL_PACKET, unix.PACKET_DROP_MEMBERSHIP, mreq); err != nil {
+				return c.opError(opSetsockopt, err)
+			}
+		}
+	}
+
+	if promiscuous && !found {
+		return c.setPromiscuous(true)
+	}
+
+	return nil
+}
+
+// replaceFilter attaches a filter which rejects all frames, discards any queued
+// frames, and then attaches filter, or removes the filter entirely if filter
+// is empty.
+func (c *Conn) replaceFilter(filter []bpf.RawInstruction) error {
+	filter = composeFilter(c.filterPrefix, filter)
+	if err := checkFilterLen(filter); err != nil {
+		return c.opError(opSetsockopt, err)
+	}
+
+	if err := c.c.SetBPF(filterDropAll); err != nil {
+		return c.opError(opSetsockopt, err)
+	}
+	if _, err := drain(c.c); err != nil {
+		return c.opError(opRead, err)
+	}
+
+	var err error
+	if len(filter) > 0 {
+		err = c.c.SetBPF(filter)
+	} else {
+		err = c.c.RemoveBPF()
+	}
+
+	return c.opError(opSetsockopt, err)
+}
+
+// pause implements Conn.Pause.
+func (c *Conn) pause() error {
+	c.paused.mu.Lock()
+	defer c.paused.mu.Unlock()
+
+	if c.paused.paused {
+		return nil
+	}
+	if c.paused.ebpf {
+		return c.opError(opSetsockopt, errors.New("packet: cannot pause a Conn with an eBPF program attached"))
+	}
+
+	// The complete filter, including any prefix, is restored by resume.
+	filter, err := c.filter()
+	if err != nil {
+		return err
+	}
+
+	if err := c.c.SetBPF(filterDropAll); err != nil {
+		return c.opError(opSetsockopt, err)
+	}
+	c.paused.paused, c.paused.filter = true, filter
+
+	if _, err := drain(c.c); err != nil {
+		return c.opError(opRead, err)
+	}
+
+	return nil
+}
+
+// resume implements Conn.Resume.
+func (c *Conn) resume() error {
+	c.paused.mu.Lock()
+	defer c.paused.mu.Unlock()
+
+	if !c.paused.paused {
+		return nil
+	}
+
+	var err error
+	if len(c.paused.filter) > 0 {
+		err = c.c.SetBPF(c.paused.filter)
+	} else {
+		err = c.c.RemoveBPF()
+	}
+	if err != nil {
+		return c.opError(opSetsockopt, err)
+	}
+
+	c.paused.paused, c.paused.filter = false, nil
+	return nil
+}
+
+// setPromiscuous wraps setsockopt(2) for the unix.PACKET_MR_PROMISC option.
+func (c *Conn) setPromiscuous(enable bool) error {
+	return c.membership(Membership{Type: MembershipPromiscuous}, enable)
+}
+
+// setAllMulticast wraps setsockopt(2) for the unix.PACKET_MR_ALLMULTI option.
+func (c *Conn) setAllMulticast(enable bool) error {
+	return c.membership(Membership{Type: MembershipAllMulticast}, enable)
+}
+
+// joinGroup adds a PACKET_MR_MULTICAST membership for addr.
+func (c *Conn) joinGroup(addr net.HardwareAddr) error {
+	return c.membership(Membership{Type: MembershipMulticast, Addr: addr}, true)
+}
+
+// leaveGroup drops a PACKET_MR_MULTICAST membership for addr.
+func (c *Conn) leaveGroup(addr net.HardwareAddr) error {
+	return c.membership(Membership{Type: MembershipMulticast, Addr: addr}, false)
+}
+
+// listMemberships implements Conn.Memberships.
+func (c *Conn) listMemberships() ([]Membership, error) { return c.memberships.list(), nil }
+
+// membership wraps setsockopt(2) to add or drop membership m, and records the
+// change on success.
+func (c *Conn) membership(m Membership, add bool) error {
+	mreq, err := c.packetMreq(m)
+	if err != nil {
+		return c.opError(opSetsockopt, err)
+	}
+
+	opt := unix.PACKET_DROP_MEMBERSHIP
+	if add {
+		opt = unix.PACKET_ADD_MEMBERSHIP
+	}
+
+	if err := c.c.SetsockoptPacketMreq(unix.SOL_PACKET, opt, mreq); err != nil {
+		return c.opError(opSetsockopt, err)
+	}
+
+	if add {
+		c.memberships.add(m)
+	} else {
+		c.memberships.drop(m)
+	}
+
+	return nil
+}
+
+// packetMreq builds the packet_mreq structure for membership m on the Conn's
+// network interface.
+func (c *Conn) packetMreq(m Membership) (*unix.PacketMreq, error) {
+	mreq := unix.PacketMreq{
+		Ifindex: int32(c.ifIndex),
+		Type:    uint16(m.Type),
+	}
+	if len(m.Addr) > len(mreq.Address) {
+		return nil, os.NewSyscallError("setsockopt", unix.EINVAL)
+	}
+	mreq.Alen = uint16(len(m.Addr))
+	copy(mreq.Address[:], m.Addr)
+
+	return &mreq, nil
+}
+
+// setInterfacePromiscuous wraps ioctl(2) for SIOCGIFFLAGS and SIOCSIFFLAGS to
+// update the IFF_PROMISC flag.
+func (c *Conn) setInterfacePromiscuous(enable bool) error {
+	ifi, err := net.InterfaceByIndex(c.ifIndex)
+	if err != nil {
+		return c.opError(opIoctl, err)
+	}
+
+	ifr, err := unix.NewIfreq(ifi.Name)
+	if err != nil {
+		return c.opError(opIoctl, err)
+	}
+
+	rc, err := c.c.SyscallConn()
+	if err != nil {
+		return c.opError(opSyscallConn, err)
+	}
+
+	var ierr error
+	if err := rc.Control(func(fd uintptr) {
+		if ierr = unix.IoctlIfreq(int(fd), unix.SIOCGIFFLAGS, ifr); ierr != nil {
+			return
+		}
+
+		flags := ifr.Uint16()
+		if enable {
+			flags |= unix.IFF_PROMISC
+		} else {
+			flags &^= unix.IFF_PROMISC
+		}
+		ifr.SetUint16(flags)
+
+		ierr = unix.IoctlIfreq(int(fd), unix.SIOCSIFFLAGS, ifr)
+	}); err != nil {
+		return c.opError(opRawControl, err)
+	}
+
+	return c.opError(opIoctl, os.NewSyscallError("ioctl", ierr))
+}
+
+// seteBPF wraps setsockopt(2) for the SO_ATTACH_BPF option.
+func (c *Conn) seteBPF(progFD int) error {
+	return c.changeFilter(true, func() error {
+		return c.opError(
+			opSetsockopt,
+			c.c.SetsockoptInt(unix.SOL_SOCKET, unix.SO_ATTACH_BPF, progFD),
+		)
+	})
+}
+
+// removeeBPF wraps setsockopt(2) for the SO_DETACH_BPF option.
+func (c *Conn) removeeBPF() error {
+	return c.changeFilter(false, func() error {
+		return c.opError(
+			opSetsockopt,
+			c.c.SetsockoptInt(unix.SOL_SOCKET, unix.SO_DETACH_BPF, 0),
+		)
+	})
+}
+
+// setBusyPoll wraps setsockopt(2) for the SO_BUSY_POLL option.
+func (c *Conn) setBusyPoll(usec int) error {
+	c.sockoptsChanged.Store(true)
+
+	return c.opError(
+		opSetsockopt,
+		c.c.SetsockoptInt(unix.SOL_SOCKET, unix.SO_BUSY_POLL, usec),
+	)
+}
+
+// setMaxPacingRate wraps setsockopt(2) for the SO_MAX_PACING_RATE option.
+func (c *Conn) setMaxPacingRate(bytesPerSec uint64) error {
+	c.sockoptsChanged.Store(true)
+
+	// The kernel accepts a 64-bit rate when the option is 8 bytes long, and
+	// older kernels read only the first 4 bytes.
+	return c.opError(opSetsockopt, c.control("setsockopt", func(fd int) error {
+		return setsockopt(fd, unix.SOL_SOCKET, unix.SO_MAX_PACING_RATE,
+			unsafe.Pointer(&bytesPerSec), unsafe.Sizeof(bytesPerSec))
+	}))
+}
+
+// setReadLowWater wraps setsockopt(2) for the SO_RCVLOWAT option.
+func (c *Conn) setReadLowWater(bytes int) error {
+	c.sockoptsChanged.Store(true)
+
+	return c.opError(
+		opSetsockopt,
+		c.c.SetsockoptInt(unix.SOL_SOCKET, unix.SO_RCVLOWAT, bytes),
+	)
+}
+
+// setNoFCS wraps setsockopt(2) for the SO_NOFCS option.
+func (c *Conn) setNoFCS(enable bool) error {
+	c.sockoptsChanged.Store(true)
+
+	v := 0
+	if enable {
+		v = 1
+	}
+
+	return c.opError(
+		opSetsockopt,
+		c.c.SetsockoptInt(unix.SOL_SOCKET, unix.SO_NOFCS, v),
+	)
+}
+
+// setsockoptInt wraps setsockopt(2) for an arbitrary integer option.
+func (c *Conn) setsockoptInt(level, opt, value int) error {
+	c.sockoptsChanged.Store(true)
+
+	return c.opError(opSetsockopt, c.c.SetsockoptInt(level, opt, value))
+}
+
+// getsockoptInt wraps getsockopt(2) for an arbitrary integer option.
+func (c *Conn) getsockoptInt(level, opt int) (int, error) {
+	v, err := c.c.GetsockoptInt(level, opt)
+	if err != nil {
+		return 0, c.opError(opGetsockopt, err)
+	}
+
+	return v, nil
+}
 
-// readFrom implements the net.PacketConn ReadFrom method using recvfrom(2).
-func (c *Conn) readFrom(b []byte) (int, net.Addr, error) {
-	// From net.PacketConn documentation:
-	//
-	// "[ReadFrom] returns the number of bytes read (0 <= n <= len(p)) and any
-	// error encountered. Callers should always process the n > 0 bytes returned
-	// before considering the error err."
-	//
-	// c.opError will return nil if no error, but either way we return all the
-	// information that we have.
-	n, sa, err := c.c.Recvfrom(context.Background(), b, 0)
-	return n, fromSockaddr(sa), c.opError(opRead, err)
+// incomingNAPIID wraps getsockopt(2) for the SO_INCOMING_NAPI_ID option.
+func (c *Conn) incomingNAPIID() (uint32, error) {
+	v, err := c.c.GetsockoptInt(unix.SOL_SOCKET, unix.SO_INCOMING_NAPI_ID)
+	if err != nil {
+		return 0, c.opError(opGetsockopt, err)
+	}
+
+	return uint32(v), nil
 }
 
-// writeTo implements the net.PacketConn WriteTo method.
-func (c *Conn) writeTo(b []byte, addr net.Addr) (int, error) {
-	sa, err := c.toSockaddr("sendto", addr)
+// incomingCPU wraps getsockopt(2) for the SO_INCOMING_CPU option.
+func (c *Conn) incomingCPU() (int, error) {
+	v, err := c.c.GetsockoptInt(unix.SOL_SOCKET, unix.SO_INCOMING_CPU)
 	if err != nil {
-		return 0, c.opError(opWrite, err)
+		return 0, c.opError(opGetsockopt, err)
 	}
 
-	// TODO(mdlayher): it's curious that unix.Sendto does not return the number
-	// of bytes actually sent. Fake it for now, but investigate upstream.
-	if err := c.c.Sendto(context.Background(), b, 0, sa); err != nil {
-		return 0, c.opError(opWrite, err)
+	return v, nil
+}
+
+// fanoutGroupID wraps getsockopt(2) for the PACKET_FANOUT option.
+func (c *Conn) fanoutGroupID() (uint16, bool, error) {
+	v, err := c.c.GetsockoptInt(unix.SOL_PACKET, unix.PACKET_FANOUT)
+	if err != nil {
+		return 0, false, c.opError(opGetsockopt, err)
 	}
 
-	return len(b), nil
+	// The kernel reports zero for sockets outside of a group, but also for
+	// members of group zero using FanoutHash without flags.
+	if v == 0 && !c.fanout {
+		return 0, false, nil
+	}
+
+	// The group ID occupies the low 16 bits, as when joining the group.
+	return uint16(v), true, nil
 }
 
-// setPromiscuous wraps setsockopt(2) for the unix.PACKET_MR_PROMISC option.
-func (c *Conn) setPromiscuous(enable bool) error {
-	mreq := unix.PacketMreq{
-		Ifindex: int32(c.ifIndex),
-		Type:    unix.PACKET_MR_PROMISC,
+// sendBuffered wraps ioctl(2) for SIOCOUTQ.
+func (c *Conn) sendBuffered() (int, error) {
+	var n int
+	err := c.control("ioctl", func(fd int) error {
+		var err error
+		n, err = unix.IoctlGetInt(fd, unix.SIOCOUTQ)
+		return err
+	})
+	if err != nil {
+		return 0, c.opError(opIoctl, err)
 	}
 
-	membership := unix.PACKET_DROP_MEMBERSHIP
-	if enable {
-		membership = unix.PACKET_ADD_MEMBERSHIP
+	return n, nil
+}
+
+// setNonblock wraps fcntl(2) for the O_NONBLOCK flag.
+func (c *Conn) setNonblock(nonblocking bool) error {
+	rc, err := c.c.SyscallConn()
+	if err != nil {
+		return c.opError(opSyscallConn, err)
 	}
 
-	return c.opError(
-		opSetsockopt,
-		c.c.SetsockoptPacketMreq(unix.SOL_PACKET, membership, &mreq),
-	)
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		serr = unix.SetNonblock(int(fd), nonblocking)
+	}); err != nil {
+		return c.opError(opRawControl, err)
+	}
+
+	return c.opError(opSet, os.NewSyscallError("fcntl", serr))
 }
 
 // stats wraps getsockopt(2) for tpacket_stats* types.
@@ -77,11 +944,7 @@ func (c *Conn) stats() (*Stats, error) {
 
 	// Try to fetch V3 statistics first, they contain more detailed information.
 	if stats, err := c.c.GetsockoptTpacketStatsV3(level, name); err == nil {
-		return &Stats{
-			Packets:          stats.Packets,
-			Drops:            stats.Drops,
-			FreezeQueueCount: stats.Freeze_q_cnt,
-		}, nil
+		return statsV3(stats), nil
 	}
 
 	// There was an error fetching v3 stats, try to fall back.
@@ -90,31 +953,190 @@ func (c *Conn) stats() (*Stats, error) {
 		return nil, c.opError(opGetsockopt, err)
 	}
 
+	return statsV2(stats), nil
+}
+
+// statsV3 converts tpacket_stats_v3 to Stats.
+func statsV3(stats *unix.TpacketStatsV3) *Stats {
 	return &Stats{
 		Packets: stats.Packets,
 		Drops:   stats.Drops,
+		// tp_drops only counts frames dropped due to a full receive buffer or
+		// ring.
+		BufferDrops:      stats.Drops,
+		FreezeQueueCount: stats.Freeze_q_cnt,
+	}
+}
+
+// statsV2 converts tpacket_stats to Stats.
+func statsV2(stats *unix.TpacketStats) *Stats {
+	return &Stats{
+		Packets:     stats.Packets,
+		Drops:       stats.Drops,
+		BufferDrops: stats.Drops,
 		// FreezeQueueCount is not present.
+	}
+}
+
+// rolloverStats wraps getsockopt(2) for the PACKET_ROLLOVER_STATS option.
+func (c *Conn) rolloverStats() (*RolloverStats, error) {
+	// struct tpacket_rollover_stats.
+	var stats struct {
+		all, huge, failed uint64
+	}
+
+	err := c.control("getsockopt", func(fd int) error {
+		l := uint32(unsafe.Sizeof(stats))
+		return getsockopt(fd, unix.SOL_PACKET, unix.PACKET_ROLLOVER_STATS, unsafe.Pointer(&stats), &l)
+	})
+	if err != nil {
+		return nil, c.opError(opGetsockopt, err)
+	}
+
+	return &RolloverStats{
+		All:    stats.all,
+		Huge:   stats.huge,
+		Failed: stats.failed,
 	}, nil
 }
 
+// broadcastAddr reads the broadcast address of the Conn's interface from sysfs.
+func (c *Conn) broadcastAddr() (net.HardwareAddr, error) {
+	ifi, err := net.InterfaceByIndex(c.ifIndex)
+	if err != nil {
+		return nil, c.opError(opBroadcastAddr, err)
+	}
+	if ifi.Flags&net.FlagBroadcast == 0 {
+		return nil, c.opError(opBroadcastAddr, ErrNoBroadcast)
+	}
+
+	b, err := os.ReadFile(filepath.Join("/sys/class/net", ifi.Name, "broadcast"))
+	if err != nil {
+		return nil, c.opError(opBroadcastAddr, err)
+	}
+
+	// The kernel prints the address as colon-separated hexadecimal octets of
+	// the length appropriate for the hardware type. net.ParseMAC only accepts
+	// a few lengths, so parse the octets directly.
+	octets := strings.Split(strings.TrimSpace(string(b)), ":")
+	addr := make(net.HardwareAddr, 0, len(octets))
+	for _, o := range octets {
+		v, err := strconv.ParseUint(o, 16, 8)
+		if err != nil {
+			return nil, c.opError(opBroadcastAddr, err)
+		}
+
+		addr = append(addr, byte(v))
+	}
+
+	return addr, nil
+}
+
+// linkSpeed reads the link speed of the Conn's interface from sysfs.
+func (c *Conn) linkSpeed() (uint64, error) {
+	ifi, err := net.InterfaceByIndex(c.ifIndex)
+	if err != nil {
+		return 0, c.opError(opLinkSpeed, err)
+	}
+
+	b, err := os.ReadFile(filepath.Join("/sys/class/net", ifi.Name, "speed"))
+	if err != nil {
+		// Interfaces without a notion of link speed (or which are down) return
+		// EINVAL when the attribute is read.
+		if errors.Is(err, unix.EINVAL) {
+			err = ErrLinkSpeedUnknown
+		}
+
+		return 0, c.opError(opLinkSpeed, err)
+	}
+
+	// The kernel reports the speed in Mbps, with -1 (SPEED_UNKNOWN) indicating
+	// that no speed is available. Older kernels print SPEED_UNKNOWN as unsigned.
+	mbps, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, c.opError(opLinkSpeed, err)
+	}
+	if mbps <= 0 || mbps == math.MaxUint32 {
+		return 0, c.opError(opLinkSpeed, ErrLinkSpeedUnknown)
+	}
+
+	return uint64(mbps) * 1000 * 1000, nil
+}
+
+// checkCapabilities implements CheckCapabilities using capget(2).
+func checkCapabilities() error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return os.NewSyscallError("capget", err)
+	}
+
+	has := func(capability int) bool {
+		return data[capability/32].Effective&(1<<(capability%32)) != 0
+	}
+
+	if has(unix.CAP_NET_RAW) {
+		return nil
+	}
+
+	missing := "capability CAP_NET_RAW"
+	if !has(unix.CAP_NET_ADMIN) {
+		missing = "capabilities CAP_NET_RAW and CAP_NET_ADMIN"
+	}
+
+	return fmt.Errorf("packet: missing %s (run as root or grant with setcap): %w",
+		missing, os.ErrPermission)
+}
+
 // listen is the entry point for Listen on Linux.
-func listen(ifi *net.Interface, socketType Type, protocol int, cfg *Config) (*Conn, error) {
+func listen(ifi *net.Interface, socketType Type, protocol int, protocols []int, cfg *Config) (*Conn, error) {
 	if cfg == nil {
 		// Default configuration.
 		cfg = &Config{}
 	}
 
-	// Convert Type to the matching SOCK_* constant.
-	var typ int
-	switch socketType {
-	case Raw:
-		typ = unix.SOCK_RAW
-	case Datagram:
-		typ = unix.SOCK_DGRAM
-	default:
-		return nil, errors.New("packet: invalid Type value")
+	typ, prefix, err := checkConfig(socketType, protocol, protocols, ifi.HardwareAddr, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn *Conn
+	for attempt := 1; ; attempt++ {
+		conn, err = listenSocket(ifi.Index, typ, protocol, prefix, cfg)
+		if err == nil || !cfg.ListenRetry.wait(attempt, err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.typ = socketType
+
+	if cfg.OnInterfaceRemoved != nil || cfg.CloseOnInterfaceRemoved {
+		conn.monitor, err = newLinkMonitor()
+		if err != nil {
+			_ = conn.c.Close()
+			return nil, err
+		}
+
+		// Start watching only once conn is fully initialized, since the
+		// callback may close it.
+		go conn.monitor.watch(ifi.Index, func() {
+			if cfg.CloseOnInterfaceRemoved {
+				_ = conn.Close()
+			}
+			if cfg.OnInterfaceRemoved != nil {
+				cfg.OnInterfaceRemoved()
+			}
+		}, conn.names.invalidate)
 	}
 
+	return conn, nil
+}
+
+// newSocket opens a packet socket of the specified SOCK_* type. Tests may
+// replace it to simulate socket(2) failures.
+var newSocket = func(typ int) (conn, error) {
 	// Protocol is intentionally zero in call to socket(2); we can set it on
 	// bind(2) instead. Package raw notes: "Do not specify a protocol to avoid
 	// capturing packets which to not match cfg.Filter."
@@ -123,7 +1145,17 @@ func listen(ifi *net.Interface, socketType Type, protocol int, cfg *Config) (*Co
 		return nil, err
 	}
 
-	conn, err := bind(c, ifi.Index, protocol, cfg)
+	return c, nil
+}
+
+// listenSocket makes a single attempt to open and bind a socket for listen.
+func listenSocket(ifIndex, typ, protocol int, prefix []bpf.RawInstruction, cfg *Config) (*Conn, error) {
+	c, err := newSocket(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := bind(c, ifIndex, protocol, prefix, cfg)
 	if err != nil {
 		_ = c.Close()
 		return nil, err
@@ -132,11 +1164,158 @@ func listen(ifi *net.Interface, socketType Type, protocol int, cfg *Config) (*Co
 	return conn, nil
 }
 
-// bind binds the *socket.Conn to finalize *Conn setup.
-func bind(c *socket.Conn, ifIndex, protocol int, cfg *Config) (*Conn, error) {
-	if len(cfg.Filter) > 0 {
+// wait reports whether listen should make another attempt after attempt
+// failed with err, and if so, sleeps for the backoff before returning.
+func (r *ListenRetry) wait(attempt int, err error) bool {
+	if r == nil || attempt >= r.Attempts || !isTransientListenError(err) {
+		return false
+	}
+
+	time.Sleep(r.backoff(attempt))
+	return true
+}
+
+// backoff returns the delay after attempt failed, doubling Backoff for each
+// attempt after the first but saturating rather than overflowing.
+func (r *ListenRetry) backoff(attempt int) time.Duration {
+	d := r.Backoff
+	for i := 1; i < attempt && d > 0; i++ {
+		if d > math.MaxInt64/2 {
+			return math.MaxInt64
+		}
+		d *= 2
+	}
+
+	return d
+}
+
+// isTransientListenError reports whether err is an error from socket(2) or
+// bind(2) which may not occur if the call is retried.
+func isTransientListenError(err error) bool {
+	for _, errno := range []unix.Errno{unix.EAGAIN, unix.ENOBUFS, unix.ENOMEM, unix.EMFILE, unix.ENFILE} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateConfig implements ValidateConfig.
+func validateConfig(socketType Type, protocol int, cfg *Config) error {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	// The interface is not known, so assume an Ethernet address for filters
+	// which match it.
+	_, _, err := checkConfig(socketType, protocol, nil, make(net.HardwareAddr, 6), cfg)
+	return err
+}
+
+// checkConfig validates the arguments to listen which can be checked without
+// opening a socket. It returns the SOCK_* constant for socketType and any
+// filter which the Config requires in addition to cfg.Filter.
+func checkConfig(socketType Type, protocol int, protocols []int, mac net.HardwareAddr, cfg *Config) (int, []bpf.RawInstruction, error) {
+	// Convert Type to the matching SOCK_* constant.
+	var typ int
+	switch socketType {
+	case Raw:
+		typ = unix.SOCK_RAW
+	case Datagram:
+		typ = unix.SOCK_DGRAM
+	default:
+		return 0, nil, errors.New("packet: invalid Type value")
+	}
+
+	if _, err := htons(protocol); err != nil {
+		return 0, nil, err
+	}
+
+	switch cfg.Direction {
+	case DirectionInOut, DirectionIn, DirectionOut:
+	default:
+		return 0, nil, errors.New("packet: invalid Direction value")
+	}
+
+	if cfg.VnetHdr && socketType != Raw {
+		return 0, nil, errors.New("packet: VnetHdr is only supported by Raw Conns")
+	}
+
+	if cfg.StrictSourceMAC && (socketType != Raw || len(mac) != 6) {
+		return 0, nil, errors.New("packet: StrictSourceMAC is only supported by Raw Conns on Ethernet interfaces")
+	}
+
+	if f := cfg.Fanout; f != nil {
+		switch f.Type {
+		case FanoutHash, FanoutLB, FanoutCPU, FanoutRollover, FanoutRandom, FanoutQM, FanoutEBPF:
+		default:
+			return 0, nil, errors.New("packet: invalid FanoutType value")
+		}
+
+		if f.UniqueID && f.GroupID != 0 {
+			return 0, nil, errors.New("packet: fanout GroupID must be zero when UniqueID is set")
+		}
+	}
+
+	prefix, err := cfg.filterPrefix(socketType, mac)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(protocols) > 0 {
+		pp, err := protocolsPrefix(socketType, protocols)
+		if err != nil {
+			return 0, nil, err
+		}
+		prefix = append(prefix, pp...)
+	}
+
+	if err := checkFilterLen(composeFilter(prefix, cfg.Filter)); err != nil {
+		return 0, nil, err
+	}
+
+	return typ, prefix, nil
+}
+
+// bind binds the conn to finalize *Conn setup.
+func bind(c conn, ifIndex, protocol int, prefix []bpf.RawInstruction, cfg *Config) (*Conn, error) {
+	filter := composeFilter(prefix, cfg.Filter)
+	if len(filter) > 0 && !cfg.FilterAfterBind {
 		// The caller wants to apply a BPF filter before bind(2).
-		if err := c.SetBPF(cfg.Filter); err != nil {
+		if err := c.SetBPF(filter); err != nil {
+			return nil, err
+		}
+	}
+
+	// Outgoing frames are captured by default, and DirectionOut is implemented
+	// by the filter prefix. checkConfig has already validated Direction.
+	if cfg.Direction == DirectionIn {
+		if err := c.SetsockoptInt(unix.SOL_PACKET, unix.PACKET_IGNORE_OUTGOING, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.VnetHdr {
+		if err := c.SetsockoptInt(unix.SOL_PACKET, unix.PACKET_VNET_HDR, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.OriginalDevice {
+		if err := c.SetsockoptInt(unix.SOL_PACKET, unix.PACKET_ORIGDEV, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	var auxdataState uint32
+	if cfg.Auxdata {
+		err := c.SetsockoptInt(unix.SOL_PACKET, unix.PACKET_AUXDATA, 1)
+		switch {
+		case errors.Is(err, unix.ENOPROTOOPT):
+			// The kernel does not support PACKET_AUXDATA, so reads will
+			// return zero-valued Auxdata.
+			auxdataState = auxdataUnavailable
+		case err != nil:
 			return nil, err
 		}
 	}
@@ -147,16 +1326,72 @@ func bind(c *socket.Conn, ifIndex, protocol int, cfg *Config) (*Conn, error) {
 		return nil, err
 	}
 
-	// TODO(mdlayher): investigate the possibility of sll_ifindex = 0 because we
-	// could bind to any interface.
+	// sll_ifindex = 0 binds to all interfaces.
 	err = c.Bind(&unix.SockaddrLinklayer{
 		Protocol: pnet,
 		Ifindex:  ifIndex,
 	})
-	if err != nil {
+	switch {
+	case errors.Is(err, unix.ENODEV), errors.Is(err, unix.EADDRNOTAVAIL):
+		// The interface no longer exists, so let the caller know it may
+		// look the interface up again and retry.
+		return nil, fmt.Errorf("%w: %w", ErrInterfaceUnavailable, err)
+	case err != nil:
 		return nil, err
 	}
 
+	if len(filter) > 0 && cfg.FilterAfterBind {
+		// The caller wants to apply a BPF filter after bind(2), so reject
+		// everything while we discard frames captured in the meantime.
+		if err := c.SetBPF(filterDropAll); err != nil {
+			return nil, err
+		}
+		if _, err := drain(c); err != nil {
+			return nil, err
+		}
+		if err := c.SetBPF(filter); err != nil {
+			return nil, err
+		}
+	}
+
+	if f := cfg.Fanout; f != nil {
+		// The fanout group ID occupies the low 16 bits, and the type and
+		// flags occupy the high 16 bits.
+		typ := uint32(f.Type)
+		if f.Defrag {
+			typ |= unix.PACKET_FANOUT_FLAG_DEFRAG
+		}
+		if f.Rollover {
+			typ |= unix.PACKET_FANOUT_FLAG_ROLLOVER
+		}
+		if f.UniqueID {
+			typ |= unix.PACKET_FANOUT_FLAG_UNIQUEID
+		}
+
+		if err := c.SetsockoptInt(unix.SOL_PACKET, unix.PACKET_FANOUT, int(typ<<16|uint32(f.GroupID))); err != nil {
+			return nil, err
+		}
+
+		// The steering program can only be set once the socket has joined
+		// the group.
+		if f.Type == FanoutEBPF {
+			if err := c.SetsockoptInt(unix.SOL_PACKET, unix.PACKET_FANOUT_DATA, f.EBPFProgram); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cfg.Promiscuous {
+		mreq := unix.PacketMreq{
+			Ifindex: int32(ifIndex),
+			Type:    unix.PACKET_MR_PROMISC,
+		}
+
+		if err := c.SetsockoptPacketMreq(unix.SOL_PACKET, unix.PACKET_ADD_MEMBERSHIP, &mreq); err != nil {
+			return nil, err
+		}
+	}
+
 	lsa, err := c.Getsockname()
 	if err != nil {
 		return nil, err
@@ -168,13 +1403,104 @@ func bind(c *socket.Conn, ifIndex, protocol int, cfg *Config) (*Conn, error) {
 	addr := make(net.HardwareAddr, lsall.Halen)
 	copy(addr, lsall.Addr[:])
 
-	return &Conn{
-		c: c,
+	conn := &Conn{
+		c:           c,
+		refs:        new(atomic.Int32),
+		deadlines:   new(deadlines),
+		memberships: new(membershipSet),
+		paused:      new(pauseState),
 
-		addr:     &Addr{HardwareAddr: addr},
+		addr:     &Addr{HardwareAddr: addr, Index: ifIndex},
 		ifIndex:  ifIndex,
 		protocol: pnet,
-	}, nil
+		vnetHdr:  cfg.VnetHdr,
+		auxdata:  cfg.Auxdata,
+		pool:     cfg.BufferPool,
+
+		strictSourceMAC: cfg.StrictSourceMAC,
+		fanout:          cfg.Fanout != nil,
+
+		filterPrefix: prefix,
+	}
+	conn.refs.Store(1)
+	conn.auxdataState.Store(auxdataState)
+
+	if cfg.Promiscuous {
+		conn.memberships.add(Membership{Type: MembershipPromiscuous})
+	}
+
+	if cfg.CumulativeStats {
+		conn.statsTotal = new(cumulativeStats)
+	}
+
+	return conn, nil
+}
+
+// sockname wraps getsockname(2).
+func (c *Conn) sockname() (*Addr, error) {
+	sa, err := c.c.Getsockname()
+	if err != nil {
+		return nil, c.opError(opGetsockname, err)
+	}
+
+	return fromSockaddr(sa), nil
+}
+
+// willEgressInterface reads the interface index bound to the socket using
+// getsockname(2).
+func (c *Conn) willEgressInterface() (int, error) {
+	sa, err := c.c.Getsockname()
+	if err != nil {
+		return 0, c.opError(opGetsockname, err)
+	}
+
+	index := sa.(*unix.SockaddrLinklayer).Ifindex
+	if index == 0 {
+		// packet_snd returns ENXIO for frames with no interface.
+		return 0, c.opError(opGetsockname, os.NewSyscallError("getsockname", unix.ENXIO))
+	}
+
+	return index, nil
+}
+
+// drain discards all frames queued on c without blocking, and returns the
+// number of frames discarded.
+func drain(c conn) (int, error) {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		n    int
+		derr error
+	)
+
+	// MSG_TRUNC causes each frame to be discarded in its entirety even though
+	// our buffer is tiny.
+	b := make([]byte, 1)
+	if err := rc.Control(func(fd uintptr) {
+		for {
+			_, _, derr = unix.Recvfrom(int(fd), b, unix.MSG_DONTWAIT|unix.MSG_TRUNC)
+			switch derr {
+			case nil:
+				n++
+			case unix.EINTR, unix.ENETDOWN:
+				// ENETDOWN is reported once when the interface is down, and
+				// does not prevent draining the queue.
+			case unix.EAGAIN:
+				// Queue is empty.
+				derr = nil
+				return
+			default:
+				return
+			}
+		}
+	}); err != nil {
+		return n, err
+	}
+
+	return n, os.NewSyscallError("recvfrom", derr)
 }
 
 // fromSockaddr converts an opaque unix.Sockaddr to *Addr. If sa is nil, it
@@ -190,6 +1516,10 @@ func fromSockaddr(sa unix.Sockaddr) *Addr {
 		// The syscall already allocated sa; just slice into it with the
 		// appropriate length and type conversion rather than making a copy.
 		HardwareAddr: net.HardwareAddr(sall.Addr[:sall.Halen]),
+		Protocol:     ntohs(sall.Protocol),
+		Index:        sall.Ifindex,
+		HardwareType: sall.Hatype,
+		PacketType:   PacketType(sall.Pkttype),
 	}
 }
 
@@ -221,6 +1551,9 @@ func (c *Conn) toSockaddr(
 		Ifindex:  c.ifIndex,
 		Protocol: c.protocol,
 	}
+	if a.Index != 0 {
+		sa.Ifindex = a.Index
+	}
 
 	// Ensure the input address does not exceed the amount of space available;
 	// for example an IPoIB address is 20 bytes.
@@ -233,16 +1566,3 @@ func (c *Conn) toSockaddr(
 
 	return &sa, nil
 }
-
-// htons converts a short (uint16) from host-to-network byte order.
-func htons(i int) (uint16, error) {
-	if i < 0 || i > math.MaxUint16 {
-		return 0, errors.New("packet: protocol value out of range")
-	}
-
-	// Store as big endian, retrieve as native endian.
-	var b [2]byte
-	binary.BigEndian.PutUint16(b[:], uint16(i))
-
-	return native.Endian.Uint16(b[:]), nil
-}
@@ -8,14 +8,30 @@
 package packet_test
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"math"
 	"net"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unsafe"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/josharian/native"
 	"github.com/mdlayher/packet"
+	"golang.org/x/net/bpf"
 	"golang.org/x/sys/unix"
 )
 
@@ -87,6 +103,3663 @@ func TestConnListen(t *testing.T) {
 	t.Logf("  -     payload: %d bytes", n-header)
 }
 
+func TestConnReadFromVnetHdr(t *testing.T) {
+	ifi := testInterface(t)
+	c := testReceiver(t, ifi, &packet.Config{VnetHdr: true})
+
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	payload := []byte("hello, vnet")
+	testSend(t, ifi, payload)
+
+	b := make([]byte, ifi.MTU)
+	n, vh, _, err := c.ReadFromVnetHdr(b)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+
+	// The virtio_net_hdr must have been stripped from the frame.
+	if et := binary.BigEndian.Uint16(b[12:14]); et != testEtherType {
+		t.Fatalf("unexpected EtherType: %#04x", et)
+	}
+	if got := b[14:n]; string(got) != string(payload) {
+		t.Fatalf("unexpected payload: %q", got)
+	}
+
+	if vh.GSOType != 0 && vh.GSOSize == 0 {
+		t.Fatalf("segmentation offload frame did not report GSO size: %+v", vh)
+	}
+
+	t.Logf("virtio_net_hdr: %+v", *vh)
+}
+
+func TestConnReadFromAuxdata(t *testing.T) {
+	ifi := testInterface(t)
+	c := testReceiver(t, ifi, &packet.Config{Auxdata: true})
+
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	if c.AuxdataDelivered() {
+		t.Fatal("auxdata reported as delivered before any reads")
+	}
+
+	payload := []byte("hello, auxdata")
+	testSend(t, ifi, payload)
+
+	b := make([]byte, ifi.MTU)
+	n, a, _, err := c.ReadFromAuxdata(b)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if !c.AuxdataDelivered() {
+		t.Skip("skipping, kernel did not deliver auxdata")
+	}
+
+	if got := b[14:n]; string(got) != string(payload) {
+		t.Fatalf("unexpected payload: %q", got)
+	}
+	if int(a.Length) != n || int(a.Snaplen) != n {
+		t.Fatalf("unexpected auxdata lengths for %d byte frame: %+v", n, *a)
+	}
+
+	t.Logf("auxdata: %+v", *a)
+}
+
+func TestConnWriteToVnetHdr(t *testing.T) {
+	ifi := testInterface(t)
+	rx := testReceiver(t, ifi, nil)
+	tx := testListen(t, ifi, testEtherType, &packet.Config{VnetHdr: true})
+
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	frame := testEthernetFrame(ifi, []byte("hello, vnet"))
+	n, err := tx.WriteToVnetHdr(frame, &packet.VnetHdr{}, &packet.Addr{HardwareAddr: ethernetBroadcast})
+	if err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+	if n != len(frame) {
+		t.Fatalf("unexpected number of bytes written: %d", n)
+	}
+
+	// The virtio_net_hdr is consumed by the kernel and must not appear on the
+	// wire.
+	b := make([]byte, ifi.MTU)
+	n, _, err = rx.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if diff := cmp.Diff(frame, b[:n]); diff != "" {
+		t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnWriteToVnetHdrNeedsCsum(t *testing.T) {
+	ifi := testVeth(t)
+	peer, err := net.InterfaceByName(ifi.Name + "p")
+	if err != nil {
+		t.Fatalf("failed to get veth peer: %v", err)
+	}
+	for _, name := range []string{ifi.Name, peer.Name} {
+		if out, err := exec.Command("ip", "link", "set", "dev", name, "up").CombinedOutput(); err != nil {
+			t.Fatalf("failed to set %q up: %v: %s", name, err, out)
+		}
+	}
+
+	// veth advertises checksum offload and would deliver the checksum
+	// unfinished to the peer, so have the stack compute it on transmit.
+	testSetTxChecksum(t, ifi, false)
+
+	rx := testListen(t, peer, unix.ETH_P_IP, nil)
+	tx := testListen(t, ifi, unix.ETH_P_IP, &packet.Config{VnetHdr: true})
+
+	// A UDP datagram whose checksum field holds only the pseudo-header sum, as
+	// required for a frame which needs its checksum completed.
+	var (
+		src     = net.IPv4(192, 0, 2, 1).To4()
+		dst     = net.IPv4(192, 0, 2, 2).To4()
+		payload = []byte("hello, checksum")
+		udpLen  = 8 + len(payload)
+	)
+
+	ip := []byte{
+		0x45, 0x00, 0x00, 0x00, // Version, IHL, TOS, total length.
+		0x00, 0x00, 0x00, 0x00, // ID, flags, fragment offset.
+		0x40, unix.IPPROTO_UDP, 0x00, 0x00, // TTL, protocol, checksum.
+	}
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+udpLen))
+	ip = append(append(ip, src...), dst...)
+	binary.BigEndian.PutUint16(ip[10:12], ^testChecksum(ip, 0))
+
+	pseudo := append(append(append([]byte(nil), src...), dst...), 0x00, unix.IPPROTO_UDP)
+	pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(udpLen))
+	seed := testChecksum(pseudo, 0)
+
+	udp := []byte{0xc0, 0x00, 0xc0, 0x01, 0x00, 0x00, 0x00, 0x00}
+	binary.BigEndian.PutUint16(udp[4:6], uint16(udpLen))
+	binary.BigEndian.PutUint16(udp[6:8], seed)
+	udp = append(udp, payload...)
+
+	frame := append([]byte(nil), peer.HardwareAddr...)
+	frame = append(frame, ifi.HardwareAddr...)
+	frame = binary.BigEndian.AppendUint16(frame, unix.ETH_P_IP)
+	frame = append(append(frame, ip...), udp...)
+
+	vh := &packet.VnetHdr{
+		Flags:      packet.VnetHdrFNeedsCsum,
+		CsumStart:  14 + 20,
+		CsumOffset: 6,
+	}
+	if _, err := tx.WriteToVnetHdr(frame, vh, &packet.Addr{HardwareAddr: peer.HardwareAddr}); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	b := make([]byte, peer.MTU+14)
+	for {
+		n, _, err := rx.ReadFrom(b)
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+
+		got := b[:n]
+		if n != len(frame) || !bytes.Equal(got[14+20+8:], payload) {
+			// Some other IPv4 frame.
+			continue
+		}
+
+		// The checksum must have been completed, so that the sum over the
+		// pseudo-header and the datagram is all ones.
+		csum := binary.BigEndian.Uint16(got[14+20+6:])
+		if csum == seed {
+			t.Fatal("UDP checksum was not filled in")
+		}
+		if sum := testChecksum(got[14+20:], uint32(seed)); sum != 0xffff {
+			t.Fatalf("invalid UDP checksum %#04x: sum %#04x", csum, sum)
+		}
+
+		// The remainder of the frame must be unchanged.
+		if diff := cmp.Diff(frame[:14+20+6], got[:14+20+6]); diff != "" {
+			t.Fatalf("unexpected headers (-want +got):\n%s", diff)
+		}
+
+		return
+	}
+}
+
+func TestConnSetPromiscuous(t *testing.T) {
+	c, ifi := testConn(t)
+
+	// A PACKET_MR_PROMISC membership is reflected in the interface's internal
+	// flags, but not in the user-visible IFF_PROMISC flag.
+	if err := c.SetPromiscuous(true); err != nil {
+		t.Fatalf("failed to enable promiscuous mode: %v", err)
+	}
+	if !testSysfsPromiscuous(t, ifi) {
+		t.Fatal("interface is not promiscuous after enabling membership")
+	}
+	if testIfreqPromiscuous(t, ifi) {
+		t.Skipf("skipping, interface %q already has IFF_PROMISC set", ifi.Name)
+	}
+
+	// Closing the Conn releases the membership.
+	if err := c.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if testSysfsPromiscuous(t, ifi) {
+		t.Skipf("skipping, interface %q is promiscuous due to another program", ifi.Name)
+	}
+}
+
+func TestConnSetInterfacePromiscuous(t *testing.T) {
+	c, ifi := testConn(t)
+	if testIfreqPromiscuous(t, ifi) {
+		t.Skipf("skipping, interface %q already has IFF_PROMISC set", ifi.Name)
+	}
+
+	if err := c.SetInterfacePromiscuous(true); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skipf("skipping, permission denied (try setting CAP_NET_ADMIN capability): %v", err)
+		}
+
+		t.Fatalf("failed to set IFF_PROMISC: %v", err)
+	}
+	t.Cleanup(func() { _ = c.SetInterfacePromiscuous(false) })
+
+	if !testIfreqPromiscuous(t, ifi) {
+		t.Fatal("IFF_PROMISC was not set")
+	}
+
+	// Unlike a membership, the flag persists until explicitly cleared.
+	if err := c.SetInterfacePromiscuous(false); err != nil {
+		t.Fatalf("failed to clear IFF_PROMISC: %v", err)
+	}
+	if testIfreqPromiscuous(t, ifi) {
+		t.Fatal("IFF_PROMISC was not cleared")
+	}
+}
+
+func TestConnIncomingNAPIID(t *testing.T) {
+	ifi := testInterface(t)
+	c := testReceiver(t, ifi, nil)
+
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	testSend(t, ifi, []byte("hello, NAPI"))
+	if _, _, err := c.ReadFrom(make([]byte, ifi.MTU)); err != nil {
+		t.Fatalf("failed to read Ethernet frame: %v", err)
+	}
+
+	id, err := c.IncomingNAPIID()
+	if err != nil {
+		t.Fatalf("failed to get NAPI ID: %v", err)
+	}
+	if id == 0 {
+		t.Skipf("skipping, interface %q did not report a NAPI ID", ifi.Name)
+	}
+
+	t.Logf("interface: %q, NAPI ID: %d", ifi.Name, id)
+}
+
+func TestConnFilterAfterBind(t *testing.T) {
+	ifi := testInterface(t)
+
+	filter, err := packet.MatchEtherType(testEtherType).Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+
+	c := testListen(t, ifi, unix.ETH_P_ALL, &packet.Config{
+		Filter:          filter,
+		FilterAfterBind: true,
+	})
+
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	// Send a frame which does not match the filter followed by one which
+	// does. Only the latter may be received.
+	tx := testListen(t, ifi, unix.ETH_P_ALL, nil)
+	frame := testEthernetFrame(ifi, []byte("hello, filter"))
+	binary.BigEndian.PutUint16(frame[12:14], testEtherType+1)
+	if _, err := tx.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+		t.Fatalf("failed to send frame: %v", err)
+	}
+	testSend(t, ifi, []byte("hello, filter"))
+
+	b := make([]byte, ifi.MTU)
+	if _, _, err := c.ReadFrom(b); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if et := binary.BigEndian.Uint16(b[12:14]); et != testEtherType {
+		t.Fatalf("received frame which does not match filter: EtherType %#04x", et)
+	}
+}
+
+func TestConnWriteToAt(t *testing.T) {
+	ifi := testInterface(t)
+	rx := testReceiver(t, ifi, nil)
+	tx := testListen(t, ifi, testEtherType, nil)
+
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	// Without an ETF qdisc the kernel accepts the transmit time but sends the
+	// frame immediately.
+	frame := testEthernetFrame(ifi, []byte("hello, txtime"))
+	when := time.Now().Add(37*time.Second + 10*time.Millisecond)
+	if _, err := tx.WriteToAt(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}, when); err != nil {
+		if errors.Is(err, unix.ENOPROTOOPT) {
+			t.Skipf("skipping, SO_TXTIME is not supported: %v", err)
+		}
+
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	if _, _, err := rx.ReadFrom(make([]byte, ifi.MTU)); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+}
+
+func TestConnLinkSpeed(t *testing.T) {
+	c, ifi := testConn(t)
+
+	speed, err := c.LinkSpeed()
+	if err != nil {
+		if errors.Is(err, packet.ErrLinkSpeedUnknown) {
+			t.Skipf("skipping, interface %q does not report a link speed", ifi.Name)
+		}
+
+		t.Fatalf("failed to get link speed: %v", err)
+	}
+	if speed == 0 {
+		t.Fatal("link speed should be non-zero")
+	}
+
+	t.Logf("interface: %q, link speed: %d bits/s", ifi.Name, speed)
+}
+
+func TestConnOnInterfaceRemoved(t *testing.T) {
+	ifi := testVeth(t)
+
+	removedC := make(chan struct{})
+	c, err := packet.Listen(ifi, packet.Raw, unix.ETH_P_ALL, &packet.Config{
+		OnInterfaceRemoved:      func() { close(removedC) },
+		CloseOnInterfaceRemoved: true,
+	})
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skipf("skipping, permission denied (try setting CAP_NET_RAW capability): %v", err)
+		}
+
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer c.Close()
+
+	// Deleting one end of a veth pair removes both interfaces.
+	if out, err := exec.Command("ip", "link", "del", ifi.Name).CombinedOutput(); err != nil {
+		t.Fatalf("failed to delete veth interface: %v: %s", err, out)
+	}
+
+	select {
+	case <-removedC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for interface removal callback")
+	}
+
+	// The Conn was closed before the callback, so reads fail immediately.
+	if _, _, err := c.ReadFrom(make([]byte, 1)); err == nil {
+		t.Fatal("expected an error reading from closed Conn, but none occurred")
+	}
+}
+
+func TestConnSetBusyPoll(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, nil)
+
+	const usec = 50
+	if err := c.SetBusyPoll(usec); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skipf("skipping, permission denied (try setting CAP_NET_ADMIN capability): %v", err)
+		}
+
+		t.Fatalf("failed to set busy poll: %v", err)
+	}
+
+	rc, err := c.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to get syscall conn: %v", err)
+	}
+
+	var v int
+	if err := rc.Control(func(fd uintptr) {
+		v, err = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BUSY_POLL)
+	}); err != nil {
+		t.Fatalf("failed to control: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("failed to get SO_BUSY_POLL: %v", err)
+	}
+	if v != usec {
+		t.Fatalf("unexpected SO_BUSY_POLL: %d", v)
+	}
+}
+
+func TestConnSetReadLowWater(t *testing.T) {
+	ifi := testInterface(t)
+	c := testReceiver(t, ifi, nil)
+
+	const lowat = 64 * 1024
+	if err := c.SetReadLowWater(lowat); err != nil {
+		t.Fatalf("failed to set read low water: %v", err)
+	}
+
+	rc, err := c.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to get syscall conn: %v", err)
+	}
+
+	var v int
+	if err := rc.Control(func(fd uintptr) {
+		v, err = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVLOWAT)
+	}); err != nil {
+		t.Fatalf("failed to control: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("failed to get SO_RCVLOWAT: %v", err)
+	}
+	if v != lowat {
+		t.Fatalf("unexpected SO_RCVLOWAT: %d", v)
+	}
+
+	// Packet sockets do not honor SO_RCVLOWAT, so a single small frame still
+	// wakes the read.
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	testSend(t, ifi, []byte("hello, lowat"))
+
+	if _, _, err := c.ReadFrom(make([]byte, ifi.MTU)); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+}
+
+func TestConnSetNoFCS(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, nil)
+
+	if err := c.SetNoFCS(true); err != nil {
+		t.Fatalf("failed to enable SO_NOFCS: %v", err)
+	}
+
+	// Append a bogus FCS. Whether it reaches the wire depends on the driver,
+	// so only check that the write is either accepted or rejected as
+	// unsupported.
+	frame := append(testEthernetFrame(ifi, []byte("hello, FCS")), 0xde, 0xad, 0xbe, 0xef)
+	_, err := c.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast})
+	switch {
+	case errors.Is(err, unix.EPROTONOSUPPORT):
+		t.Logf("SO_NOFCS not supported by %q driver", ifi.Name)
+	case err != nil:
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	if err := c.SetNoFCS(false); err != nil {
+		t.Fatalf("failed to disable SO_NOFCS: %v", err)
+	}
+	if _, err := c.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+}
+
+func TestConnReadFromProtocol(t *testing.T) {
+	const otherEtherType = testEtherType + 1
+	filter, err := packet.MatchEtherType(testEtherType).
+		Or(packet.MatchEtherType(otherEtherType)).
+		Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+
+	ifi := testInterface(t)
+	rx := testListen(t, ifi, unix.ETH_P_ALL, &packet.Config{Filter: filter})
+
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	for _, et := range []uint16{testEtherType, otherEtherType} {
+		// Outgoing frames report the protocol of the sending socket.
+		tx := testListen(t, ifi, int(et), nil)
+
+		frame := testEthernetFrame(ifi, []byte("hello, protocol"))
+		binary.BigEndian.PutUint16(frame[12:14], et)
+		if _, err := tx.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+			t.Fatalf("failed to write frame: %v", err)
+		}
+
+		b := make([]byte, ifi.MTU)
+		_, addr, err := rx.ReadFrom(b)
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+
+		// The protocol reported by the kernel must match the frame's EtherType.
+		got := addr.(*packet.Addr).Protocol
+		if want := binary.BigEndian.Uint16(b[12:14]); got != want || got != et {
+			t.Fatalf("unexpected protocol: %#04x, frame EtherType: %#04x", got, want)
+		}
+	}
+}
+
+func TestConnInterfaceName(t *testing.T) {
+	ifi := testVeth(t)
+
+	// The interface removal monitor also invalidates cached names.
+	c := testListen(t, ifi, unix.ETH_P_ALL, &packet.Config{
+		OnInterfaceRemoved: func() {},
+	})
+
+	name, err := c.InterfaceName(ifi.Index)
+	if err != nil {
+		t.Fatalf("failed to get interface name: %v", err)
+	}
+	if name != ifi.Name {
+		t.Fatalf("unexpected interface name: %q", name)
+	}
+
+	const rename = "pkttest1"
+	if out, err := exec.Command("ip", "link", "set", "dev", ifi.Name, "name", rename).CombinedOutput(); err != nil {
+		t.Fatalf("failed to rename veth interface: %v: %s", err, out)
+	}
+
+	// Notifications are asynchronous, so poll until the new name is observed.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		name, err := c.InterfaceName(ifi.Index)
+		if err != nil {
+			t.Fatalf("failed to get interface name: %v", err)
+		}
+		if name == rename {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for renamed interface, got: %q", name)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnSeteBPF(t *testing.T) {
+	ifi := testInterface(t)
+	rx := testReceiver(t, ifi, nil)
+
+	prog := testLoadeBPF(t, 0xffffffff)
+	if err := rx.SeteBPF(prog); err != nil {
+		t.Fatalf("failed to attach eBPF program: %v", err)
+	}
+	// The socket holds its own reference to the program.
+	_ = unix.Close(prog)
+
+	// The eBPF program replaces the receiver's classic BPF filter, so skip any
+	// unrelated frames while waiting for ours.
+	payload := []byte("hello, eBPF")
+	testSend(t, ifi, payload)
+
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	want := testEthernetFrame(ifi, payload)
+	b := make([]byte, ifi.MTU)
+	for {
+		n, _, err := rx.ReadFrom(b)
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		if cmp.Equal(want, b[:n]) {
+			break
+		}
+	}
+
+	if err := rx.RemoveeBPF(); err != nil {
+		t.Fatalf("failed to remove eBPF program: %v", err)
+	}
+	if err := rx.RemoveeBPF(); !errors.Is(err, unix.ENOENT) {
+		t.Fatalf("expected ENOENT removing program twice, but got: %v", err)
+	}
+}
+
+func TestListenInterfaceUnavailable(t *testing.T) {
+	// Look up an interface and then remove it before calling Listen.
+	ifi := testVeth(t)
+	if out, err := exec.Command("ip", "link", "del", ifi.Name).CombinedOutput(); err != nil {
+		t.Fatalf("failed to delete veth interface: %v: %s", err, out)
+	}
+
+	_, err := packet.Listen(ifi, packet.Raw, testEtherType, nil)
+	if !errors.Is(err, packet.ErrInterfaceUnavailable) {
+		t.Fatalf("expected ErrInterfaceUnavailable, but got: %v", err)
+	}
+}
+
+func TestListenMulti(t *testing.T) {
+	if runtime.NumCPU() < 2 {
+		t.Skip("skipping, MultiConn test requires at least 2 CPUs")
+	}
+
+	ifi := testInterface(t)
+	filter, err := packet.MatchEtherType(testEtherType).Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+
+	// Load balance frames so that each Conn deterministically receives a
+	// share, regardless of which CPU processes them.
+	m, err := packet.ListenMulti(ifi, packet.Raw, unix.ETH_P_ALL, []int{0, 1}, 16, &packet.Config{
+		Filter: filter,
+		Fanout: &packet.FanoutConfig{GroupID: 0xbeef, Type: packet.FanoutLB},
+	})
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) || errors.Is(err, unix.EINVAL) {
+			t.Skipf("skipping, failed to listen on pinned CPUs: %v", err)
+		}
+
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer m.Close()
+
+	const sent = 8
+	tx := testListen(t, ifi, testEtherType, nil)
+	for i := 0; i < sent; i++ {
+		if _, err := tx.WriteTo(testEthernetFrame(ifi, []byte("hello, multi")), &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+			t.Fatalf("failed to write frame: %v", err)
+		}
+	}
+
+	counts := make([]int, len(m.Conns()))
+	timeout := time.After(5 * time.Second)
+	for n := 0; n < sent; n++ {
+		select {
+		case <-m.Frames(0):
+			counts[0]++
+		case <-m.Frames(1):
+			counts[1]++
+		case <-timeout:
+			t.Fatalf("timed out waiting for frames, received: %v", counts)
+		}
+	}
+
+	if diff := cmp.Diff([]int{sent / 2, sent / 2}, counts); diff != "" {
+		t.Fatalf("unexpected frames per Conn (-want +got):\n%s", diff)
+	}
+}
+
+func TestListenMultiUniqueFanout(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *packet.Config
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "UniqueID",
+			cfg: &packet.Config{
+				Fanout: &packet.FanoutConfig{Type: packet.FanoutLB, UniqueID: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Pinning all readers to the same CPU suffices to check group
+			// membership.
+			ifi := testInterface(t)
+			m, err := packet.ListenMulti(ifi, packet.Raw, testEtherType, []int{0, 0, 0}, 16, tt.cfg)
+			if err != nil {
+				if errors.Is(err, os.ErrPermission) || errors.Is(err, unix.EINVAL) {
+					t.Skipf("skipping, failed to listen on pinned CPUs: %v", err)
+				}
+
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer m.Close()
+
+			// All Conns joined the group allocated by the kernel for the
+			// first.
+			var ids []uint16
+			for _, c := range m.Conns() {
+				id, ok, err := c.FanoutGroupID()
+				if err != nil {
+					t.Fatalf("failed to get fanout group ID: %v", err)
+				}
+				if !ok {
+					t.Fatal("Conn is not a member of a fanout group")
+				}
+				ids = append(ids, id)
+			}
+
+			if diff := cmp.Diff([]uint16{ids[0], ids[0], ids[0]}, ids); diff != "" {
+				t.Fatalf("Conns joined different fanout groups (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConnSockname(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, nil)
+
+	addr, err := c.Sockname()
+	if err != nil {
+		t.Fatalf("failed to get sockname: %v", err)
+	}
+
+	// The kernel reports the interface's ARPHRD_* type in sysfs.
+	b, err := os.ReadFile(filepath.Join("/sys/class/net", ifi.Name, "type"))
+	if err != nil {
+		t.Fatalf("failed to read interface type: %v", err)
+	}
+	hatype, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 16)
+	if err != nil {
+		t.Fatalf("failed to parse interface type: %v", err)
+	}
+
+	want := &packet.Addr{
+		HardwareAddr: ifi.HardwareAddr,
+		Protocol:     testEtherType,
+		Index:        ifi.Index,
+		HardwareType: uint16(hatype),
+	}
+	if diff := cmp.Diff(want, addr); diff != "" {
+		t.Fatalf("unexpected sockname (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnPacketTypeTap(t *testing.T) {
+	a := testVeth(t)
+	b, err := net.InterfaceByName(a.Name + "p")
+	if err != nil {
+		t.Fatalf("failed to get veth peer: %v", err)
+	}
+	for _, ifi := range []*net.Interface{a, b} {
+		if out, err := exec.Command("ip", "link", "set", "dev", ifi.Name, "up").CombinedOutput(); err != nil {
+			t.Fatalf("failed to bring up veth interface: %v: %s", err, out)
+		}
+	}
+
+	// The tap captures in both directions on a.
+	tap := testReceiver(t, a, &packet.Config{Direction: packet.DirectionInOut})
+	if err := tap.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	// One frame is received by a from its peer, and the other is sent by a.
+	testSend(t, b, []byte("incoming"))
+	testSend(t, a, []byte("outgoing"))
+
+	got := make(map[string]packet.PacketType)
+	buf := make([]byte, a.MTU)
+	for len(got) < 2 {
+		n, addr, err := tap.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+
+		got[string(buf[14:n])] = addr.(*packet.Addr).PacketType
+	}
+
+	want := map[string]packet.PacketType{
+		"incoming": packet.PacketBroadcast,
+		"outgoing": packet.PacketOutgoing,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected packet types (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnWriteFrame(t *testing.T) {
+	ifi := testInterface(t)
+	rx := testReceiver(t, ifi, nil)
+	tx := testListen(t, ifi, testEtherType, nil)
+
+	payload := []byte("hello, frame")
+	n, err := tx.WriteFrame(ethernetBroadcast, testEtherType, payload)
+	if err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	// testEthernetFrame uses the interface's address as the source address.
+	want := testEthernetFrame(ifi, payload)
+	if n != len(want) {
+		t.Fatalf("unexpected number of bytes written: %d", n)
+	}
+
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	b := make([]byte, ifi.MTU)
+	n, _, err = rx.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if diff := cmp.Diff(want, b[:n]); diff != "" {
+		t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+	}
+
+	// Conns which are not bound to an interface have no source address.
+	all, err := packet.ListenAll(packet.Raw, testEtherType, nil)
+	if err != nil {
+		t.Fatalf("failed to listen on all interfaces: %v", err)
+	}
+	defer all.Close()
+
+	if _, err := all.WriteFrame(ethernetBroadcast, testEtherType, payload); err == nil {
+		t.Fatal("expected an error writing frame without a source address, but none occurred")
+	}
+}
+
+func TestConnMaxReadRate(t *testing.T) {
+	const (
+		rate = 50
+		sent = 30
+	)
+
+	ifi := testInterface(t)
+
+	t.Run("wait", func(t *testing.T) {
+		rx := testReceiver(t, ifi, &packet.Config{MaxReadRate: rate})
+		tx := testListen(t, ifi, testEtherType, nil)
+		for i := 0; i < sent; i++ {
+			if _, err := tx.WriteTo(testEthernetFrame(ifi, []byte("hello, rate")), &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+				t.Fatalf("failed to write frame: %v", err)
+			}
+		}
+
+		if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatalf("failed to set read deadline: %v", err)
+		}
+
+		start := time.Now()
+		b := make([]byte, ifi.MTU)
+		for i := 0; i < sent; i++ {
+			if _, _, err := rx.ReadFrom(b); err != nil {
+				t.Fatalf("failed to read frame %d: %v", i, err)
+			}
+		}
+
+		// All frames are delivered, but no faster than the rate permits
+		// after the initial burst of one frame.
+		elapsed := time.Since(start)
+		want := time.Duration(sent-1) * time.Second / rate
+		if elapsed < want*9/10 || elapsed > 2*want {
+			t.Fatalf("unexpected read duration for %d frames at %d/s: %v", sent, rate, elapsed)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		rx := testReceiver(t, ifi, &packet.Config{MaxReadRate: rate, MaxReadRateDrop: true})
+		tx := testListen(t, ifi, testEtherType, nil)
+		for i := 0; i < sent; i++ {
+			if _, err := tx.WriteTo(testEthernetFrame(ifi, []byte("hello, rate")), &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+				t.Fatalf("failed to write frame: %v", err)
+			}
+		}
+
+		if err := rx.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+			t.Fatalf("failed to set read deadline: %v", err)
+		}
+
+		// Frames which arrive faster than the rate are discarded.
+		var n int
+		b := make([]byte, ifi.MTU)
+		for {
+			if _, _, err := rx.ReadFrom(b); err != nil {
+				if !errors.Is(err, os.ErrDeadlineExceeded) {
+					t.Fatalf("failed to read: %v", err)
+				}
+				break
+			}
+			n++
+		}
+		if n == 0 || n > sent/2 {
+			t.Fatalf("unexpected number of frames delivered: %d of %d", n, sent)
+		}
+	})
+}
+
+func TestConnMaxPackets(t *testing.T) {
+	const limit = 3
+
+	ifi := testInterface(t)
+	rx := testReceiver(t, ifi, &packet.Config{MaxPackets: limit})
+	tx := testListen(t, ifi, testEtherType, nil)
+
+	// Send more frames than the Conn will read.
+	for i := 0; i < limit+1; i++ {
+		if _, err := tx.WriteTo(testEthernetFrame(ifi, []byte("hello, max")), &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+			t.Fatalf("failed to write frame: %v", err)
+		}
+	}
+
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	b := make([]byte, ifi.MTU)
+	for i := 0; i < limit; i++ {
+		if _, _, err := rx.ReadFrom(b); err != nil {
+			t.Fatalf("failed to read frame %d: %v", i, err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := rx.ReadFrom(b); !errors.Is(err, packet.ErrCaptureComplete) {
+			t.Fatalf("expected ErrCaptureComplete, but got: %v", err)
+		}
+	}
+}
+
+func TestConnPHCIndex(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, nil)
+
+	index, err := c.PHCIndex()
+	if err != nil {
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			t.Skipf("skipping, interface %q does not report timestamping info: %v", ifi.Name, err)
+		}
+
+		t.Fatalf("failed to get PHC index: %v", err)
+	}
+	if index == -1 {
+		t.Skipf("skipping, interface %q has no PTP hardware clock", ifi.Name)
+	}
+
+	// The PHC must be registered with the kernel's PTP subsystem.
+	if _, err := os.Stat(filepath.Join("/sys/class/ptp", "ptp"+strconv.Itoa(index))); err != nil {
+		t.Fatalf("failed to find PTP hardware clock %d: %v", index, err)
+	}
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	// Compare against the effective capabilities reported by procfs.
+	b, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		t.Skipf("skipping, failed to read process status: %v", err)
+	}
+
+	var capEff uint64
+	for _, line := range strings.Split(string(b), "\n") {
+		if v, ok := strings.CutPrefix(line, "CapEff:"); ok {
+			capEff, err = strconv.ParseUint(strings.TrimSpace(v), 16, 64)
+			if err != nil {
+				t.Fatalf("failed to parse CapEff: %v", err)
+			}
+		}
+	}
+
+	err = packet.CheckCapabilities()
+	if capEff&(1<<unix.CAP_NET_RAW) != 0 {
+		if err != nil {
+			t.Fatalf("failed to check capabilities with CAP_NET_RAW: %v", err)
+		}
+		return
+	}
+
+	if !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("expected permission error without CAP_NET_RAW, but got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "CAP_NET_RAW") {
+		t.Fatalf("error does not mention CAP_NET_RAW: %v", err)
+	}
+}
+
+func TestConnProbe(t *testing.T) {
+	a := testVeth(t)
+	b, err := net.InterfaceByName(a.Name + "p")
+	if err != nil {
+		t.Fatalf("failed to get veth peer: %v", err)
+	}
+	for _, ifi := range []*net.Interface{a, b} {
+		if out, err := exec.Command("ip", "link", "set", "dev", ifi.Name, "up").CombinedOutput(); err != nil {
+			t.Fatalf("failed to bring up veth interface: %v: %s", err, out)
+		}
+	}
+
+	// The prober captures in both directions so that it also sees its own
+	// probe, which Probe must ignore.
+	prober := testReceiver(t, a, nil)
+	echo := testListen(t, b, testEtherType, nil)
+
+	// The echoer swaps the addresses of a single probe and sends it back.
+	errC := make(chan error, 1)
+	go func() {
+		if err := echo.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			errC <- err
+			return
+		}
+
+		buf := make([]byte, b.MTU)
+		n, _, err := echo.ReadFrom(buf)
+		if err != nil {
+			errC <- err
+			return
+		}
+
+		reply := append([]byte(nil), buf[:n]...)
+		copy(reply[0:6], buf[6:12])
+		copy(reply[6:12], b.HardwareAddr)
+		_, err = echo.WriteTo(reply, &packet.Addr{HardwareAddr: reply[0:6]})
+		errC <- err
+	}()
+
+	probe := testEthernetFrame(a, []byte("hello, probe"))
+	rtt, err := prober.Probe(probe, &packet.Addr{HardwareAddr: ethernetBroadcast}, func(frame []byte) bool {
+		return bytes.Equal(frame[6:12], b.HardwareAddr)
+	}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to probe: %v", err)
+	}
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to echo probe: %v", err)
+	}
+
+	if rtt <= 0 || rtt > 5*time.Second {
+		t.Fatalf("implausible round trip time: %v", rtt)
+	}
+
+	// Without an echo, the probe times out.
+	_, err = prober.Probe(probe, &packet.Addr{HardwareAddr: ethernetBroadcast}, func(frame []byte) bool {
+		return bytes.Equal(frame[6:12], b.HardwareAddr)
+	}, 100*time.Millisecond)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected timeout, but got: %v", err)
+	}
+}
+
+func TestConnWriteToSignals(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, nil)
+
+	// Deliver a steady stream of signals to the process while writing so that
+	// sends are interrupted.
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, unix.SIGUSR1)
+	defer signal.Stop(sigC)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigC:
+			default:
+				_ = unix.Kill(os.Getpid(), unix.SIGUSR1)
+			}
+		}
+	}()
+
+	if err := c.SetWriteDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set write deadline: %v", err)
+	}
+
+	frame := testEthernetFrame(ifi, []byte("hello, signals"))
+	addr := &packet.Addr{HardwareAddr: ethernetBroadcast}
+	for i := 0; i < 1000; i++ {
+		if _, err := c.WriteTo(frame, addr); err != nil {
+			t.Fatalf("failed to write frame %d: %v", i, err)
+		}
+
+		_, err := c.WriteToFlags(frame, addr, unix.MSG_DONTWAIT)
+		if err != nil && !errors.Is(err, unix.EAGAIN) && !errors.Is(err, unix.ENOBUFS) {
+			t.Fatalf("failed to write non-blocking frame %d: %v", i, err)
+		}
+	}
+}
+
+func TestConnDeadlines(t *testing.T) {
+	c := testListen(t, testInterface(t), testEtherType, nil)
+
+	if !c.ReadDeadline().IsZero() || !c.WriteDeadline().IsZero() {
+		t.Fatalf("expected no initial deadlines, but got read: %v, write: %v",
+			c.ReadDeadline(), c.WriteDeadline())
+	}
+
+	var (
+		both  = time.Now().Add(1 * time.Hour)
+		read  = both.Add(1 * time.Minute)
+		write = both.Add(2 * time.Minute)
+	)
+
+	if err := c.SetDeadline(both); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+	if !c.ReadDeadline().Equal(both) || !c.WriteDeadline().Equal(both) {
+		t.Fatalf("unexpected deadlines after SetDeadline, read: %v, write: %v",
+			c.ReadDeadline(), c.WriteDeadline())
+	}
+
+	if err := c.SetReadDeadline(read); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	if err := c.SetWriteDeadline(write); err != nil {
+		t.Fatalf("failed to set write deadline: %v", err)
+	}
+
+	// Conns created by Ref share the socket and therefore its deadlines.
+	r := c.Ref()
+	defer r.Close()
+
+	for _, conn := range []*packet.Conn{c, r} {
+		if !conn.ReadDeadline().Equal(read) {
+			t.Fatalf("unexpected read deadline: %v, want: %v", conn.ReadDeadline(), read)
+		}
+		if !conn.WriteDeadline().Equal(write) {
+			t.Fatalf("unexpected write deadline: %v, want: %v", conn.WriteDeadline(), write)
+		}
+	}
+
+	if err := r.SetDeadline(time.Time{}); err != nil {
+		t.Fatalf("failed to clear deadline: %v", err)
+	}
+	if !c.ReadDeadline().IsZero() || !c.WriteDeadline().IsZero() {
+		t.Fatalf("expected cleared deadlines, but got read: %v, write: %v",
+			c.ReadDeadline(), c.WriteDeadline())
+	}
+}
+
+func TestConnFanoutUniqueID(t *testing.T) {
+	ifi := testInterface(t)
+
+	first, err := packet.Listen(ifi, packet.Raw, int(testEtherType), &packet.Config{
+		Fanout: &packet.FanoutConfig{Type: packet.FanoutHash, UniqueID: true},
+	})
+	if err != nil {
+		if errors.Is(err, unix.EINVAL) {
+			t.Skipf("skipping, kernel does not support unique fanout IDs: %v", err)
+		}
+
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer first.Close()
+
+	id, ok, err := first.FanoutGroupID()
+	if err != nil {
+		t.Fatalf("failed to get fanout group ID: %v", err)
+	}
+	if !ok {
+		t.Fatal("Conn is not a member of a fanout group")
+	}
+
+	// Join the group using the allocated ID, which may be zero. Joining with
+	// the ID of a group which does not exist would create a new group, so
+	// verify that the group exists by ensuring a mismatched type is rejected.
+	if _, err := packet.Listen(ifi, packet.Raw, int(testEtherType), &packet.Config{
+		Fanout: &packet.FanoutConfig{GroupID: id, Type: packet.FanoutLB},
+	}); !errors.Is(err, unix.EINVAL) {
+		t.Fatalf("expected EINVAL joining group with mismatched type, but got: %v", err)
+	}
+
+	second := testListen(t, ifi, testEtherType, &packet.Config{
+		Fanout: &packet.FanoutConfig{GroupID: id, Type: packet.FanoutHash},
+	})
+
+	got, ok, err := second.FanoutGroupID()
+	if err != nil {
+		t.Fatalf("failed to get fanout group ID: %v", err)
+	}
+	if !ok {
+		t.Fatal("Conn is not a member of a fanout group")
+	}
+	if diff := cmp.Diff(id, got); diff != "" {
+		t.Fatalf("unexpected fanout group ID (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnFanoutGroupIDNotMember(t *testing.T) {
+	ifi := testInterface(t)
+
+	// A member of group zero using FanoutHash is indistinguishable from a
+	// non-member in the value reported by the kernel.
+	member := testListen(t, ifi, testEtherType, &packet.Config{
+		Fanout: &packet.FanoutConfig{GroupID: 0, Type: packet.FanoutHash},
+	})
+	if id, ok, err := member.FanoutGroupID(); err != nil || !ok || id != 0 {
+		t.Fatalf("unexpected fanout group for member: %d, %v, %v", id, ok, err)
+	}
+
+	c := testListen(t, ifi, testEtherType, nil)
+	if id, ok, err := c.FanoutGroupID(); err != nil || ok || id != 0 {
+		t.Fatalf("unexpected fanout group for non-member: %d, %v, %v", id, ok, err)
+	}
+}
+
+func TestConnSwapReadBuffer(t *testing.T) {
+	ifi := testInterface(t)
+	c := testReceiver(t, ifi, nil)
+
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	// The first call primes the Conn with a buffer and does not read.
+	bufs := [2][]byte{make([]byte, ifi.MTU), make([]byte, ifi.MTU)}
+	old, n, err := c.SwapReadBuffer(bufs[0])
+	if err != nil {
+		t.Fatalf("failed to prime read buffer: %v", err)
+	}
+	if old != nil || n != 0 {
+		t.Fatalf("unexpected result from priming: %d bytes, %v", n, old)
+	}
+
+	// Write all frames up front, then alternate between the two buffers while
+	// a separate goroutine consumes each filled buffer.
+	const frames = 32
+	for i := 0; i < frames; i++ {
+		testSend(t, ifi, []byte("frame "+strconv.Itoa(i)))
+	}
+
+	type filled struct {
+		b []byte
+		n int
+	}
+
+	var (
+		fillC = make(chan filled)
+		doneC = make(chan []string)
+	)
+
+	go func() {
+		var got []string
+		for f := range fillC {
+			// Skip the Ethernet header to retrieve the payload.
+			got = append(got, string(bytes.TrimRight(f.b[14:f.n], "\x00")))
+		}
+		doneC <- got
+	}()
+
+	for i := 0; i < frames; i++ {
+		// The filled buffer is passed back to the Conn on the next swap, so
+		// hand a copy to the consumer.
+		old, n, err := c.SwapReadBuffer(bufs[(i+1)%2])
+		if err != nil {
+			t.Fatalf("failed to swap read buffer %d: %v", i, err)
+		}
+		if &old[0] != &bufs[i%2][0] {
+			t.Fatalf("swap %d returned an unexpected buffer", i)
+		}
+
+		fillC <- filled{b: append([]byte(nil), old[:n]...), n: n}
+	}
+	close(fillC)
+
+	want := make([]string, 0, frames)
+	for i := 0; i < frames; i++ {
+		want = append(want, "frame "+strconv.Itoa(i))
+	}
+
+	if diff := cmp.Diff(want, <-doneC); diff != "" {
+		t.Fatalf("unexpected frames (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnBroadcastAddr(t *testing.T) {
+	c := testListen(t, testInterface(t), testEtherType, nil)
+
+	addr, err := c.BroadcastAddr()
+	if err != nil {
+		t.Fatalf("failed to get broadcast address: %v", err)
+	}
+
+	if diff := cmp.Diff(ethernetBroadcast, addr); diff != "" {
+		t.Fatalf("unexpected broadcast address (-want +got):\n%s", diff)
+	}
+
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("skipping, no loopback interface: %v", err)
+	}
+
+	_, err = testListen(t, lo, testEtherType, nil).BroadcastAddr()
+	if !errors.Is(err, packet.ErrNoBroadcast) {
+		t.Fatalf("expected ErrNoBroadcast for loopback, but got: %v", err)
+	}
+}
+
+func TestConnCumulativeStats(t *testing.T) {
+	ifi := testInterface(t)
+	c := testReceiver(t, ifi, &packet.Config{CumulativeStats: true})
+	tx := testListen(t, ifi, testEtherType, nil)
+
+	// Poll Stats from several goroutines while frames arrive. Each caller must
+	// observe monotonically increasing totals.
+	var (
+		done = make(chan struct{})
+		errC = make(chan error, 4)
+	)
+
+	for i := 0; i < cap(errC); i++ {
+		go func() {
+			var prev uint32
+			for {
+				select {
+				case <-done:
+					errC <- nil
+					return
+				default:
+				}
+
+				stats, err := c.Stats()
+				if err != nil {
+					errC <- err
+					return
+				}
+				if stats.Packets < prev {
+					errC <- fmt.Errorf("packets decreased from %d to %d", prev, stats.Packets)
+					return
+				}
+				prev = stats.Packets
+			}
+		}()
+	}
+
+	const frames = 100
+	frame := testEthernetFrame(ifi, []byte("hello, stats"))
+	for i := 0; i < frames; i++ {
+		if _, err := tx.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+			t.Fatalf("failed to send frame %d: %v", i, err)
+		}
+	}
+
+	close(done)
+	for i := 0; i < cap(errC); i++ {
+		if err := <-errC; err != nil {
+			t.Fatalf("failed to poll stats: %v", err)
+		}
+	}
+
+	// No counts may be lost between the concurrent callers.
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if stats.Packets != frames {
+		t.Fatalf("unexpected cumulative packet count: %d, want: %d", stats.Packets, frames)
+	}
+}
+
+func TestConnSendBuffered(t *testing.T) {
+	ifi := testVeth(t)
+	for _, name := range []string{ifi.Name, ifi.Name + "p"} {
+		if out, err := exec.Command("ip", "link", "set", "dev", name, "up").CombinedOutput(); err != nil {
+			t.Fatalf("failed to bring up veth interface: %v: %s", err, out)
+		}
+	}
+
+	// Throttle transmission so that frames remain queued in the qdisc, where
+	// they are still charged to the socket's send buffer.
+	out, err := exec.Command("tc", "qdisc", "add", "dev", ifi.Name, "root",
+		"tbf", "rate", "8kbit", "burst", "1600", "latency", "10s").CombinedOutput()
+	if err != nil {
+		t.Skipf("skipping, failed to add tbf qdisc: %v: %s", err, out)
+	}
+
+	c := testListen(t, ifi, testEtherType, nil)
+
+	n, err := c.SendBuffered()
+	if err != nil {
+		t.Fatalf("failed to get send buffered bytes: %v", err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no send buffered bytes, but got: %d", n)
+	}
+
+	frame := testEthernetFrame(ifi, make([]byte, 1000))
+	for i := 0; i < 8; i++ {
+		if _, err := c.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+			t.Fatalf("failed to write frame %d: %v", i, err)
+		}
+	}
+
+	n, err = c.SendBuffered()
+	if err != nil {
+		t.Fatalf("failed to get send buffered bytes: %v", err)
+	}
+	if n <= 0 {
+		t.Fatalf("expected send buffered bytes, but got: %d", n)
+	}
+}
+
+func TestARPResponder(t *testing.T) {
+	a := testVeth(t)
+	b, err := net.InterfaceByName(a.Name + "p")
+	if err != nil {
+		t.Fatalf("failed to get veth peer: %v", err)
+	}
+	for _, ifi := range []*net.Interface{a, b} {
+		if out, err := exec.Command("ip", "link", "set", "dev", ifi.Name, "up").CombinedOutput(); err != nil {
+			t.Fatalf("failed to bring up veth interface: %v: %s", err, out)
+		}
+	}
+
+	const etherTypeARP = 0x0806
+	var (
+		responder = testListen(t, a, etherTypeARP, nil)
+		requester = testListen(t, b, etherTypeARP, nil)
+
+		ip = net.IPv4(192, 0, 2, 1)
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errC := make(chan error, 1)
+	go func() { errC <- packet.ARPResponder(ctx, responder, ip, a.HardwareAddr) }()
+
+	if err := requester.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	// Requests for other addresses are ignored, so only one reply arrives.
+	for _, dst := range []net.IP{net.IPv4(192, 0, 2, 3), ip} {
+		req := packet.ARPRequest(b.HardwareAddr, net.IPv4(192, 0, 2, 2), dst)
+		if _, err := requester.WriteTo(req, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+			t.Fatalf("failed to send ARP request: %v", err)
+		}
+	}
+
+	buf := make([]byte, b.MTU)
+	n, _, err := requester.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read ARP reply: %v", err)
+	}
+
+	mac, sip, ok := packet.ParseARPReply(buf[:n])
+	if !ok {
+		t.Fatalf("did not receive an ARP reply: %x", buf[:n])
+	}
+	if diff := cmp.Diff(a.HardwareAddr, mac); diff != "" {
+		t.Fatalf("unexpected sender MAC (-want +got):\n%s", diff)
+	}
+	if !sip.Equal(ip) {
+		t.Fatalf("unexpected sender IP: %v, want: %v", sip, ip)
+	}
+	if diff := cmp.Diff(b.HardwareAddr, net.HardwareAddr(buf[0:6])); diff != "" {
+		t.Fatalf("unexpected reply destination (-want +got):\n%s", diff)
+	}
+
+	cancel()
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to run ARP responder: %v", err)
+	}
+}
+
+func TestConnIncomingCPU(t *testing.T) {
+	ifi := testInterface(t)
+	c := testReceiver(t, ifi, nil)
+
+	testSend(t, ifi, []byte("hello, CPU"))
+
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	if _, _, err := c.ReadFrom(make([]byte, ifi.MTU)); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+
+	cpu, err := c.IncomingCPU()
+	if err != nil {
+		if errors.Is(err, unix.ENOPROTOOPT) {
+			t.Skipf("skipping, SO_INCOMING_CPU is not supported: %v", err)
+		}
+
+		t.Fatalf("failed to get incoming CPU: %v", err)
+	}
+	if cpu == -1 {
+		t.Skip("skipping, kernel does not record the incoming CPU for packet sockets")
+	}
+
+	// CPU numbers are not necessarily contiguous, so only sanity check the
+	// result.
+	if cpu < 0 {
+		t.Fatalf("invalid incoming CPU: %d", cpu)
+	}
+}
+
+func TestListenProtocols(t *testing.T) {
+	ifi := testInterface(t)
+
+	c, err := packet.ListenProtocols(ifi, packet.Raw, []int{testEtherType, testEtherType + 1}, nil)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer c.Close()
+
+	// The protocol filter precedes any filter set later.
+	if err := c.SetBPF(nil); err != nil {
+		t.Fatalf("failed to set filter: %v", err)
+	}
+
+	tx := testListen(t, ifi, testEtherType, nil)
+	for _, et := range []uint16{testEtherType, testEtherType + 2, testEtherType + 1} {
+		frame := testEthernetFrame(ifi, []byte("hello, protocols"))
+		binary.BigEndian.PutUint16(frame[12:14], et)
+
+		if _, err := tx.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+			t.Fatalf("failed to send frame: %v", err)
+		}
+	}
+
+	if err := c.SetReadDeadline(time.Now().Add(500 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	var got []uint16
+	buf := make([]byte, ifi.MTU)
+	for {
+		n, _, err := c.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		if n < 14 {
+			t.Fatalf("short frame: %x", buf[:n])
+		}
+
+		got = append(got, binary.BigEndian.Uint16(buf[12:14]))
+	}
+
+	want := []uint16{testEtherType, testEtherType + 1}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected EtherTypes (-want +got):\n%s", diff)
+	}
+
+	// Datagram Conns match the protocol of the sending socket, since outgoing
+	// frames are reported with that protocol.
+	dc, err := packet.ListenProtocols(ifi, packet.Datagram, []int{testEtherType}, nil)
+	if err != nil {
+		t.Fatalf("failed to listen datagram: %v", err)
+	}
+	defer dc.Close()
+
+	for _, et := range []int{testEtherType + 2, testEtherType} {
+		tx := testListen(t, ifi, et, nil)
+		if _, err := tx.WriteTo(testEthernetFrame(ifi, []byte(strconv.Itoa(et))), &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+			t.Fatalf("failed to send frame: %v", err)
+		}
+	}
+
+	if err := dc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	_, addr, err := dc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read datagram frame: %v", err)
+	}
+	if p := addr.(*packet.Addr).Protocol; p != testEtherType {
+		t.Fatalf("unexpected datagram protocol: %#04x", p)
+	}
+
+	if _, err := packet.ListenProtocols(ifi, packet.Raw, nil, nil); err == nil {
+		t.Fatal("expected an error for no protocols")
+	}
+	if _, err := packet.ListenProtocols(ifi, packet.Raw, []int{0x10000}, nil); err == nil {
+		t.Fatal("expected an error for an invalid protocol")
+	}
+}
+
+func TestConnHardwareAddr(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, nil)
+
+	if diff := cmp.Diff(ifi.HardwareAddr, c.HardwareAddr()); diff != "" {
+		t.Fatalf("unexpected hardware address (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnReadFromMetadata(t *testing.T) {
+	ifi := testInterface(t)
+
+	tests := []struct {
+		name    string
+		auxdata bool
+		size    int
+	}{
+		{
+			name: "full",
+			size: ifi.MTU,
+		},
+		{
+			name:    "truncated auxdata",
+			auxdata: true,
+			size:    16,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testReceiver(t, ifi, &packet.Config{Auxdata: tt.auxdata})
+
+			payload := []byte("hello, metadata")
+			frameLen := len(testEthernetFrame(ifi, payload))
+
+			start := time.Now()
+			testSend(t, ifi, payload)
+
+			if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				t.Fatalf("failed to set read deadline: %v", err)
+			}
+
+			n, m, err := c.ReadFromMetadata(make([]byte, tt.size))
+			if err != nil {
+				t.Fatalf("failed to read frame: %v", err)
+			}
+
+			want := frameLen
+			if tt.size < want {
+				want = tt.size
+			}
+			if n != want {
+				t.Fatalf("unexpected frame length: %d, want: %d", n, want)
+			}
+			if m.Truncated != (tt.size < frameLen) {
+				t.Fatalf("unexpected truncation: %v", m.Truncated)
+			}
+			if m.Timestamp.Before(start) || m.Timestamp.After(time.Now()) {
+				t.Fatalf("implausible timestamp: %v", m.Timestamp)
+			}
+
+			wantAddr := &packet.Addr{
+				HardwareAddr: ifi.HardwareAddr,
+				Protocol:     testEtherType,
+				Index:        ifi.Index,
+				HardwareType: unix.ARPHRD_ETHER,
+				PacketType:   packet.PacketOutgoing,
+			}
+			if diff := cmp.Diff(wantAddr, m.Addr); diff != "" {
+				t.Fatalf("unexpected address (-want +got):\n%s", diff)
+			}
+
+			if !tt.auxdata {
+				if m.Auxdata != nil {
+					t.Fatalf("unexpected auxdata: %+v", m.Auxdata)
+				}
+				return
+			}
+
+			if m.Auxdata == nil {
+				t.Skip("skipping, kernel did not attach auxdata")
+			}
+			if m.Auxdata.Length != uint32(frameLen) {
+				t.Fatalf("unexpected original length: %d, want: %d", m.Auxdata.Length, frameLen)
+			}
+		})
+	}
+}
+
+func TestConnReadFromSkipsEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		read func(c *packet.Conn, b []byte) (int, error)
+	}{
+		{
+			name: "ReadFrom",
+			read: func(c *packet.Conn, b []byte) (int, error) {
+				n, _, err := c.ReadFrom(b)
+				return n, err
+			},
+		},
+		{
+			name: "ReadFromAuxdata",
+			read: func(c *packet.Conn, b []byte) (int, error) {
+				n, _, _, err := c.ReadFromAuxdata(b)
+				return n, err
+			},
+		},
+		{
+			name: "ReadFromMetadata",
+			read: func(c *packet.Conn, b []byte) (int, error) {
+				n, _, err := c.ReadFromMetadata(b)
+				return n, err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ifi := testInterface(t)
+			c := testListenEmpty(t, ifi)
+
+			// A frame consisting only of an Ethernet header has no Datagram
+			// contents, and must be skipped in favor of the following frame.
+			testSend(t, ifi, nil)
+			testSend(t, ifi, []byte("hello, world"))
+
+			if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				t.Fatalf("failed to set read deadline: %v", err)
+			}
+
+			b := make([]byte, ifi.MTU)
+			n, err := tt.read(c, b)
+			if err != nil {
+				t.Fatalf("failed to read frame: %v", err)
+			}
+			if diff := cmp.Diff("hello, world", string(b[:n])); diff != "" {
+				t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+			}
+
+			// With only an empty frame queued, the deadline must still apply.
+			testSend(t, ifi, nil)
+			if err := c.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+				t.Fatalf("failed to set read deadline: %v", err)
+			}
+
+			if _, err := tt.read(c, b); !errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatalf("expected deadline exceeded, but got: %v", err)
+			}
+		})
+	}
+
+	t.Run("Stream", func(t *testing.T) {
+		ifi := testInterface(t)
+		c := testListenEmpty(t, ifi)
+
+		testSend(t, ifi, nil)
+		testSend(t, ifi, []byte("hello, world"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		select {
+		case f := <-c.Stream(ctx, 1):
+			if diff := cmp.Diff("hello, world", string(f.Data)); diff != "" {
+				t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for frame")
+		}
+	})
+}
+
+// testListenEmpty opens a Datagram Conn with Auxdata on ifi, which receives
+// empty frames for Ethernet frames that carry no payload.
+func testListenEmpty(t *testing.T, ifi *net.Interface) *packet.Conn {
+	t.Helper()
+
+	c, err := packet.ListenProtocols(ifi, packet.Datagram, []int{testEtherType}, &packet.Config{Auxdata: true})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
+
+func TestConnMemberships(t *testing.T) {
+	ifi := testVeth(t)
+
+	c, err := packet.Listen(ifi, packet.Raw, int(testEtherType), &packet.Config{Promiscuous: true})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	var (
+		ipv4 = net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0xfb}
+		ipv6 = net.HardwareAddr{0x33, 0x33, 0x00, 0x00, 0x00, 0xfb}
+	)
+
+	for _, addr := range []net.HardwareAddr{ipv4, ipv6, ipv4} {
+		if err := c.JoinGroup(addr); err != nil {
+			t.Fatalf("failed to join group %s: %v", addr, err)
+		}
+	}
+
+	// The IPv4 group was joined twice, so it remains after one leave.
+	if err := c.LeaveGroup(ipv4); err != nil {
+		t.Fatalf("failed to leave group: %v", err)
+	}
+
+	want := []packet.Membership{
+		{Type: packet.MembershipPromiscuous},
+		{Type: packet.MembershipMulticast, Addr: ipv4},
+		{Type: packet.MembershipMulticast, Addr: ipv6},
+	}
+
+	got, err := c.Memberships()
+	if err != nil {
+		t.Fatalf("failed to get memberships: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected memberships (-want +got):\n%s", diff)
+	}
+
+	for _, addr := range []net.HardwareAddr{ipv4, ipv6} {
+		if !testMulticastJoined(t, ifi, addr) {
+			t.Fatalf("kernel did not report membership for %s", addr)
+		}
+	}
+	if !testSysfsPromiscuous(t, ifi) {
+		t.Fatal("interface is not promiscuous")
+	}
+
+	// Closing the Conn releases all memberships.
+	if err := c.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	got, err = c.Memberships()
+	if err != nil {
+		t.Fatalf("failed to get memberships: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("unexpected memberships after close: %v", got)
+	}
+
+	for _, addr := range []net.HardwareAddr{ipv4, ipv6} {
+		if testMulticastJoined(t, ifi, addr) {
+			t.Fatalf("kernel still reports membership for %s", addr)
+		}
+	}
+	if testSysfsPromiscuous(t, ifi) {
+		t.Fatal("interface is still promiscuous")
+	}
+}
+
+// testMulticastJoined reports whether the kernel lists addr among the
+// multicast addresses of ifi.
+func testMulticastJoined(t *testing.T, ifi *net.Interface, addr net.HardwareAddr) bool {
+	t.Helper()
+
+	b, err := os.ReadFile("/proc/net/dev_mcast")
+	if err != nil {
+		t.Skipf("skipping, failed to read multicast addresses: %v", err)
+	}
+
+	// Each line contains: index, name, users, global users, and address.
+	want := strings.ReplaceAll(addr.String(), ":", "")
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 5 && fields[1] == ifi.Name && fields[4] == want {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestConnSetAllMulticast(t *testing.T) {
+	ifi := testVeth(t)
+	c, err := packet.Listen(ifi, packet.Raw, int(testEtherType), nil)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	if err := c.SetAllMulticast(true); err != nil {
+		t.Fatalf("failed to enable all-multicast: %v", err)
+	}
+
+	got, err := c.Memberships()
+	if err != nil {
+		t.Fatalf("failed to get memberships: %v", err)
+	}
+	if diff := cmp.Diff([]packet.Membership{{Type: packet.MembershipAllMulticast}}, got); diff != "" {
+		t.Fatalf("unexpected memberships (-want +got):\n%s", diff)
+	}
+
+	flags := testSysfsFlags(t, ifi)
+	if flags&unix.IFF_ALLMULTI == 0 {
+		t.Fatal("interface is not all-multicast")
+	}
+	if flags&unix.IFF_PROMISC != 0 {
+		t.Fatal("all-multicast must not make the interface promiscuous")
+	}
+
+	// The membership is released when the Conn is closed.
+	if err := c.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if testSysfsFlags(t, ifi)&unix.IFF_ALLMULTI != 0 {
+		t.Fatal("interface is still all-multicast")
+	}
+}
+
+func TestConnTimestampCapabilities(t *testing.T) {
+	c := testListen(t, testInterface(t), testEtherType, nil)
+
+	caps, err := c.TimestampCapabilities()
+	if err != nil {
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			t.Skipf("skipping, interface does not report timestamping capabilities: %v", err)
+		}
+
+		t.Fatalf("failed to get timestamping capabilities: %v", err)
+	}
+
+	t.Logf("timestamping capabilities: %+v", caps)
+
+	// The kernel reports software receive timestamps for all interfaces.
+	if !caps.SoftwareRX {
+		t.Fatal("software receive timestamps are not supported")
+	}
+
+	index, err := c.PHCIndex()
+	if err != nil {
+		t.Fatalf("failed to get PHC index: %v", err)
+	}
+	if caps.PHCIndex != index {
+		t.Fatalf("unexpected PHC index: %d, want: %d", caps.PHCIndex, index)
+	}
+}
+
+func TestConnSetMaxPacingRate(t *testing.T) {
+	c := testListen(t, testInterface(t), testEtherType, nil)
+
+	// getMaxPacingRate reads the option using an 8 byte value, which older
+	// kernels report as a 4 byte value.
+	getMaxPacingRate := func() uint64 {
+		t.Helper()
+
+		rc, err := c.SyscallConn()
+		if err != nil {
+			t.Fatalf("failed to get syscall conn: %v", err)
+		}
+
+		var (
+			rate uint64
+			gerr error
+		)
+		if err := rc.Control(func(fd uintptr) {
+			rate, gerr = unix.GetsockoptUint64(int(fd), unix.SOL_SOCKET, unix.SO_MAX_PACING_RATE)
+		}); err != nil {
+			t.Fatalf("failed to control: %v", err)
+		}
+		if gerr != nil {
+			t.Fatalf("failed to get max pacing rate: %v", gerr)
+		}
+
+		return rate
+	}
+
+	const rate = 125_000 // 1 Mbps.
+	if err := c.SetMaxPacingRate(rate); err != nil {
+		t.Fatalf("failed to set max pacing rate: %v", err)
+	}
+	if diff := cmp.Diff(uint64(rate), getMaxPacingRate()); diff != "" {
+		t.Fatalf("unexpected max pacing rate (-want +got):\n%s", diff)
+	}
+
+	if err := c.SetMaxPacingRate(math.MaxUint64); err != nil {
+		t.Fatalf("failed to remove max pacing rate: %v", err)
+	}
+	if got := getMaxPacingRate(); got != math.MaxUint64 && got != math.MaxUint32 {
+		t.Fatalf("unexpected unlimited max pacing rate: %d", got)
+	}
+}
+
+func TestConnReadFromBy(t *testing.T) {
+	// No frames are sent with this EtherType, so all reads time out.
+	c := testListen(t, testInterface(t), 0x88b6, nil)
+
+	// Each goroutine's read must time out at its own deadline, without
+	// affecting the other or the Conn's read deadline.
+	timeouts := []time.Duration{100 * time.Millisecond, 300 * time.Millisecond}
+
+	var (
+		wg      sync.WaitGroup
+		elapsed = make([]time.Duration, len(timeouts))
+		errs    = make([]error, len(timeouts))
+	)
+
+	for i, d := range timeouts {
+		wg.Add(1)
+		go func(i int, d time.Duration) {
+			defer wg.Done()
+
+			start := time.Now()
+			_, _, errs[i] = c.ReadFromBy(make([]byte, 1500), start.Add(d))
+			elapsed[i] = time.Since(start)
+		}(i, d)
+	}
+	wg.Wait()
+
+	for i, d := range timeouts {
+		if !errors.Is(errs[i], os.ErrDeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded for %v read, but got: %v", d, errs[i])
+		}
+		if elapsed[i] < d || elapsed[i] > d+250*time.Millisecond {
+			t.Fatalf("%v read returned after %v", d, elapsed[i])
+		}
+	}
+
+	if !c.ReadDeadline().IsZero() {
+		t.Fatalf("expected no read deadline, but got: %v", c.ReadDeadline())
+	}
+
+	// A frame which arrives before the deadline is returned.
+	ifi := testInterface(t)
+	r := testReceiver(t, ifi, nil)
+	testSend(t, ifi, []byte("hello"))
+
+	b := make([]byte, 1500)
+	n, _, err := r.ReadFromBy(b, time.Now().Add(5*time.Second))
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if !bytes.Contains(b[:n], []byte("hello")) {
+		t.Fatalf("unexpected frame: %x", b[:n])
+	}
+}
+
+func TestFanoutGroupStats(t *testing.T) {
+	ifi := testInterface(t)
+
+	// FanoutLB distributes frames round-robin, so each member should receive
+	// an equal share.
+	const (
+		members = 3
+		frames  = 9
+	)
+
+	fanout := &packet.FanoutConfig{GroupID: 0x88b7, Type: packet.FanoutLB}
+
+	var conns []*packet.Conn
+	for i := 0; i < members; i++ {
+		conns = append(conns, testReceiver(t, ifi, &packet.Config{Fanout: fanout}))
+	}
+	g := packet.NewFanoutGroup(conns...)
+
+	for i := 0; i < frames; i++ {
+		testSend(t, ifi, []byte("hello"))
+	}
+
+	// Wait for delivery to the members' receive queues.
+	time.Sleep(50 * time.Millisecond)
+
+	stats, err := g.Stats()
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+
+	if diff := cmp.Diff(members, len(stats.Members)); diff != "" {
+		t.Fatalf("unexpected number of members (-want +got):\n%s", diff)
+	}
+
+	var sum packet.Stats
+	for _, s := range stats.Members {
+		sum.Packets += s.Packets
+		sum.Drops += s.Drops
+		sum.BufferDrops += s.BufferDrops
+		sum.FreezeQueueCount += s.FreezeQueueCount
+	}
+
+	if diff := cmp.Diff(sum, stats.Total); diff != "" {
+		t.Fatalf("unexpected total stats (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(uint32(frames), stats.Total.Packets); diff != "" {
+		t.Fatalf("unexpected total packets (-want +got):\n%s", diff)
+	}
+	if stats.Imbalance < 1 || stats.Imbalance > members {
+		t.Fatalf("imbalance out of range: %v", stats.Imbalance)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      packet.Type
+		protocol int
+		cfg      *packet.Config
+		ok       bool
+	}{
+		{
+			name: "OK default",
+			typ:  packet.Raw,
+			ok:   true,
+		},
+		{
+			name:     "OK full",
+			typ:      packet.Raw,
+			protocol: testEtherType,
+			cfg: &packet.Config{
+				Direction: packet.DirectionOut,
+				VnetHdr:   true,
+				LocalOnly: true,
+				Fanout: &packet.FanoutConfig{
+					Type:     packet.FanoutLB,
+					UniqueID: true,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "bad type",
+		},
+		{
+			name:     "bad protocol",
+			typ:      packet.Raw,
+			protocol: -1,
+		},
+		{
+			name: "bad direction",
+			typ:  packet.Raw,
+			cfg:  &packet.Config{Direction: 100},
+		},
+		{
+			name: "datagram LocalOnly",
+			typ:  packet.Datagram,
+			cfg:  &packet.Config{LocalOnly: true},
+		},
+		{
+			name: "datagram StrictSourceMAC",
+			typ:  packet.Datagram,
+			cfg:  &packet.Config{StrictSourceMAC: true},
+		},
+		{
+			name: "datagram VnetHdr",
+			typ:  packet.Datagram,
+			cfg:  &packet.Config{VnetHdr: true},
+		},
+		{
+			name: "bad fanout type",
+			typ:  packet.Raw,
+			cfg:  &packet.Config{Fanout: &packet.FanoutConfig{Type: 100}},
+		},
+		{
+			name: "fanout UniqueID with GroupID",
+			typ:  packet.Raw,
+			cfg: &packet.Config{Fanout: &packet.FanoutConfig{
+				GroupID:  1,
+				UniqueID: true,
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := packet.ValidateConfig(tt.typ, tt.protocol, tt.cfg)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to validate config: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestConnInterfaceMTU(t *testing.T) {
+	ifi := testInterface(t)
+	veth := testVeth(t)
+
+	const jumbo = 9000
+	for _, name := range []string{veth.Name, veth.Name + "p"} {
+		args := []string{"link", "set", "dev", name, "mtu", strconv.Itoa(jumbo), "up"}
+		if out, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+			t.Skipf("skipping, failed to configure %s: %v: %s", name, err, out)
+		}
+	}
+
+	filter, err := packet.MatchEtherType(testEtherType).Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+
+	rx, err := packet.ListenAll(packet.Raw, unix.ETH_P_ALL, &packet.Config{
+		Filter:    filter,
+		Direction: packet.DirectionOut,
+	})
+	if err != nil {
+		t.Fatalf("failed to listen on all interfaces: %v", err)
+	}
+	defer rx.Close()
+
+	// Size the buffer for the interface with the largest MTU.
+	want := make(map[int]int)
+	var size int
+	for _, index := range []int{ifi.Index, veth.Index} {
+		mtu, err := rx.InterfaceMTU(index)
+		if err != nil {
+			t.Fatalf("failed to get MTU of interface %d: %v", index, err)
+		}
+		if index == veth.Index && mtu != jumbo {
+			t.Fatalf("unexpected veth MTU: %d", mtu)
+		}
+
+		// Send a frame which fills the MTU of each interface.
+		payload := make([]byte, mtu)
+		want[index] = len(testEthernetFrame(ifi, payload))
+		if mtu+14 > size {
+			size = mtu + 14
+		}
+	}
+
+	testSend(t, ifi, make([]byte, ifi.MTU))
+	tx := testListen(t, veth, testEtherType, nil)
+	if _, err := tx.WriteTo(testEthernetFrame(veth, make([]byte, jumbo)), &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+		t.Fatalf("failed to send jumbo frame: %v", err)
+	}
+
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	b := make([]byte, size)
+	for len(want) > 0 {
+		n, meta, err := rx.ReadFromMetadata(b)
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+
+		index := meta.Addr.Index
+		wantN, ok := want[index]
+		if !ok {
+			continue
+		}
+		delete(want, index)
+
+		if meta.Truncated || n != wantN {
+			t.Fatalf("interface %d: unexpected frame length %d (truncated: %v), want %d",
+				index, n, meta.Truncated, wantN)
+		}
+	}
+}
+
+func TestConnStrictSourceMAC(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, &packet.Config{StrictSourceMAC: true})
+
+	dst := &packet.Addr{HardwareAddr: ethernetBroadcast}
+	frame := testEthernetFrame(ifi, []byte("hello, strict"))
+	if _, err := c.WriteTo(frame, dst); err != nil {
+		t.Fatalf("failed to write frame with interface source MAC: %v", err)
+	}
+
+	spoofed := append([]byte(nil), frame...)
+	copy(spoofed[6:12], net.HardwareAddr{0x02, 0xde, 0xad, 0xbe, 0xef, 0x00})
+
+	for _, b := range [][]byte{spoofed, frame[:8]} {
+		_, err := c.WriteTo(b, dst)
+		if !errors.Is(err, packet.ErrSourceMACMismatch) {
+			t.Fatalf("expected source MAC mismatch, but got: %v", err)
+		}
+	}
+
+	// Without StrictSourceMAC, any source MAC may be written.
+	loose := testListen(t, ifi, testEtherType, nil)
+	if _, err := loose.WriteTo(spoofed, dst); err != nil {
+		t.Fatalf("failed to write frame with spoofed source MAC: %v", err)
+	}
+
+	// Conns which are not bound to an interface have no MAC to compare.
+	if _, err := packet.ListenAll(packet.Raw, testEtherType, &packet.Config{StrictSourceMAC: true}); err == nil {
+		t.Fatal("expected an error listening on all interfaces, but none occurred")
+	}
+}
+
+func TestConnIsBoundToInterface(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, nil)
+
+	all, err := packet.ListenAll(packet.Raw, testEtherType, nil)
+	if err != nil {
+		t.Fatalf("failed to listen on all interfaces: %v", err)
+	}
+	defer all.Close()
+
+	tests := []struct {
+		name  string
+		c     *packet.Conn
+		bound bool
+		index int
+		str   string
+	}{
+		{
+			name:  "interface",
+			c:     c,
+			bound: true,
+			index: ifi.Index,
+			str:   fmt.Sprintf("packet: interface %d (%s)", ifi.Index, ifi.HardwareAddr),
+		},
+		{
+			name: "all",
+			c:    all,
+			str:  "packet: all interfaces",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.bound, tt.c.IsBoundToInterface()); diff != "" {
+				t.Fatalf("unexpected bound state (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.index, tt.c.LocalAddr().(*packet.Addr).Index); diff != "" {
+				t.Fatalf("unexpected local address index (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.str, tt.c.String()); diff != "" {
+				t.Fatalf("unexpected string (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConnSetsockoptInt(t *testing.T) {
+	c := testListen(t, testInterface(t), testEtherType, nil)
+
+	for _, opt := range []int{unix.SO_REUSEADDR, unix.SO_REUSEPORT} {
+		err := c.SetsockoptInt(unix.SOL_SOCKET, opt, 1)
+		if opt == unix.SO_REUSEPORT && errors.Is(err, unix.EOPNOTSUPP) {
+			// Recent kernels only permit SO_REUSEPORT on inet and unix
+			// sockets.
+			continue
+		}
+		if err != nil {
+			t.Fatalf("failed to set option %d: %v", opt, err)
+		}
+
+		v, err := c.GetsockoptInt(unix.SOL_SOCKET, opt)
+		if err != nil {
+			t.Fatalf("failed to get option %d: %v", opt, err)
+		}
+		if v != 1 {
+			t.Fatalf("unexpected value for option %d: %d", opt, v)
+		}
+	}
+
+	// Errors from the kernel are passed through.
+	if err := c.SetsockoptInt(unix.SOL_PACKET, math.MaxInt16, 1); !errors.Is(err, unix.ENOPROTOOPT) {
+		t.Fatalf("expected ENOPROTOOPT, but got: %v", err)
+	}
+}
+
+func TestConnReadFromMetadataVLANTags(t *testing.T) {
+	ifi := testInterface(t)
+	rx := testListen(t, ifi, unix.ETH_P_ALL, &packet.Config{Auxdata: true})
+
+	// A Q-in-Q frame with both tags in the frame, since the frame is captured
+	// on transmit and never passes through VLAN offload.
+	frame := append([]byte(nil), ethernetBroadcast...)
+	frame = append(frame, ifi.HardwareAddr...)
+	frame = append(frame,
+		0x88, 0xa8, 0x00, 0x64,
+		0x81, 0x00, 0x00, 0xc8,
+	)
+	frame = binary.BigEndian.AppendUint16(frame, testEtherType)
+	frame = append(frame, "hello, Q-in-Q"...)
+
+	tx := testListen(t, ifi, testEtherType, nil)
+	if _, err := tx.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	b := make([]byte, 1500)
+	for {
+		n, meta, err := rx.ReadFromMetadata(b)
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		if !bytes.Equal(b[:n], frame) {
+			// Unrelated traffic.
+			continue
+		}
+
+		want := []packet.VLANTag{
+			{TPID: 0x88a8, TCI: 100},
+			{TPID: 0x8100, TCI: 200},
+		}
+		if diff := cmp.Diff(want, meta.VLANTags); diff != "" {
+			t.Fatalf("unexpected VLAN tags (-want +got):\n%s", diff)
+		}
+
+		return
+	}
+}
+
+func TestConnPauseResume(t *testing.T) {
+	ifi := testInterface(t)
+	c := testReceiver(t, ifi, nil)
+
+	want, err := c.Filter()
+	if err != nil {
+		t.Fatalf("failed to get filter: %v", err)
+	}
+
+	// Frames queued before and sent during the pause are discarded.
+	testSend(t, ifi, []byte("before"))
+	for i := 0; i < 2; i++ {
+		if err := c.Pause(); err != nil {
+			t.Fatalf("failed to pause: %v", err)
+		}
+	}
+	testSend(t, ifi, []byte("paused"))
+
+	if err := c.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	b := make([]byte, 1500)
+	if _, _, err := c.ReadFrom(b); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected no frames while paused, but got: %v", err)
+	}
+
+	// The filter cannot be changed while paused.
+	for _, fn := range []func([]bpf.RawInstruction) error{c.SetBPF, c.ReplaceFilter} {
+		if err := fn(want); err == nil {
+			t.Fatal("expected an error changing the filter while paused, but none occurred")
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.Resume(); err != nil {
+			t.Fatalf("failed to resume: %v", err)
+		}
+	}
+
+	got, err := c.Filter()
+	if err != nil {
+		t.Fatalf("failed to get filter: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected filter after resume (-want +got):\n%s", diff)
+	}
+
+	testSend(t, ifi, []byte("resumed"))
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	n, _, err := c.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read after resume: %v", err)
+	}
+	if !bytes.HasSuffix(b[:n], []byte("resumed")) {
+		t.Fatalf("unexpected frame after resume: %x", b[:n])
+	}
+}
+
+func TestConnPauseeBPF(t *testing.T) {
+	ifi := testInterface(t)
+	c := testReceiver(t, ifi, nil)
+
+	prog := testLoadeBPF(t, 0xffffffff)
+	defer unix.Close(prog)
+
+	if err := c.SeteBPF(prog); err != nil {
+		t.Fatalf("failed to attach eBPF program: %v", err)
+	}
+
+	// The eBPF program could not be restored by Resume.
+	if err := c.Pause(); err == nil {
+		t.Fatal("expected an error pausing with an eBPF program, but none occurred")
+	}
+
+	if err := c.RemoveeBPF(); err != nil {
+		t.Fatalf("failed to remove eBPF program: %v", err)
+	}
+	if err := c.Pause(); err != nil {
+		t.Fatalf("failed to pause: %v", err)
+	}
+	if err := c.SeteBPF(prog); err == nil {
+		t.Fatal("expected an error attaching eBPF program while paused, but none occurred")
+	}
+	if err := c.Resume(); err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+}
+
+func TestFilterTooLong(t *testing.T) {
+	// A filter which is at the kernel's limit by itself, but exceeds it when
+	// combined with the filter required by DirectionOut.
+	filter := make([]bpf.RawInstruction, 4096)
+	for i := range filter {
+		filter[i] = bpf.RawInstruction{Op: unix.BPF_RET | unix.BPF_K, K: math.MaxInt32}
+	}
+
+	if err := packet.ValidateConfig(packet.Raw, testEtherType, &packet.Config{Filter: filter}); err != nil {
+		t.Fatalf("failed to validate filter at limit: %v", err)
+	}
+
+	err := packet.ValidateConfig(packet.Raw, testEtherType, &packet.Config{
+		Filter:    filter,
+		Direction: packet.DirectionOut,
+	})
+	if !errors.Is(err, packet.ErrFilterTooLong) {
+		t.Fatalf("expected ErrFilterTooLong, but got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "4099 instructions exceeds limit of 4096") {
+		t.Fatalf("error does not describe length and limit: %v", err)
+	}
+
+	c := testListen(t, testInterface(t), testEtherType, nil)
+	for _, fn := range []func([]bpf.RawInstruction) error{c.SetBPF, c.ReplaceFilter} {
+		if err := fn(append(filter, filter[0])); !errors.Is(err, packet.ErrFilterTooLong) {
+			t.Fatalf("expected ErrFilterTooLong, but got: %v", err)
+		}
+	}
+}
+
+func TestCaptureGroup(t *testing.T) {
+	ifi := testInterface(t)
+
+	// Steer all frames to the second member.
+	prog := testLoadeBPF(t, 1)
+	defer unix.Close(prog)
+
+	filter, err := packet.MatchEtherType(testEtherType).Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+
+	const members = 3
+	g, err := packet.ListenCaptureGroup(ifi, packet.Raw, &packet.CaptureGroupConfig{
+		Protocol:    unix.ETH_P_ALL,
+		Members:     members,
+		EBPFProgram: prog,
+		BufferSize:  16,
+		Config:      &packet.Config{Filter: filter},
+	})
+	if err != nil {
+		// Kernels without eBPF fanout reject the fanout type or its program.
+		if errors.Is(err, os.ErrPermission) || errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOPROTOOPT) {
+			t.Skipf("skipping, kernel does not support eBPF fanout: %v", err)
+		}
+
+		t.Fatalf("failed to create capture group: %v", err)
+	}
+	defer g.Close()
+
+	const sent = 6
+	for i := 0; i < sent; i++ {
+		testSend(t, ifi, []byte{byte(i)})
+	}
+
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < sent; i++ {
+		select {
+		case f := <-g.Frames():
+			// Frames of a single member are delivered in order.
+			if got := f.Data[len(testEthernetFrame(ifi, nil))]; got != byte(i) {
+				t.Fatalf("unexpected frame %d: %x", i, f.Data)
+			}
+		case <-timeout:
+			t.Fatalf("timed out after receiving %d frames", i)
+		}
+	}
+
+	stats, err := g.Group().Stats()
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+
+	want := make([]uint32, members)
+	want[1] = sent
+
+	var got []uint32
+	for _, s := range stats.Members {
+		got = append(got, s.Packets)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected packets per member (-want +got):\n%s", diff)
+	}
+
+	if err := g.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	for range g.Frames() {
+	}
+}
+
+func TestConnCloseRestoresFlags(t *testing.T) {
+	ifi := testVeth(t)
+
+	tests := []struct {
+		name     string
+		external bool
+	}{
+		{name: "not promiscuous"},
+		{name: "externally promiscuous", external: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.external {
+				out, err := exec.Command("ip", "link", "set", "dev", ifi.Name, "promisc", "on").CombinedOutput()
+				if err != nil {
+					t.Skipf("skipping, failed to set promiscuous mode: %v: %s", err, out)
+				}
+				t.Cleanup(func() { _ = exec.Command("ip", "link", "set", "dev", ifi.Name, "promisc", "off").Run() })
+			}
+
+			if diff := cmp.Diff(tt.external, testSysfsPromiscuous(t, ifi)); diff != "" {
+				t.Fatalf("unexpected initial promiscuous state (-want +got):\n%s", diff)
+			}
+
+			c := testListen(t, ifi, unix.ETH_P_ALL, nil)
+			if err := c.SetPromiscuous(true); err != nil {
+				t.Fatalf("failed to enable promiscuous mode: %v", err)
+			}
+			if !testSysfsPromiscuous(t, ifi) {
+				t.Fatal("interface is not promiscuous after enabling membership")
+			}
+
+			// A duplicated file descriptor keeps the socket open, so the
+			// kernel would not release the membership itself.
+			dup, err := unix.Dup(testFD(t, c))
+			if err != nil {
+				t.Fatalf("failed to duplicate file descriptor: %v", err)
+			}
+			defer unix.Close(dup)
+
+			if err := c.Close(); err != nil {
+				t.Fatalf("failed to close: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.external, testSysfsPromiscuous(t, ifi)); diff != "" {
+				t.Fatalf("unexpected promiscuous state after close (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.external, testIfreqPromiscuous(t, ifi)); diff != "" {
+				t.Fatalf("unexpected IFF_PROMISC after close (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConnWillEgressInterface(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, nil)
+
+	index, err := c.WillEgressInterface()
+	if err != nil {
+		t.Fatalf("failed to get egress interface: %v", err)
+	}
+	if index != ifi.Index {
+		t.Fatalf("unexpected egress interface index: want %d, got %d", ifi.Index, index)
+	}
+
+	// A Conn bound to all interfaces has no default egress interface.
+	all, err := packet.ListenAll(packet.Raw, testEtherType, nil)
+	if err != nil {
+		t.Fatalf("failed to listen on all interfaces: %v", err)
+	}
+	defer all.Close()
+
+	if _, err := all.WillEgressInterface(); !errors.Is(err, unix.ENXIO) {
+		t.Fatalf("expected ENXIO, but got: %v", err)
+	}
+}
+
+func TestListenAllForward(t *testing.T) {
+	// Frames sent on one end of a veth pair are received by the other end.
+	a := testVeth(t)
+	b, err := net.InterfaceByName(a.Name + "p")
+	if err != nil {
+		t.Fatalf("failed to get veth peer: %v", err)
+	}
+	for _, ifi := range []*net.Interface{a, b} {
+		if out, err := exec.Command("ip", "link", "set", "dev", ifi.Name, "up").CombinedOutput(); err != nil {
+			t.Fatalf("failed to bring up veth interface: %v: %s", err, out)
+		}
+	}
+
+	filter, err := packet.MatchEtherType(testEtherType).Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+
+	// The forwarder ignores outgoing frames so it never sees its own writes.
+	fwd, err := packet.ListenAll(packet.Raw, unix.ETH_P_ALL, &packet.Config{
+		Filter:         filter,
+		Direction:      packet.DirectionIn,
+		OriginalDevice: true,
+	})
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skipf("skipping, permission denied (try setting CAP_NET_RAW capability): %v", err)
+		}
+
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer fwd.Close()
+
+	rx := testReceiver(t, b, &packet.Config{Direction: packet.DirectionIn})
+	for _, c := range []*packet.Conn{fwd, rx} {
+		if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatalf("failed to set read deadline: %v", err)
+		}
+	}
+
+	// Send a frame from b so it arrives on a, and read it from the forwarder.
+	payload := []byte("hello, forwarder")
+	testSend(t, b, payload)
+
+	buf := make([]byte, a.MTU)
+	n, addr, err := fwd.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if got := addr.(*packet.Addr).Index; got != a.Index {
+		t.Fatalf("unexpected ingress interface index: %d", got)
+	}
+
+	// Forward the frame back out of a so that it arrives on b.
+	if _, err := fwd.WriteTo(buf[:n], &packet.Addr{
+		HardwareAddr: ethernetBroadcast,
+		Index:        a.Index,
+	}); err != nil {
+		t.Fatalf("failed to forward frame: %v", err)
+	}
+
+	n, addr, err = rx.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read forwarded frame: %v", err)
+	}
+	if got := buf[14:n]; string(got) != string(payload) {
+		t.Fatalf("unexpected payload: %q", got)
+	}
+	if got := addr.(*packet.Addr).Index; got != b.Index {
+		t.Fatalf("unexpected forwarded interface index: %d", got)
+	}
+}
+
+func TestConnReadErrQueue(t *testing.T) {
+	// veth only transmits frames when both ends are up.
+	ifi := testVeth(t)
+	for _, name := range []string{ifi.Name, ifi.Name + "p"} {
+		if out, err := exec.Command("ip", "link", "set", "dev", name, "up").CombinedOutput(); err != nil {
+			t.Fatalf("failed to bring up veth interface: %v: %s", err, out)
+		}
+	}
+
+	c := testListen(t, ifi, testEtherType, nil)
+
+	b := make([]byte, ifi.MTU)
+	if _, _, _, err := c.ReadErrQueue(b); !errors.Is(err, unix.EAGAIN) {
+		t.Fatalf("expected EAGAIN for empty error queue, but got: %v", err)
+	}
+
+	// Software transmit timestamps are delivered via the error queue.
+	rc, err := c.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to get syscall conn: %v", err)
+	}
+	if err := rc.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TIMESTAMPING,
+			unix.SOF_TIMESTAMPING_TX_SOFTWARE|unix.SOF_TIMESTAMPING_SOFTWARE)
+	}); err != nil {
+		t.Fatalf("failed to control: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("failed to enable SO_TIMESTAMPING: %v", err)
+	}
+
+	frame := testEthernetFrame(ifi, []byte("hello, errqueue"))
+	if _, err := c.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	// The timestamp is queued asynchronously, so poll briefly.
+	var ee *packet.SockExtendedErr
+	for i := 0; i < 100; i++ {
+		_, _, ee, err = c.ReadErrQueue(b)
+		if !errors.Is(err, unix.EAGAIN) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+	if errors.Is(err, unix.EAGAIN) {
+		t.Skip("skipping, no transmit timestamp was queued")
+	}
+	if err != nil {
+		t.Fatalf("failed to read error queue: %v", err)
+	}
+
+	want := &packet.SockExtendedErr{
+		Errno:  unix.ENOMSG,
+		Origin: packet.SockExtendedErrOriginTimestamping,
+	}
+	if diff := cmp.Diff(want, ee, cmpopts.IgnoreFields(packet.SockExtendedErr{}, "Info", "Data")); diff != "" {
+		t.Fatalf("unexpected extended error (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnSetNonblock(t *testing.T) {
+	// Protocol 0 receives no traffic, so the socket never has data to read.
+	ifi := testInterface(t)
+	c, err := packet.Listen(ifi, packet.Raw, 0, nil)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skipf("skipping, permission denied (try setting CAP_NET_RAW capability): %v", err)
+		}
+
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer c.Close()
+
+	rc, err := c.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to get syscall conn: %v", err)
+	}
+
+	for _, nonblocking := range []bool{false, true} {
+		if err := c.SetNonblock(nonblocking); err != nil {
+			t.Fatalf("failed to set nonblock %v: %v", nonblocking, err)
+		}
+
+		var flags int
+		if err := rc.Control(func(fd uintptr) {
+			flags, err = unix.FcntlInt(fd, unix.F_GETFL, 0)
+		}); err != nil {
+			t.Fatalf("failed to control: %v", err)
+		}
+		if err != nil {
+			t.Fatalf("failed to get flags: %v", err)
+		}
+
+		if got := flags&unix.O_NONBLOCK != 0; got != nonblocking {
+			t.Fatalf("unexpected O_NONBLOCK state: %v", got)
+		}
+	}
+
+	// A non-blocking read with no data available must not block.
+	if err := rc.Control(func(fd uintptr) {
+		_, _, err = unix.Recvfrom(int(fd), make([]byte, 1), 0)
+	}); err != nil {
+		t.Fatalf("failed to control: %v", err)
+	}
+	if !errors.Is(err, unix.EAGAIN) {
+		t.Fatalf("expected EAGAIN, but got: %v", err)
+	}
+}
+
+func TestConnWriteToFlags(t *testing.T) {
+	ifi := testInterface(t)
+	rx := testReceiver(t, ifi, nil)
+	tx := testListen(t, ifi, testEtherType, nil)
+
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	frame := testEthernetFrame(ifi, []byte("hello, flags"))
+	n, err := tx.WriteToFlags(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}, unix.MSG_DONTWAIT)
+	if err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+	if n != len(frame) {
+		t.Fatalf("unexpected number of bytes written: %d", n)
+	}
+
+	b := make([]byte, ifi.MTU)
+	n, _, err = rx.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if diff := cmp.Diff(frame, b[:n]); diff != "" {
+		t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnWriteCork(t *testing.T) {
+	ifi := testInterface(t)
+	rx := testReceiver(t, ifi, nil)
+	tx := testListen(t, ifi, testEtherType, nil)
+
+	frame := testEthernetFrame(ifi, []byte("hello, cork"))
+	addr := &packet.Addr{HardwareAddr: ethernetBroadcast}
+
+	// Write the header and payload separately while corked.
+	tx.WriteCork()
+	for _, b := range [][]byte{frame[:14], frame[14:]} {
+		if _, err := tx.WriteTo(b, addr); err != nil {
+			t.Fatalf("failed to write corked data: %v", err)
+		}
+	}
+
+	// Nothing is sent until the Conn is uncorked.
+	if err := rx.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	b := make([]byte, ifi.MTU)
+	if _, _, err := rx.ReadFrom(b); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected timeout while corked, but got: %v", err)
+	}
+
+	n, err := tx.WriteUncork()
+	if err != nil {
+		t.Fatalf("failed to uncork: %v", err)
+	}
+	if n != len(frame) {
+		t.Fatalf("unexpected number of bytes written: %d", n)
+	}
+
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	n, _, err = rx.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if diff := cmp.Diff(frame, b[:n]); diff != "" {
+		t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+	}
+
+	// Uncorking again writes nothing.
+	if n, err := tx.WriteUncork(); n != 0 || err != nil {
+		t.Fatalf("unexpected result from empty uncork: %d, %v", n, err)
+	}
+}
+
+func TestConnWriteCorkMTU(t *testing.T) {
+	ifi := testInterface(t)
+	tx := testListen(t, ifi, testEtherType, nil)
+
+	addr := &packet.Addr{HardwareAddr: ethernetBroadcast}
+
+	// A full frame fits, but a single byte more does not.
+	tx.WriteCork()
+	frame := testEthernetFrame(ifi, make([]byte, ifi.MTU))
+	if _, err := tx.WriteTo(frame, addr); err != nil {
+		t.Fatalf("failed to write corked data: %v", err)
+	}
+	if _, err := tx.WriteTo([]byte{0xff}, addr); !errors.Is(err, unix.EMSGSIZE) {
+		t.Fatalf("expected EMSGSIZE, but got: %v", err)
+	}
+
+	// The rejected write was not appended to the frame.
+	n, err := tx.WriteUncork()
+	if err != nil {
+		t.Fatalf("failed to uncork: %v", err)
+	}
+	if n != 14+ifi.MTU {
+		t.Fatalf("unexpected number of bytes written: %d", n)
+	}
+}
+
+func TestConnSetWriteBPF(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, nil)
+
+	filter, err := packet.MatchEtherType(testEtherType).Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+	if err := c.SetWriteBPF(filter); err != nil {
+		t.Fatalf("failed to set write filter: %v", err)
+	}
+
+	addr := &packet.Addr{HardwareAddr: ethernetBroadcast}
+	frame := testEthernetFrame(ifi, []byte("hello, write filter"))
+	if _, err := c.WriteTo(frame, addr); err != nil {
+		t.Fatalf("failed to write matching frame: %v", err)
+	}
+
+	// Change the EtherType so the frame no longer matches.
+	frame[13]++
+	if _, err := c.WriteTo(frame, addr); !errors.Is(err, unix.EPERM) {
+		t.Fatalf("expected EPERM for non-matching frame, but got: %v", err)
+	}
+
+	// Removing the filter allows the frame to be written.
+	if err := c.SetWriteBPF(nil); err != nil {
+		t.Fatalf("failed to remove write filter: %v", err)
+	}
+	if _, err := c.WriteTo(frame, addr); err != nil {
+		t.Fatalf("failed to write frame after removing filter: %v", err)
+	}
+}
+
+func TestConnDirection(t *testing.T) {
+	tests := []struct {
+		name string
+		d    packet.Direction
+		ok   bool
+	}{
+		{name: "in/out", d: packet.DirectionInOut, ok: true},
+		{name: "in", d: packet.DirectionIn},
+		{name: "out", d: packet.DirectionOut, ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// testSend produces outgoing frames, so only Conns which capture
+			// outgoing frames will receive them.
+			ifi := testInterface(t)
+			c := testReceiver(t, ifi, &packet.Config{Direction: tt.d})
+
+			if err := c.SetReadDeadline(time.Now().Add(1 * time.Second)); err != nil {
+				t.Fatalf("failed to set read deadline: %v", err)
+			}
+
+			testSend(t, ifi, []byte("hello, direction"))
+
+			_, _, err := c.ReadFrom(make([]byte, ifi.MTU))
+			if tt.ok && err != nil {
+				t.Fatalf("failed to read frame: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatalf("expected timeout, but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestConnLocalOnly(t *testing.T) {
+	ifi := testInterface(t)
+	c := testReceiver(t, ifi, &packet.Config{LocalOnly: true})
+
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	// Broadcast frames pass the LocalOnly filter and then testReceiver's
+	// EtherType filter.
+	testSend(t, ifi, []byte("hello, local"))
+
+	if _, _, err := c.ReadFrom(make([]byte, ifi.MTU)); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+}
+
+func TestListenConfigListen(t *testing.T) {
+	ifi := testInterface(t)
+
+	filter, err := packet.MatchEtherType(testEtherType).Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+
+	fanout := &packet.FanoutConfig{GroupID: 0x88b5, Type: packet.FanoutHash}
+	lc := packet.ListenConfig{}.
+		WithFilter(filter).
+		WithDirection(packet.DirectionOut).
+		WithFanout(fanout).
+		WithPromiscuous(true)
+
+	c, err := lc.Listen(ifi, packet.Raw, unix.ETH_P_ALL)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skipf("skipping, permission denied (try setting CAP_NET_RAW capability): %v", err)
+		}
+
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer c.Close()
+
+	// A Conn opened with an equivalent Config must join the same fanout
+	// group, which requires identical fanout settings, and have the same
+	// settings applied to its socket.
+	want := testListen(t, ifi, unix.ETH_P_ALL, &packet.Config{
+		Filter:      filter,
+		Direction:   packet.DirectionOut,
+		Fanout:      fanout,
+		Promiscuous: true,
+	})
+
+	// The attached program includes the DirectionOut prefix and Filter.
+	wantFilter, err := want.Filter()
+	if err != nil {
+		t.Fatalf("failed to get filter: %v", err)
+	}
+	gotFilter, err := c.Filter()
+	if err != nil {
+		t.Fatalf("failed to get filter: %v", err)
+	}
+	if len(gotFilter) <= len(filter) {
+		t.Fatalf("filter does not include direction prefix: %v", gotFilter)
+	}
+	if diff := cmp.Diff(wantFilter, gotFilter); diff != "" {
+		t.Fatalf("unexpected filter (-want +got):\n%s", diff)
+	}
+
+	id, ok, err := c.FanoutGroupID()
+	if err != nil {
+		t.Fatalf("failed to get fanout group ID: %v", err)
+	}
+	if !ok {
+		t.Fatal("Conn is not a member of a fanout group")
+	}
+	if diff := cmp.Diff(fanout.GroupID, id); diff != "" {
+		t.Fatalf("unexpected fanout group ID (-want +got):\n%s", diff)
+	}
+
+	ms, err := c.Memberships()
+	if err != nil {
+		t.Fatalf("failed to get memberships: %v", err)
+	}
+	if diff := cmp.Diff([]packet.Membership{{Type: packet.MembershipPromiscuous}}, ms); diff != "" {
+		t.Fatalf("unexpected memberships (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnRolloverStats(t *testing.T) {
+	ifi := testInterface(t)
+
+	// Rollover statistics are unavailable outside of a rollover group.
+	c := testListen(t, ifi, testEtherType, nil)
+	if _, err := c.RolloverStats(); !errors.Is(err, unix.EINVAL) {
+		t.Fatalf("expected EINVAL, but got: %v", err)
+	}
+
+	c = testListen(t, ifi, testEtherType, &packet.Config{
+		Fanout: &packet.FanoutConfig{
+			GroupID:  0x88b5,
+			Type:     packet.FanoutHash,
+			Rollover: true,
+		},
+	})
+
+	stats, err := c.RolloverStats()
+	if err != nil {
+		t.Fatalf("failed to get rollover stats: %v", err)
+	}
+
+	// No traffic, so no rollover should have occurred.
+	if diff := cmp.Diff(&packet.RolloverStats{}, stats); diff != "" {
+		t.Fatalf("unexpected rollover stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnIdleTimeout(t *testing.T) {
+	ifi := testInterface(t)
+	c := testReceiver(t, ifi, &packet.Config{IdleTimeout: 500 * time.Millisecond})
+
+	// A frame arrives before the idle timeout and resets the timer.
+	testSend(t, ifi, []byte("hello, idle"))
+
+	b := make([]byte, ifi.MTU)
+	if _, _, err := c.ReadFrom(b); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+
+	// No further frames arrive, so the blocked read is interrupted when the
+	// idle timer closes the Conn, despite the later deadline.
+	if err := c.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	start := time.Now()
+	if _, _, err := c.ReadFrom(b); !errors.Is(err, packet.ErrIdleTimeout) {
+		t.Fatalf("expected idle timeout, but got: %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("idle timeout took too long: %v", d)
+	}
+
+	// Subsequent reads also report the idle timeout.
+	if _, _, err := c.ReadFrom(b); !errors.Is(err, packet.ErrIdleTimeout) {
+		t.Fatalf("expected idle timeout, but got: %v", err)
+	}
+}
+
+func TestConnFilter(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, nil)
+
+	filter, err := c.Filter()
+	if err != nil {
+		t.Fatalf("failed to get filter: %v", err)
+	}
+	if filter != nil {
+		t.Fatalf("expected no filter, but got: %v", filter)
+	}
+
+	want, err := packet.MatchEtherType(testEtherType).
+		And(packet.MatchDestMAC(ethernetBroadcast)).
+		Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+	if err := c.SetBPF(want); err != nil {
+		t.Fatalf("failed to set filter: %v", err)
+	}
+
+	got, err := c.Filter()
+	if err != nil {
+		t.Fatalf("failed to get filter: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected filter (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnDrain(t *testing.T) {
+	ifi := testInterface(t)
+	rx := testReceiver(t, ifi, nil)
+	tx := testListen(t, ifi, testEtherType, nil)
+
+	const queued = 4
+	frame := testEthernetFrame(ifi, []byte("hello, drain"))
+	for i := 0; i < queued; i++ {
+		if _, err := tx.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+			t.Fatalf("failed to write frame: %v", err)
+		}
+	}
+
+	n, err := rx.Drain()
+	if err != nil {
+		t.Fatalf("failed to drain: %v", err)
+	}
+	if n != queued {
+		t.Fatalf("unexpected number of drained frames: %d", n)
+	}
+
+	if err := rx.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	if _, _, err := rx.ReadFrom(make([]byte, ifi.MTU)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected timeout after drain, but got: %v", err)
+	}
+}
+
+func TestConnOffloadSettings(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, nil)
+
+	o, err := c.OffloadSettings()
+	if err != nil {
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			t.Skipf("skipping, interface %q does not report offload settings: %v", ifi.Name, err)
+		}
+
+		t.Fatalf("failed to get offload settings: %v", err)
+	}
+
+	// The values depend on the interface, so compare against the ethtool
+	// utility when it is available.
+	out, err := exec.Command("ethtool", "-k", ifi.Name).Output()
+	if err != nil {
+		t.Logf("offloads for %q: %+v", ifi.Name, *o)
+		t.Skipf("skipping comparison, failed to run ethtool: %v", err)
+	}
+
+	for _, f := range []struct {
+		feature string
+		on      bool
+	}{
+		{feature: "generic-receive-offload", on: o.GRO},
+		{feature: "generic-segmentation-offload", on: o.GSO},
+		{feature: "large-receive-offload", on: o.LRO},
+		{feature: "rx-checksumming", on: o.RxChecksum},
+	} {
+		want := f.feature + ": off"
+		if f.on {
+			want = f.feature + ": on"
+		}
+
+		if !strings.Contains(string(out), want) {
+			t.Errorf("ethtool output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestConnStream(t *testing.T) {
+	ifi := testInterface(t)
+	rx := testReceiver(t, ifi, nil)
+	tx := testListen(t, ifi, testEtherType, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := rx.Stream(ctx, 1)
+
+	write := func(payload string) {
+		t.Helper()
+
+		if _, err := tx.WriteTo(testEthernetFrame(ifi, []byte(payload)), &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+			t.Fatalf("failed to write frame: %v", err)
+		}
+	}
+
+	// Frames flow while the consumer keeps up.
+	want := testEthernetFrame(ifi, []byte("hello, stream"))
+	write("hello, stream")
+	select {
+	case f := <-frames:
+		if diff := cmp.Diff(want, f.Data); diff != "" {
+			t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+		}
+		if f.Timestamp.IsZero() {
+			t.Fatal("frame has no timestamp")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for frame")
+	}
+
+	// Without a consumer, the Stream goroutine fills the channel, reads one
+	// more frame, and then stops reading, leaving the rest in the kernel.
+	const sent, left = 5, 3
+	for i := 0; i < sent; i++ {
+		write("hello, backpressure")
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+	for range frames {
+	}
+
+	if err := rx.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	var n int
+	for {
+		if _, _, err := rx.ReadFrom(make([]byte, ifi.MTU)); err != nil {
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatalf("failed to read: %v", err)
+			}
+			break
+		}
+		n++
+	}
+	if n != left {
+		t.Fatalf("unexpected number of frames left unread: want %d, got %d", left, n)
+	}
+}
+
+func TestConnFlowRule(t *testing.T) {
+	ifi := testInterface(t)
+	c := testListen(t, ifi, testEtherType, nil)
+
+	loc, err := c.InsertFlowRule(&packet.FlowRule{
+		EtherType:   testEtherType,
+		Destination: ifi.HardwareAddr,
+		Queue:       0,
+		Location:    packet.FlowRuleLocationAny,
+	})
+	if err != nil {
+		if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, os.ErrPermission) {
+			t.Skipf("skipping, interface %q does not support flow rules: %v", ifi.Name, err)
+		}
+
+		t.Fatalf("failed to insert flow rule: %v", err)
+	}
+
+	if err := c.RemoveFlowRule(loc); err != nil {
+		t.Fatalf("failed to remove flow rule: %v", err)
+	}
+}
+
+func TestConnRef(t *testing.T) {
+	ifi := testInterface(t)
+	c, err := packet.Listen(ifi, packet.Raw, testEtherType, nil)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skipf("skipping, permission denied (try setting CAP_NET_RAW capability): %v", err)
+		}
+
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	r := c.Ref()
+	if err := c.Close(); err != nil {
+		t.Fatalf("failed to close original Conn: %v", err)
+	}
+	if err := c.Close(); err == nil {
+		t.Fatal("expected an error closing Conn twice, but none occurred")
+	}
+
+	// The socket remains open for the remaining reference.
+	frame := testEthernetFrame(ifi, []byte("hello, ref"))
+	if _, err := r.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+		t.Fatalf("failed to write frame with remaining reference: %v", err)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("failed to close last reference: %v", err)
+	}
+	if _, err := r.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}); err == nil {
+		t.Fatal("expected an error writing to closed socket, but none occurred")
+	}
+}
+
+func TestConnReplaceFilter(t *testing.T) {
+	ifi := testInterface(t)
+	rx := testReceiver(t, ifi, nil)
+	tx := testListen(t, ifi, testEtherType, nil)
+
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	// Queue several frames which match the old filter but are never read.
+	addr := &packet.Addr{HardwareAddr: ethernetBroadcast}
+	old := testEthernetFrame(ifi, []byte("old"))
+	for i := 0; i < 3; i++ {
+		if _, err := tx.WriteTo(old, addr); err != nil {
+			t.Fatalf("failed to write old frame: %v", err)
+		}
+	}
+
+	const newEtherType = testEtherType + 1
+	filter, err := packet.MatchEtherType(newEtherType).Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+	if err := rx.ReplaceFilter(filter); err != nil {
+		t.Fatalf("failed to replace filter: %v", err)
+	}
+
+	// The first frame read must be the one matching the new filter.
+	frame := testEthernetFrame(ifi, []byte("new"))
+	binary.BigEndian.PutUint16(frame[12:14], newEtherType)
+	if _, err := tx.WriteTo(frame, addr); err != nil {
+		t.Fatalf("failed to write new frame: %v", err)
+	}
+
+	b := make([]byte, ifi.MTU)
+	n, _, err := rx.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if diff := cmp.Diff(frame, b[:n]); diff != "" {
+		t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+	}
+}
+
+func TestPool(t *testing.T) {
+	ifi := testInterface(t)
+
+	filter, err := packet.MatchEtherType(testEtherType).Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+	cfg := &packet.Config{Filter: filter}
+
+	var p packet.Pool
+	defer p.Close()
+
+	c, err := p.Get(ifi, packet.Raw, unix.ETH_P_ALL, cfg)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skipf("skipping, permission denied (try setting CAP_NET_RAW capability): %v", err)
+		}
+
+		t.Fatalf("failed to get: %v", err)
+	}
+
+	// Dirty the Conn's state: reject all frames and set a deadline which has
+	// already passed.
+	drop, err := bpf.Assemble([]bpf.Instruction{bpf.RetConstant{Val: 0}})
+	if err != nil {
+		t.Fatalf("failed to assemble drop filter: %v", err)
+	}
+	if err := c.SetBPF(drop); err != nil {
+		t.Fatalf("failed to set filter: %v", err)
+	}
+	if err := c.SetReadDeadline(time.Unix(1, 0)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	if err := c.SetWriteBPF(drop); err != nil {
+		t.Fatalf("failed to set write filter: %v", err)
+	}
+	if err := c.SetPromiscuous(true); err != nil {
+		t.Fatalf("failed to enable promiscuous mode: %v", err)
+	}
+	c.WriteCork()
+	if _, err := c.WriteTo([]byte{0xff}, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+		t.Fatalf("failed to write corked frame: %v", err)
+	}
+	if err := c.Pause(); err != nil {
+		t.Fatalf("failed to pause: %v", err)
+	}
+
+	fd := testFD(t, c)
+	if err := p.Put(c); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	// An equal Config need not be the same *Config.
+	c, err = p.Get(ifi, packet.Raw, unix.ETH_P_ALL, &packet.Config{Filter: filter})
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	defer c.Close()
+
+	if diff := cmp.Diff(fd, testFD(t, c)); diff != "" {
+		t.Fatalf("Conn was not reused (-want +got):\n%s", diff)
+	}
+
+	ms, err := c.Memberships()
+	if err != nil {
+		t.Fatalf("failed to get memberships: %v", err)
+	}
+	if len(ms) != 0 {
+		t.Fatalf("memberships were not dropped: %v", ms)
+	}
+
+	// A paused Conn rejects filter changes, so this verifies that the pause
+	// was cleared.
+	if err := c.SetBPF(filter); err != nil {
+		t.Fatalf("failed to set filter: %v", err)
+	}
+
+	// If the write filter or cork persisted, the frame would be rejected or
+	// buffered rather than written.
+	rx := testReceiver(t, ifi, nil)
+	if err := rx.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	frame := testEthernetFrame(ifi, []byte("hello, pool writer"))
+	if _, err := c.WriteTo(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	b := make([]byte, ifi.MTU)
+	n, _, err := rx.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read written frame: %v", err)
+	}
+	if diff := cmp.Diff(frame, b[:n]); diff != "" {
+		t.Fatalf("unexpected written frame (-want +got):\n%s", diff)
+	}
+
+	// If the deadline or drop filter persisted, the read would time out
+	// immediately or block until the timer fires and closes the Conn.
+	timer := time.AfterFunc(5*time.Second, func() { _ = c.Close() })
+	defer timer.Stop()
+
+	payload := []byte("hello, pool")
+	testSend(t, ifi, payload)
+
+	n, _, err = c.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if got := b[14:n]; string(got) != string(payload) {
+		t.Fatalf("unexpected payload: %q", got)
+	}
+
+	// Socket options cannot be restored, so the Conn is closed rather than
+	// reused.
+	if err := c.SetReadLowWater(1); err != nil {
+		t.Fatalf("failed to set low water mark: %v", err)
+	}
+	if err := p.Put(c); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := c.Close(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected closed Conn, but got: %v", err)
+	}
+
+	// Likewise for SO_TXTIME, which is enabled even if the write fails.
+	c, err = p.Get(ifi, packet.Raw, unix.ETH_P_ALL, cfg)
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	_, _ = c.WriteToAt(frame, &packet.Addr{HardwareAddr: ethernetBroadcast}, time.Now())
+	if err := p.Put(c); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := c.Close(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected closed Conn, but got: %v", err)
+	}
+}
+
+func TestPoolInterfaceRemoved(t *testing.T) {
+	ifi := testVeth(t)
+	cfg := &packet.Config{CloseOnInterfaceRemoved: true}
+
+	var p packet.Pool
+	defer p.Close()
+
+	c, err := p.Get(ifi, packet.Raw, testEtherType, cfg)
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	if err := p.Put(c); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	if out, err := exec.Command("ip", "link", "del", ifi.Name).CombinedOutput(); err != nil {
+		t.Fatalf("failed to delete veth interface: %v: %s", err, out)
+	}
+
+	// Once the idle Conn is closed by the removal, Get must not return it,
+	// and opening a new Conn fails.
+	timeout := time.After(5 * time.Second)
+	for {
+		c, err := p.Get(ifi, packet.Raw, testEtherType, cfg)
+		if err != nil {
+			if !errors.Is(err, packet.ErrInterfaceUnavailable) {
+				t.Fatalf("expected ErrInterfaceUnavailable, but got: %v", err)
+			}
+			return
+		}
+		if err := p.Put(c); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+
+		select {
+		case <-timeout:
+			t.Fatal("timed out waiting for the idle Conn to be dropped")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	ifi := testInterface(t)
+	cfg := &packet.Config{IdleTimeout: 50 * time.Millisecond}
+
+	var p packet.Pool
+	defer p.Close()
+
+	c, err := p.Get(ifi, packet.Raw, testEtherType, cfg)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skipf("skipping, permission denied (try setting CAP_NET_RAW capability): %v", err)
+		}
+
+		t.Fatalf("failed to get: %v", err)
+	}
+	if err := p.Put(c); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	// The idle timer must not close the Conn while it sits in the Pool.
+	time.Sleep(100 * time.Millisecond)
+
+	c, err = p.Get(ifi, packet.Raw, testEtherType, cfg)
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	defer c.Close()
+
+	// Once handed out again, the timer closes the idle Conn.
+	b := make([]byte, ifi.MTU)
+	if _, _, err := c.ReadFrom(b); !errors.Is(err, packet.ErrIdleTimeout) {
+		t.Fatalf("expected idle timeout, but got: %v", err)
+	}
+}
+
 // testConn produces a *packet.Conn bound to the returned *net.Interface. The
 // caller does not need to call Close on the *packet.Conn.
 func testConn(t *testing.T) (*packet.Conn, *net.Interface) {
@@ -94,7 +3767,36 @@ func testConn(t *testing.T) (*packet.Conn, *net.Interface) {
 
 	// TODO(mdlayher): probably parameterize the EtherType.
 	ifi := testInterface(t)
-	c, err := packet.Listen(ifi, packet.Raw, unix.ETH_P_ALL, nil)
+	return testListen(t, ifi, unix.ETH_P_ALL, nil), ifi
+}
+
+// testFD returns the file descriptor of c's socket.
+func testFD(t *testing.T, c *packet.Conn) int {
+	t.Helper()
+
+	rc, err := c.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to get syscall conn: %v", err)
+	}
+
+	var fd int
+	if err := rc.Control(func(sfd uintptr) { fd = int(sfd) }); err != nil {
+		t.Fatalf("failed to control: %v", err)
+	}
+
+	return fd
+}
+
+// testEtherType is an EtherType reserved for local experimentation, used for
+// frames sent and received by tests.
+const testEtherType = 0x88b5
+
+// testListen produces a *packet.Conn bound to ifi with the input protocol and
+// configuration. The caller does not need to call Close on the *packet.Conn.
+func testListen(t *testing.T, ifi *net.Interface, protocol int, cfg *packet.Config) *packet.Conn {
+	t.Helper()
+
+	c, err := packet.Listen(ifi, packet.Raw, protocol, cfg)
 	if err != nil {
 		if errors.Is(err, os.ErrPermission) {
 			t.Skipf("skipping, permission denied (try setting CAP_NET_RAW capability): %v", err)
@@ -104,9 +3806,55 @@ func testConn(t *testing.T) (*packet.Conn, *net.Interface) {
 	}
 
 	t.Cleanup(func() { c.Close() })
-	return c, ifi
+	return c
+}
+
+// testReceiver produces a *packet.Conn bound to ifi which receives only frames
+// carrying testEtherType, including outgoing frames sent by testSend. cfg must
+// not set a Filter. The caller does not need to call Close on the
+// *packet.Conn.
+func testReceiver(t *testing.T, ifi *net.Interface, cfg *packet.Config) *packet.Conn {
+	t.Helper()
+
+	filter, err := packet.MatchEtherType(testEtherType).Assemble()
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+
+	if cfg == nil {
+		cfg = &packet.Config{}
+	}
+	cfg.Filter = filter
+
+	// Outgoing frames are only delivered to sockets bound to ETH_P_ALL.
+	return testListen(t, ifi, unix.ETH_P_ALL, cfg)
+}
+
+// testSend broadcasts an Ethernet frame carrying testEtherType and payload on
+// ifi. The frame is sent from a separate Conn, so any Conns bound to ifi will
+// receive it as an outgoing frame.
+func testSend(t *testing.T, ifi *net.Interface, payload []byte) {
+	t.Helper()
+
+	c := testListen(t, ifi, testEtherType, nil)
+	if _, err := c.WriteTo(testEthernetFrame(ifi, payload), &packet.Addr{HardwareAddr: ethernetBroadcast}); err != nil {
+		t.Fatalf("failed to send frame: %v", err)
+	}
+}
+
+// testEthernetFrame produces a broadcast Ethernet frame from ifi which carries
+// testEtherType and payload.
+func testEthernetFrame(ifi *net.Interface, payload []byte) []byte {
+	b := make([]byte, 0, 6+6+2+len(payload))
+	b = append(b, ethernetBroadcast...)
+	b = append(b, ifi.HardwareAddr...)
+	b = binary.BigEndian.AppendUint16(b, testEtherType)
+	return append(b, payload...)
 }
 
+// ethernetBroadcast is the Ethernet broadcast address.
+var ethernetBroadcast = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
 // testInterface looks for a suitable Ethernet interface to bind a *packet.Conn.
 func testInterface(t *testing.T) *net.Interface {
 	ifis, err := net.Interfaces()
@@ -138,3 +3886,184 @@ func testInterface(t *testing.T) *net.Interface {
 	t.Skipf("skipping, could not find a usable network interface, tried: %s", tried)
 	panic("unreachable")
 }
+
+// testVeth creates a veth pair and returns one of its interfaces. The pair is
+// removed when the test completes, if it still exists.
+func testVeth(t *testing.T) *net.Interface {
+	t.Helper()
+
+	const name = "pkttest0"
+	out, err := exec.Command("ip", "link", "add", name, "type", "veth", "peer", "name", name+"p").CombinedOutput()
+	if err != nil {
+		t.Skipf("skipping, failed to create veth pair: %v: %s", err, out)
+	}
+	// Delete the peer in case the test renames the interface.
+	t.Cleanup(func() { _ = exec.Command("ip", "link", "del", name+"p").Run() })
+
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		t.Fatalf("failed to get veth interface: %v", err)
+	}
+
+	return ifi
+}
+
+// testChecksum returns the ones' complement sum of b added to initial, folded
+// to 16 bits.
+func testChecksum(b []byte, initial uint32) uint16 {
+	sum := initial
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+
+	return uint16(sum)
+}
+
+// testSetTxChecksum enables or disables transmit checksum offload on ifi using
+// the ETHTOOL_STXCSUM ioctl, and restores the previous setting when the test
+// completes.
+func testSetTxChecksum(t *testing.T, ifi *net.Interface, enable bool) {
+	t.Helper()
+
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("failed to open socket: %v", err)
+	}
+	t.Cleanup(func() { _ = unix.Close(fd) })
+
+	// struct ethtool_value.
+	type value struct{ cmd, data uint32 }
+
+	ethtool := func(v *value) error {
+		var ifr struct {
+			name [unix.IFNAMSIZ]byte
+			data unsafe.Pointer
+			_    [16]byte
+		}
+		copy(ifr.name[:unix.IFNAMSIZ-1], ifi.Name)
+		ifr.data = unsafe.Pointer(v)
+
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCETHTOOL, uintptr(unsafe.Pointer(&ifr)))
+		if errno != 0 {
+			return errno
+		}
+
+		return nil
+	}
+
+	prev := value{cmd: unix.ETHTOOL_GTXCSUM}
+	if err := ethtool(&prev); err != nil {
+		t.Skipf("skipping, failed to get transmit checksum offload: %v", err)
+	}
+
+	var data uint32
+	if enable {
+		data = 1
+	}
+	if err := ethtool(&value{cmd: unix.ETHTOOL_STXCSUM, data: data}); err != nil {
+		if errors.Is(err, unix.EPERM) {
+			t.Skipf("skipping, permission denied (try setting CAP_NET_ADMIN capability): %v", err)
+		}
+
+		t.Fatalf("failed to set transmit checksum offload: %v", err)
+	}
+
+	t.Cleanup(func() { _ = ethtool(&value{cmd: unix.ETHTOOL_STXCSUM, data: prev.data}) })
+}
+
+// testSysfsPromiscuous reports whether ifi is promiscuous for any reason,
+// including PACKET_MR_PROMISC memberships.
+func testSysfsPromiscuous(t *testing.T, ifi *net.Interface) bool {
+	t.Helper()
+	return testSysfsFlags(t, ifi)&unix.IFF_PROMISC != 0
+}
+
+// testSysfsFlags returns the IFF_* flags of ifi.
+func testSysfsFlags(t *testing.T, ifi *net.Interface) uint64 {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("/sys/class/net", ifi.Name, "flags"))
+	if err != nil {
+		t.Fatalf("failed to read interface flags: %v", err)
+	}
+
+	flags, err := strconv.ParseUint(strings.TrimSpace(string(b)), 0, 32)
+	if err != nil {
+		t.Fatalf("failed to parse interface flags: %v", err)
+	}
+
+	return flags
+}
+
+// testLoadeBPF loads an eBPF socket filter program which returns ret for all
+// frames, and returns its file descriptor. As a filter, a ret of 0xffffffff
+// accepts the entire frame.
+func testLoadeBPF(t *testing.T, ret uint32) int {
+	t.Helper()
+
+	// struct bpf_insn: r0 = ret, then exit.
+	insns := make([]byte, 16)
+	insns[0] = unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K
+	native.Endian.PutUint32(insns[4:8], ret)
+	insns[8] = unix.BPF_JMP | unix.BPF_EXIT
+	license := []byte("MIT\x00")
+
+	attr := struct {
+		progType    uint32
+		insnCnt     uint32
+		insns       uint64
+		license     uint64
+		logLevel    uint32
+		logSize     uint32
+		logBuf      uint64
+		kernVersion uint32
+		progFlags   uint32
+	}{
+		progType: unix.BPF_PROG_TYPE_SOCKET_FILTER,
+		insnCnt:  uint32(len(insns) / 8),
+		insns:    uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+	}
+
+	fd, _, errno := unix.Syscall(
+		unix.SYS_BPF,
+		unix.BPF_PROG_LOAD,
+		uintptr(unsafe.Pointer(&attr)),
+		unsafe.Sizeof(attr),
+	)
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	if errno != 0 {
+		t.Skipf("skipping, failed to load eBPF program: %v", errno)
+	}
+
+	return int(fd)
+}
+
+// testIfreqPromiscuous reports whether ifi has the user-visible IFF_PROMISC
+// flag set.
+func testIfreqPromiscuous(t *testing.T, ifi *net.Interface) bool {
+	t.Helper()
+
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("failed to open socket: %v", err)
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq(ifi.Name)
+	if err != nil {
+		t.Fatalf("failed to create ifreq: %v", err)
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		t.Fatalf("failed to get interface flags: %v", err)
+	}
+
+	return ifr.Uint16()&unix.IFF_PROMISC != 0
+}
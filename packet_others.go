@@ -16,16 +16,92 @@ import (
 // errUnimplemented is returned by all functions on non-Linux platforms.
 var errUnimplemented = fmt.Errorf("packet: not implemented on %s", runtime.GOOS)
 
-func listen(_ *net.Interface, _ Type, _ int, _ *Config) (*Conn, error) { return nil, errUnimplemented }
+func listen(_ *net.Interface, _ Type, _ int, _ []int, _ *Config) (*Conn, error) {
+	return nil, errUnimplemented
+}
 
-func (*Conn) readFrom(_ []byte) (int, net.Addr, error)  { return 0, nil, errUnimplemented }
-func (*Conn) writeTo(_ []byte, _ net.Addr) (int, error) { return 0, errUnimplemented }
-func (*Conn) setPromiscuous(_ bool) error               { return errUnimplemented }
-func (*Conn) stats() (*Stats, error)                    { return nil, errUnimplemented }
+func probe(_ Feature) (bool, error) { return false, nil }
+
+func checkCapabilities() error { return errUnimplemented }
+
+func pinToCPU(_ int) error { return errUnimplemented }
+
+func validateConfig(_ Type, _ int, _ *Config) error { return errUnimplemented }
+
+func (*Conn) close() error                               { return errUnimplemented }
+func (*Conn) drain() (int, error)                        { return 0, errUnimplemented }
+func (*Conn) filter() ([]bpf.RawInstruction, error)      { return nil, errUnimplemented }
+func (*Conn) readFrom(_ []byte) (int, net.Addr, error)   { return 0, nil, errUnimplemented }
+func (*Conn) writeTo(_ []byte, _ net.Addr) (int, error)  { return 0, errUnimplemented }
+func (*Conn) setPromiscuous(_ bool) error                { return errUnimplemented }
+func (*Conn) setAllMulticast(_ bool) error               { return errUnimplemented }
+func (*Conn) joinGroup(_ net.HardwareAddr) error         { return errUnimplemented }
+func (*Conn) leaveGroup(_ net.HardwareAddr) error        { return errUnimplemented }
+func (*Conn) listMemberships() ([]Membership, error)     { return nil, errUnimplemented }
+func (*Conn) setInterfacePromiscuous(_ bool) error       { return errUnimplemented }
+func (*Conn) setNonblock(_ bool) error                   { return errUnimplemented }
+func (*Conn) setNoFCS(_ bool) error                      { return errUnimplemented }
+func (*Conn) pause() error                               { return errUnimplemented }
+func (*Conn) resume() error                              { return errUnimplemented }
+func (*Conn) setsockoptInt(_, _, _ int) error            { return errUnimplemented }
+func (*Conn) getsockoptInt(_, _ int) (int, error)        { return 0, errUnimplemented }
+func (*Conn) seteBPF(_ int) error                        { return errUnimplemented }
+func (*Conn) removeeBPF() error                          { return errUnimplemented }
+func (*Conn) setBusyPoll(_ int) error                    { return errUnimplemented }
+func (*Conn) setMaxPacingRate(_ uint64) error            { return errUnimplemented }
+func (*Conn) setReadLowWater(_ int) error                { return errUnimplemented }
+func (*Conn) incomingNAPIID() (uint32, error)            { return 0, errUnimplemented }
+func (*Conn) fanoutGroupID() (uint16, bool, error)       { return 0, false, errUnimplemented }
+func (*Conn) incomingCPU() (int, error)                  { return 0, errUnimplemented }
+func (*Conn) sendBuffered() (int, error)                 { return 0, errUnimplemented }
+func (*Conn) stats() (*Stats, error)                     { return nil, errUnimplemented }
+func (*Conn) offloadSettings() (*Offloads, error)        { return nil, errUnimplemented }
+func (*Conn) linkSpeed() (uint64, error)                 { return 0, errUnimplemented }
+func (*Conn) broadcastAddr() (net.HardwareAddr, error)   { return nil, errUnimplemented }
+func (*Conn) phcIndex() (int, error)                     { return 0, errUnimplemented }
+func (*Conn) timestampCapabilities() (*TSCaps, error)    { return nil, errUnimplemented }
+func (*Conn) sockname() (*Addr, error)                   { return nil, errUnimplemented }
+func (*Conn) willEgressInterface() (int, error)          { return 0, errUnimplemented }
+func (*Conn) rolloverStats() (*RolloverStats, error)     { return nil, errUnimplemented }
+func (*Conn) reset(_ *Config) error                      { return errUnimplemented }
+func (*Conn) replaceFilter(_ []bpf.RawInstruction) error { return errUnimplemented }
+
+func (*Conn) readFromVnetHdr(_ []byte) (int, *VnetHdr, net.Addr, error) {
+	return 0, nil, nil, errUnimplemented
+}
+
+func (*Conn) readFromAuxdata(_ []byte) (int, *Auxdata, net.Addr, error) {
+	return 0, nil, nil, errUnimplemented
+}
+
+func (*Conn) readFromBy(_ []byte, _ time.Time) (int, net.Addr, error) {
+	return 0, nil, errUnimplemented
+}
+
+func (*Conn) readFromMetadata(_ []byte) (int, *RecvMeta, error) {
+	return 0, nil, errUnimplemented
+}
+
+func (*Conn) writeToVnetHdr(_ []byte, _ *VnetHdr, _ net.Addr) (int, error) {
+	return 0, errUnimplemented
+}
+
+func (*Conn) readErrQueue(_ []byte) (int, net.Addr, *SockExtendedErr, error) {
+	return 0, nil, nil, errUnimplemented
+}
+
+func (*Conn) writeToFlags(_ []byte, _ net.Addr, _ int) (int, error) {
+	return 0, errUnimplemented
+}
+
+func (*Conn) writeToAt(_ []byte, _ net.Addr, _ time.Time) (int, error) {
+	return 0, errUnimplemented
+}
 
 type conn struct{}
 
-func (*conn) Close() error                          { return errUnimplemented }
+type linkMonitor struct{}
+
 func (*conn) SetDeadline(_ time.Time) error         { return errUnimplemented }
 func (*conn) SetReadDeadline(_ time.Time) error     { return errUnimplemented }
 func (*conn) SetWriteDeadline(_ time.Time) error    { return errUnimplemented }
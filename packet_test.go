@@ -0,0 +1,51 @@
+package packet_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/packet"
+)
+
+func TestStatsString(t *testing.T) {
+	s := &packet.Stats{
+		Packets:          10,
+		Drops:            2,
+		BufferDrops:      2,
+		FreezeQueueCount: 1,
+	}
+
+	const want = "packets: 10, drops: 2, buffer drops: 2, freeze queue count: 1"
+	if diff := cmp.Diff(want, s.String()); diff != "" {
+		t.Fatalf("unexpected string (-want +got):\n%s", diff)
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	want := &packet.Stats{
+		Packets:          10,
+		Drops:            2,
+		BufferDrops:      2,
+		FreezeQueueCount: 1,
+	}
+
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	const js = `{"packets":10,"drops":2,"buffer_drops":2,"freeze_queue_count":1}`
+	if diff := cmp.Diff(js, string(b)); diff != "" {
+		t.Fatalf("unexpected JSON (-want +got):\n%s", diff)
+	}
+
+	var got packet.Stats
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if diff := cmp.Diff(want, &got); diff != "" {
+		t.Fatalf("unexpected Stats (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,246 @@
+package packet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// A Pool caches idle Conns so that they may be reused, amortizing the cost of
+// calling Listen and Close for workloads which rapidly open and close Conns.
+//
+// Conns are keyed by their network interface, socket type, protocol, and
+// Config. Configs are compared by value, except that Configs which set
+// OnInterfaceRemoved or BufferPool only match the same *Config, as functions
+// and interfaces cannot be compared reliably. Config.ListenRetry only affects
+// Listen and is ignored. The zero value of Pool is ready to use. A Pool is
+// safe for concurrent use.
+type Pool struct {
+	mu     sync.Mutex
+	idle   map[poolKey][]*Conn
+	active map[*Conn]poolEntry
+	closed bool
+}
+
+// A poolKey identifies the parameters used to open a Conn.
+type poolKey struct {
+	ifIndex  int
+	typ      Type
+	protocol int
+	cfg      poolConfig
+}
+
+// A poolConfig is the comparable form of a Config used in a poolKey.
+type poolConfig struct {
+	filter                  string
+	filterAfterBind         bool
+	closeOnInterfaceRemoved bool
+	vnetHdr                 bool
+	direction               Direction
+	fanout                  FanoutConfig
+	hasFanout               bool
+	localOnly               bool
+	promiscuous             bool
+	strictSourceMAC         bool
+	idleTimeout             time.Duration
+	originalDevice          bool
+	auxdata                 bool
+	maxReadRate             int
+	maxReadRateDrop         bool
+	maxPackets              int
+	cumulativeStats         bool
+
+	// The Config itself, if it sets fields which cannot be compared.
+	identity *Config
+}
+
+// newPoolConfig produces the poolConfig for cfg.
+func newPoolConfig(cfg *Config) poolConfig {
+	pc := poolConfig{
+		filter:                  fmt.Sprint(cfg.Filter),
+		filterAfterBind:         cfg.FilterAfterBind,
+		closeOnInterfaceRemoved: cfg.CloseOnInterfaceRemoved,
+		vnetHdr:                 cfg.VnetHdr,
+		direction:               cfg.Direction,
+		localOnly:               cfg.LocalOnly,
+		promiscuous:             cfg.Promiscuous,
+		strictSourceMAC:         cfg.StrictSourceMAC,
+		idleTimeout:             cfg.IdleTimeout,
+		originalDevice:          cfg.OriginalDevice,
+		auxdata:                 cfg.Auxdata,
+		maxReadRate:             cfg.MaxReadRate,
+		maxReadRateDrop:         cfg.MaxReadRateDrop,
+		maxPackets:              cfg.MaxPackets,
+		cumulativeStats:         cfg.CumulativeStats,
+	}
+	if cfg.Fanout != nil {
+		pc.fanout, pc.hasFanout = *cfg.Fanout, true
+	}
+	if cfg.OnInterfaceRemoved != nil || cfg.BufferPool != nil {
+		pc.identity = cfg
+	}
+
+	return pc
+}
+
+// A poolEntry tracks a Conn which was handed out by a Pool.
+type poolEntry struct {
+	key poolKey
+	cfg *Config
+}
+
+// Get returns an idle Conn matching the input parameters, or opens a new Conn
+// using Listen if none is available. The parameters have the same meaning as
+// those of Listen.
+//
+// Conns returned by Get should be returned to the Pool with Put, or closed
+// with Close if they are no longer usable.
+func (p *Pool) Get(ifi *net.Interface, socketType Type, protocol int, cfg *Config) (*Conn, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	key := poolKey{
+		ifIndex:  ifi.Index,
+		typ:      socketType,
+		protocol: protocol,
+		cfg:      newPoolConfig(cfg),
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errPoolClosed
+	}
+
+	for cs := p.idle[key]; len(cs) > 0; cs = p.idle[key] {
+		var c *Conn
+		c, p.idle[key] = cs[len(cs)-1], cs[:len(cs)-1]
+		if c.closed.Load() {
+			// c was closed while idle, such as by
+			// Config.CloseOnInterfaceRemoved, so drop it.
+			continue
+		}
+
+		p.activate(c, key, cfg)
+		p.mu.Unlock()
+
+		// Put stopped the idle timer, so start it again for the new user.
+		if c.idleTimer != nil {
+			c.idleTimer.Reset(c.idleTimeout)
+		}
+
+		return c, nil
+	}
+	p.mu.Unlock()
+
+	// Don't hold the lock while opening a socket so that other callers need
+	// not wait.
+	c, err := Listen(ifi, socketType, protocol, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		_ = c.Close()
+		return nil, errPoolClosed
+	}
+
+	p.activate(c, key, cfg)
+	return c, nil
+}
+
+// activate records that c is in use. The caller must hold p.mu.
+func (p *Pool) activate(c *Conn, key poolKey, cfg *Config) {
+	if p.active == nil {
+		p.active = make(map[*Conn]poolEntry)
+	}
+	p.active[c] = poolEntry{key: key, cfg: cfg}
+}
+
+// Put resets c to a clean state and returns it to the Pool for reuse. c must
+// have been returned by a call to Get on the same Pool, and must not be used
+// by the caller after Put is called.
+//
+// Resetting a Conn restores the state it had when Listen returned: it clears
+// its deadlines, write filter, corked frame, read buffer installed by
+// SwapReadBuffer, Config.MaxPackets count, and Config.MaxReadRate limiter,
+// resumes a paused Conn, sets it to non-blocking mode, restores its
+// memberships and the BPF filter specified by Config, and discards any frames
+// queued on its socket. The idle timer of Config.IdleTimeout is stopped until
+// the Conn is returned by Get again. If c cannot be reset, it is closed and an
+// error is returned.
+//
+// Get discards idle Conns which were closed while in the Pool, such as by
+// Config.CloseOnInterfaceRemoved.
+//
+// Socket options set by SetReadLowWater, SetBusyPoll, SetMaxPacingRate,
+// SetNoFCS, or SetsockoptInt, or enabled by WriteToAt, cannot be restored, so
+// Put closes Conns on which they were set rather than reusing them.
+func (p *Pool) Put(c *Conn) error {
+	p.mu.Lock()
+	e, ok := p.active[c]
+	if !ok {
+		p.mu.Unlock()
+		return errors.New("packet: Conn does not belong to Pool")
+	}
+	delete(p.active, c)
+	closed := p.closed
+	p.mu.Unlock()
+
+	if closed || c.sockoptsChanged.Load() {
+		return c.Close()
+	}
+
+	if err := c.reset(e.cfg); err != nil {
+		_ = c.Close()
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The Pool may have been closed while c was being reset.
+	if p.closed {
+		return c.Close()
+	}
+
+	if p.idle == nil {
+		p.idle = make(map[poolKey][]*Conn)
+	}
+	p.idle[e.key] = append(p.idle[e.key], c)
+
+	return nil
+}
+
+// Close closes all idle Conns in the Pool. Conns which are in use are closed
+// when they are returned with Put. Get returns an error after Close is called.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+
+	var errs []error
+	for _, cs := range p.idle {
+		for _, c := range cs {
+			if c.closed.Load() {
+				continue
+			}
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	p.idle = nil
+
+	return errors.Join(errs...)
+}
+
+// errPoolClosed is returned by Pool.Get after Pool.Close is called.
+var errPoolClosed = errors.New("packet: use of closed Pool")
@@ -0,0 +1,53 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/josharian/native"
+)
+
+// HostToNetworkProtocol converts a protocol value such as an EtherType from
+// host byte order to the network byte order used by the Linux kernel for the
+// sll_protocol field of a struct sockaddr_ll and for the protocol argument of
+// socket(2). It returns an error if protocol does not fit in 16 bits.
+//
+// The result is intended to be stored directly in memory shared with the
+// kernel, such as unix.SockaddrLinklayer.Protocol. It is not the EtherType
+// value itself on little endian machines.
+func HostToNetworkProtocol(protocol int) (uint16, error) { return htons(protocol) }
+
+// NetworkToHostProtocol converts a protocol value reported by the Linux kernel
+// in network byte order, such as the sll_protocol field of a struct
+// sockaddr_ll, to a protocol value such as an EtherType in host byte order.
+// It is the inverse of HostToNetworkProtocol.
+func NetworkToHostProtocol(protocol uint16) int { return int(ntohs(protocol)) }
+
+// htons converts a short (uint16) from host-to-network byte order.
+func htons(i int) (uint16, error) { return htonsOrder(i, native.Endian) }
+
+// ntohs converts a short (uint16) from network-to-host byte order.
+func ntohs(i uint16) uint16 { return ntohsOrder(i, native.Endian) }
+
+// htonsOrder implements htons for a host using the specified byte order.
+func htonsOrder(i int, order binary.ByteOrder) (uint16, error) {
+	if i < 0 || i > math.MaxUint16 {
+		return 0, errors.New("packet: protocol value out of range")
+	}
+
+	// Store as big endian, retrieve as host endian.
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(i))
+
+	return order.Uint16(b[:]), nil
+}
+
+// ntohsOrder implements ntohs for a host using the specified byte order.
+func ntohsOrder(i uint16, order binary.ByteOrder) uint16 {
+	// Store as host endian, retrieve as big endian.
+	var b [2]byte
+	order.PutUint16(b[:], i)
+
+	return binary.BigEndian.Uint16(b[:])
+}
@@ -0,0 +1,73 @@
+package packet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/josharian/native"
+)
+
+func TestProtocolByteOrder(t *testing.T) {
+	// The network byte order value as stored in host memory, for each byte
+	// order.
+	tests := []struct {
+		protocol int
+		le, be   uint16
+	}{
+		{protocol: 0x0003, le: 0x0300, be: 0x0003},
+		{protocol: 0x0800, le: 0x0008, be: 0x0800},
+		{protocol: 0x86dd, le: 0xdd86, be: 0x86dd},
+	}
+
+	for _, order := range testByteOrders {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/%#04x", order, tt.protocol), func(t *testing.T) {
+				want := tt.le
+				if order == binary.ByteOrder(binary.BigEndian) {
+					want = tt.be
+				}
+
+				got, err := htonsOrder(tt.protocol, order)
+				if err != nil {
+					t.Fatalf("failed to convert protocol: %v", err)
+				}
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Fatalf("unexpected network value (-want +got):\n%s", diff)
+				}
+
+				if diff := cmp.Diff(tt.protocol, int(ntohsOrder(got, order))); diff != "" {
+					t.Fatalf("unexpected host value (-want +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
+
+func TestHostToNetworkProtocol(t *testing.T) {
+	for _, p := range []int{-1, math.MaxUint16 + 1} {
+		if _, err := HostToNetworkProtocol(p); err == nil {
+			t.Fatalf("expected an error for protocol %d, but none occurred", p)
+		}
+	}
+
+	for _, p := range []int{0, 0x0003, 0x0800, 0x86dd, math.MaxUint16} {
+		v, err := HostToNetworkProtocol(p)
+		if err != nil {
+			t.Fatalf("failed to convert protocol %#04x: %v", p, err)
+		}
+
+		// In memory, the value must always be big endian.
+		var b [2]byte
+		native.Endian.PutUint16(b[:], v)
+		if diff := cmp.Diff(uint16(p), binary.BigEndian.Uint16(b[:])); diff != "" {
+			t.Fatalf("unexpected in-memory value (-want +got):\n%s", diff)
+		}
+
+		if diff := cmp.Diff(p, NetworkToHostProtocol(v)); diff != "" {
+			t.Fatalf("unexpected round trip value (-want +got):\n%s", diff)
+		}
+	}
+}
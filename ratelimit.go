@@ -0,0 +1,85 @@
+package packet
+
+import (
+	"sync"
+	"time"
+)
+
+// A rateLimiter is a token bucket which limits the rate of frames delivered by
+// reads on a Conn.
+type rateLimiter struct {
+	// now is time.Now, or a fake clock in tests.
+	now func() time.Time
+
+	mu     sync.Mutex
+	rate   float64 // Tokens added per second.
+	burst  float64 // Maximum number of tokens.
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter creates a rateLimiter which permits rate frames per second,
+// with bursts of up to 10 milliseconds' worth of frames.
+func newRateLimiter(rate int, now func() time.Time) *rateLimiter {
+	burst := float64(rate) / 100
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		now:    now,
+		rate:   float64(rate),
+		burst:  burst,
+		tokens: burst,
+		last:   now(),
+	}
+}
+
+// reset refills the bucket, as if the rateLimiter was newly created.
+func (l *rateLimiter) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens, l.last = l.burst, l.now()
+}
+
+// advance adds the tokens accumulated since the last call to advance. The
+// caller must hold l.mu.
+func (l *rateLimiter) advance() {
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+// allow consumes a token and reports true if one is available, or reports
+// false otherwise.
+func (l *rateLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.advance()
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+	return true
+}
+
+// reserve consumes a token, and returns how long the caller must wait before
+// the token is available.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.advance()
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
@@ -0,0 +1,68 @@
+package packet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+
+	// 1000 frames per second permits a burst of 10 frames, and then a frame
+	// each millisecond.
+	l := newRateLimiter(1000, clock)
+
+	var allowed int
+	for i := 0; i < 20; i++ {
+		if l.allow() {
+			allowed++
+		}
+	}
+	if diff := cmp.Diff(10, allowed); diff != "" {
+		t.Fatalf("unexpected burst size (-want +got):\n%s", diff)
+	}
+
+	now = now.Add(5 * time.Millisecond)
+	allowed = 0
+	for i := 0; i < 20; i++ {
+		if l.allow() {
+			allowed++
+		}
+	}
+	if diff := cmp.Diff(5, allowed); diff != "" {
+		t.Fatalf("unexpected frames after 5ms (-want +got):\n%s", diff)
+	}
+
+	// Reservations beyond the available tokens must wait for each token in
+	// turn.
+	for i := 1; i <= 3; i++ {
+		if diff := cmp.Diff(time.Duration(i)*time.Millisecond, l.reserve()); diff != "" {
+			t.Fatalf("unexpected wait for reservation %d (-want +got):\n%s", i, diff)
+		}
+	}
+
+	// Idle time refills the bucket only up to the burst size.
+	now = now.Add(time.Hour)
+	for i := 0; i < 10; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Fatalf("unexpected wait for burst reservation %d: %v", i, d)
+		}
+	}
+	if d := l.reserve(); d == 0 {
+		t.Fatal("expected a wait after exhausting the burst")
+	}
+
+	// Resetting repays the debt and refills the bucket without idle time.
+	l.reset()
+	for i := 0; i < 10; i++ {
+		if !l.allow() {
+			t.Fatalf("frame %d was not allowed after reset", i)
+		}
+	}
+	if l.allow() {
+		t.Fatal("expected no frames after exhausting the burst")
+	}
+}
@@ -0,0 +1,441 @@
+package packet
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/bpf"
+)
+
+var _ net.PacketConn = &ReliableConn{}
+
+// listenReliable looks up the named interface and opens a Conn on it. Tests
+// may replace it to simulate the loss and return of an interface.
+var listenReliable = func(name string, socketType Type, protocol int, cfg *Config) (*Conn, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return Listen(ifi, socketType, protocol, cfg)
+}
+
+// A ReconnectEventType is the type of a ReconnectEvent.
+//
+//enumcheck:exhaustive
+type ReconnectEventType int
+
+// Possible ReconnectEventType values.
+const (
+	// ReconnectDisconnected reports that the Conn failed with a fatal error
+	// and was closed.
+	ReconnectDisconnected ReconnectEventType = iota
+
+	// ReconnectFailed reports that an attempt to open a new Conn failed.
+	ReconnectFailed
+
+	// ReconnectConnected reports that a new Conn was opened.
+	ReconnectConnected
+)
+
+// A ReconnectEvent describes a change in the state of a ReliableConn.
+type ReconnectEvent struct {
+	// Type is the type of the event.
+	Type ReconnectEventType
+
+	// Attempt is the number of attempts made to open a new Conn since the
+	// previous Conn failed, or 0 for ReconnectDisconnected events.
+	Attempt int
+
+	// Err is the error which caused the Conn to fail for
+	// ReconnectDisconnected events, the error from the failed attempt for
+	// ReconnectFailed events, and nil for ReconnectConnected events.
+	Err error
+}
+
+// A ReconnectPolicy configures how a ReliableConn reopens its Conn.
+type ReconnectPolicy struct {
+	// Backoff is the delay after the first failed attempt to open a new Conn,
+	// which is doubled after each subsequent failure. If zero, a delay of 100
+	// milliseconds is used.
+	Backoff time.Duration
+
+	// MaxBackoff caps the delay between attempts. If zero, a cap of 30
+	// seconds is used.
+	MaxBackoff time.Duration
+
+	// OnEvent, if non-nil, is invoked with each ReconnectEvent, such as to
+	// log or count reconnections. It is called from the goroutine which
+	// observed the failure or from the background goroutine which
+	// reconnects, so it should return promptly.
+	OnEvent func(ReconnectEvent)
+}
+
+// A ReliableConn is a net.PacketConn which wraps a Conn and transparently
+// opens a new Conn when the current Conn fails because its network interface
+// was removed or went down, such as when a USB adapter is unplugged or a
+// virtual interface is recreated. ReliableConn packages this resilience for
+// long-lived services which capture on an interface by name.
+//
+// Frames which arrive while no Conn is open are not captured.
+type ReliableConn struct {
+	name       string
+	socketType Type
+	protocol   int
+	policy     ReconnectPolicy
+	done       chan struct{}
+
+	mu sync.Mutex
+	// The current Conn, or nil while reconnecting, in which case ready is
+	// closed once a new Conn is opened.
+	c      *Conn
+	ready  chan struct{}
+	closed bool
+
+	// Settings which are applied to each new Conn.
+	cfg           Config
+	addr          net.Addr
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// ListenReliable opens a Conn on the network interface with the specified
+// name using Listen, and returns a ReliableConn which wraps it. If policy is
+// nil, the default ReconnectPolicy is used.
+//
+// When a read or write fails with an error which indicates that the interface
+// was removed (ENODEV, ENXIO, or an error compatible with
+// errors.Is(err, ErrInterfaceUnavailable)), the ReliableConn closes the Conn
+// and a background goroutine looks up the interface by name and opens a new
+// Conn with cfg, retrying with exponential backoff until it succeeds or the
+// ReliableConn is closed. Changes made by SetBPF and SetPromiscuous are
+// stored in cfg so that they also apply to each new Conn, along with the
+// remaining fields of cfg such as Direction.
+//
+// An interface which goes down but is not removed keeps its Conns, which
+// receive frames again once it comes back up. The kernel reports ENETDOWN to
+// one read when the interface goes down, so reads continue on the same Conn,
+// while writes return ENETDOWN until the interface is up.
+//
+// Reads and writes block while the ReliableConn is reconnecting, until the
+// read or write deadline expires, and then continue on the new Conn. Other
+// errors are returned to the caller without reconnecting.
+func ListenReliable(name string, socketType Type, protocol int, cfg *Config, policy *ReconnectPolicy) (*ReliableConn, error) {
+	r := &ReliableConn{
+		name:       name,
+		socketType: socketType,
+		protocol:   protocol,
+		done:       make(chan struct{}),
+	}
+	if cfg != nil {
+		r.cfg = *cfg
+	}
+	if policy != nil {
+		r.policy = *policy
+	}
+	if r.policy.Backoff == 0 {
+		r.policy.Backoff = 100 * time.Millisecond
+	}
+	if r.policy.MaxBackoff == 0 {
+		r.policy.MaxBackoff = 30 * time.Second
+	}
+
+	c, err := r.listen()
+	if err != nil {
+		return nil, err
+	}
+
+	r.c = c
+	r.addr = c.LocalAddr()
+	return r, nil
+}
+
+// ReadFrom implements the net.PacketConn ReadFrom method.
+func (r *ReliableConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c, err := r.conn(opRead)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		n, addr, err := c.ReadFrom(b)
+		if errors.Is(err, syscall.ENETDOWN) {
+			// The socket is still bound and has consumed the error.
+			continue
+		}
+		if err == nil || !r.fail(c, err) {
+			return n, addr, err
+		}
+	}
+}
+
+// WriteTo implements the net.PacketConn WriteTo method.
+func (r *ReliableConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	for {
+		c, err := r.conn(opWrite)
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := c.WriteTo(b, addr)
+		if err == nil || !r.fail(c, err) {
+			return n, err
+		}
+	}
+}
+
+// Close closes the current Conn and stops any reconnection in progress.
+func (r *ReliableConn) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return opError(opClose, net.ErrClosed, r.addr)
+	}
+	r.closed = true
+	close(r.done)
+
+	if r.c == nil {
+		return nil
+	}
+
+	return r.c.Close()
+}
+
+// LocalAddr returns the local network address of the current Conn, or of the
+// most recent Conn while reconnecting.
+func (r *ReliableConn) LocalAddr() net.Addr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.addr
+}
+
+// SetDeadline implements the net.PacketConn SetDeadline method.
+func (r *ReliableConn) SetDeadline(t time.Time) error {
+	return r.setDeadlines(&t, &t)
+}
+
+// SetReadDeadline implements the net.PacketConn SetReadDeadline method.
+func (r *ReliableConn) SetReadDeadline(t time.Time) error {
+	return r.setDeadlines(&t, nil)
+}
+
+// SetWriteDeadline implements the net.PacketConn SetWriteDeadline method.
+func (r *ReliableConn) SetWriteDeadline(t time.Time) error {
+	return r.setDeadlines(nil, &t)
+}
+
+// SetBPF attaches an assembled BPF program to the current Conn, and to each
+// Conn opened by later reconnections in place of Config.Filter.
+func (r *ReliableConn) SetBPF(filter []bpf.RawInstruction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.c != nil {
+		if err := r.c.SetBPF(filter); err != nil {
+			return err
+		}
+	}
+
+	r.cfg.Filter = append([]bpf.RawInstruction(nil), filter...)
+	return nil
+}
+
+// SetPromiscuous enables or disables promiscuous mode on the current Conn,
+// and on each Conn opened by later reconnections in place of
+// Config.Promiscuous.
+func (r *ReliableConn) SetPromiscuous(enable bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.c != nil {
+		if err := r.c.SetPromiscuous(enable); err != nil {
+			return err
+		}
+	}
+
+	r.cfg.Promiscuous = enable
+	return nil
+}
+
+// setDeadlines stores the non-nil read and write deadlines and applies them
+// to the current Conn.
+func (r *ReliableConn) setDeadlines(read, write *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if read != nil {
+		r.readDeadline = *read
+		if r.c != nil {
+			if err := r.c.SetReadDeadline(*read); err != nil {
+				return err
+			}
+		}
+	}
+
+	if write != nil {
+		r.writeDeadline = *write
+		if r.c != nil {
+			if err := r.c.SetWriteDeadline(*write); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// conn returns the current Conn, waiting for a reconnection to complete if
+// necessary, until the read or write deadline for op expires.
+func (r *ReliableConn) conn(op string) (*Conn, error) {
+	for {
+		r.mu.Lock()
+		c, ready, closed, addr := r.c, r.ready, r.closed, r.addr
+		deadline := r.readDeadline
+		if op == opWrite {
+			deadline = r.writeDeadline
+		}
+		r.mu.Unlock()
+
+		switch {
+		case closed:
+			return nil, opError(op, net.ErrClosed, addr)
+		case c != nil:
+			return c, nil
+		}
+
+		if err := r.wait(ready, deadline); err != nil {
+			return nil, opError(op, err, addr)
+		}
+	}
+}
+
+// wait waits until ready or r.done is closed, or until deadline expires if it
+// is not zero.
+func (r *ReliableConn) wait(ready <-chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-ready:
+		return nil
+	case <-r.done:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+// fail handles err returned by an operation on c, and reports whether the
+// operation should be retried on a new Conn. If err is fatal and c is the
+// current Conn, fail closes c and starts a reconnection.
+func (r *ReliableConn) fail(c *Conn, err error) bool {
+	r.mu.Lock()
+	switch {
+	case r.closed:
+		r.mu.Unlock()
+		return false
+	case r.c != c:
+		// c was already replaced, and may have been closed by another
+		// goroutine which observed the failure first.
+		r.mu.Unlock()
+		return true
+	case !isInterfaceLost(err):
+		r.mu.Unlock()
+		return false
+	}
+
+	_ = c.Close()
+	r.c = nil
+	r.ready = make(chan struct{})
+	ready := r.ready
+	r.mu.Unlock()
+
+	r.event(ReconnectEvent{Type: ReconnectDisconnected, Err: err})
+	go r.reconnect(ready)
+	return true
+}
+
+// reconnect opens a new Conn with backoff until it succeeds or the
+// ReliableConn is closed, and then closes ready.
+func (r *ReliableConn) reconnect(ready chan struct{}) {
+	backoff := r.policy.Backoff
+	for attempt := 1; ; attempt++ {
+		c, err := r.listen()
+		if err == nil {
+			r.mu.Lock()
+			if r.closed {
+				r.mu.Unlock()
+				_ = c.Close()
+				return
+			}
+
+			r.c = c
+			r.addr = c.LocalAddr()
+			r.applyDeadlines(c)
+			close(ready)
+			r.mu.Unlock()
+
+			r.event(ReconnectEvent{Type: ReconnectConnected, Attempt: attempt})
+			return
+		}
+
+		r.event(ReconnectEvent{Type: ReconnectFailed, Attempt: attempt, Err: err})
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-r.done:
+			t.Stop()
+			return
+		}
+
+		if backoff *= 2; backoff > r.policy.MaxBackoff {
+			backoff = r.policy.MaxBackoff
+		}
+	}
+}
+
+// listen opens a new Conn using the current settings.
+func (r *ReliableConn) listen() (*Conn, error) {
+	r.mu.Lock()
+	cfg := r.cfg
+	r.mu.Unlock()
+
+	return listenReliable(r.name, r.socketType, r.protocol, &cfg)
+}
+
+// applyDeadlines applies the stored deadlines to c. The caller must hold r.mu.
+func (r *ReliableConn) applyDeadlines(c *Conn) {
+	// Errors cannot be reported to any caller here, so they are ignored.
+	if !r.readDeadline.IsZero() {
+		_ = c.SetReadDeadline(r.readDeadline)
+	}
+	if !r.writeDeadline.IsZero() {
+		_ = c.SetWriteDeadline(r.writeDeadline)
+	}
+}
+
+// event invokes the OnEvent callback, if any.
+func (r *ReliableConn) event(e ReconnectEvent) {
+	if r.policy.OnEvent != nil {
+		r.policy.OnEvent(e)
+	}
+}
+
+// isInterfaceLost reports whether err indicates that a Conn's network
+// interface was removed.
+func isInterfaceLost(err error) bool {
+	return errors.Is(err, ErrInterfaceUnavailable) ||
+		errors.Is(err, syscall.ENODEV) ||
+		errors.Is(err, syscall.ENXIO)
+}
@@ -0,0 +1,64 @@
+//go:build linux
+// +build linux
+
+package packet
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Wrappers for socket options which are not supported by package unix or
+// package socket.
+
+// getsockopt wraps getsockopt(2) for an arbitrary value pointed to by p. l is
+// the size of the value on input and the size returned by the kernel on
+// output.
+func getsockopt(fd, level, opt int, p unsafe.Pointer, l *uint32) error {
+	_, _, errno := unix.Syscall6(
+		unix.SYS_GETSOCKOPT,
+		uintptr(fd), uintptr(level), uintptr(opt),
+		uintptr(p), uintptr(unsafe.Pointer(l)), 0,
+	)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// setsockopt wraps setsockopt(2) for an arbitrary value of l bytes pointed to
+// by p.
+func setsockopt(fd, level, opt int, p unsafe.Pointer, l uintptr) error {
+	_, _, errno := unix.Syscall6(
+		unix.SYS_SETSOCKOPT,
+		uintptr(fd), uintptr(level), uintptr(opt),
+		uintptr(p), l, 0,
+	)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// control executes fn against the file descriptor of c and returns any error
+// produced by either the syscall.RawConn or fn, wrapped in os.SyscallError
+// using name.
+func (c *Conn) control(name string, fn func(fd int) error) error {
+	rc, err := c.c.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var ferr error
+	if err := rc.Control(func(fd uintptr) {
+		ferr = fn(int(fd))
+	}); err != nil {
+		return err
+	}
+
+	return os.NewSyscallError(name, ferr)
+}
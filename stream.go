@@ -0,0 +1,137 @@
+package packet
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// streamReadSize is the size of the buffer used by Stream to read frames,
+// which is large enough for any frame received by a packet socket.
+const streamReadSize = 1 << 16
+
+// A BufferPool supplies buffers for frames read by Conn.Stream. A BufferPool
+// must be safe for concurrent use.
+//
+// Get must return a buffer large enough for any frame the Conn may receive,
+// such as a buffer of the interface's MTU plus the length of the link layer
+// header; larger frames are truncated. Stream returns each buffer obtained
+// from Get to the caller in Frame.Data, and the caller owns the buffer from
+// then on: it should return the buffer to the pool with Put once it is
+// finished with the frame. Stream calls Put itself only for buffers which it
+// does not deliver, and does not retain any buffer after calling Put.
+//
+// Put may receive a slice whose length is shorter than the buffer returned by
+// Get, but which has the same underlying array and capacity.
+type BufferPool interface {
+	Get() []byte
+	Put(b []byte)
+}
+
+// A Frame is a frame received by Conn.Stream.
+type Frame struct {
+	// Data contains the contents of the frame. If the Conn's Config has a
+	// BufferPool, Data was obtained from the pool and should be returned to
+	// it once the caller is finished with the frame.
+	Data []byte
+
+	// Addr is the source address of the frame.
+	Addr net.Addr
+
+	// Timestamp is the time at which the frame was read from the socket.
+	Timestamp time.Time
+}
+
+// Stream starts a goroutine which reads frames from the Conn and sends them
+// on the returned channel, which buffers up to bufSize frames.
+//
+// When the channel's buffer is full, the goroutine blocks until the consumer
+// receives a frame and does not read from the Conn in the meantime. Frames
+// which arrive while the goroutine is blocked are queued by the kernel, and
+// once the socket's receive buffer is full, they are dropped and counted by
+// Stats rather than consuming additional memory.
+//
+// Each frame is read into a buffer from the Conn's Config.BufferPool, or into a
+// newly allocated buffer if the Config has no BufferPool. Empty frames are
+// discarded as described by ReadFrom.
+//
+// The channel is closed when ctx is canceled or when a read fails. To unblock
+// a pending read when ctx is canceled, Stream sets the Conn's read deadline to
+// the current time, so the deadline must be reset before the Conn is read
+// again. The Conn must not be read by other goroutines until the channel is
+// closed.
+func (c *Conn) Stream(ctx context.Context, bufSize int) <-chan Frame {
+	frames := make(chan Frame, bufSize)
+	go c.stream(ctx, frames)
+	return frames
+}
+
+// stream implements Stream by reading frames in the calling goroutine until
+// ctx is canceled or a read fails, and then closing frames.
+func (c *Conn) stream(ctx context.Context, frames chan<- Frame) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	done := make(chan struct{})
+	go func() {
+		defer wg.Done()
+
+		select {
+		case <-ctx.Done():
+			_ = c.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	defer func() {
+		// Wait for any deadline to be set before signaling completion.
+		close(done)
+		wg.Wait()
+		close(frames)
+	}()
+
+	// Without a BufferPool, read into a single buffer and copy each frame
+	// into a buffer of exactly the right size.
+	var scratch []byte
+	if c.pool == nil {
+		scratch = make([]byte, streamReadSize)
+	}
+
+	for ctx.Err() == nil {
+		b := scratch
+		if c.pool != nil {
+			b = c.pool.Get()
+		}
+
+		n, addr, err := c.ReadFrom(b)
+		if err != nil {
+			c.putBuffer(b)
+			return
+		}
+
+		data := b[:n]
+		if c.pool == nil {
+			data = append([]byte(nil), data...)
+		}
+
+		f := Frame{
+			Data:      data,
+			Addr:      addr,
+			Timestamp: time.Now(),
+		}
+
+		select {
+		case frames <- f:
+		case <-ctx.Done():
+			c.putBuffer(b)
+			return
+		}
+	}
+}
+
+// putBuffer returns b to the Conn's BufferPool, if it has one.
+func (c *Conn) putBuffer(b []byte) {
+	if c.pool != nil {
+		c.pool.Put(b)
+	}
+}
@@ -0,0 +1,118 @@
+//go:build linux
+// +build linux
+
+package packet
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestConnStreamBufferPool(t *testing.T) {
+	pool := make(chanBufferPool, 1)
+	c := testStreamConn(pool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := c.Stream(ctx, 1)
+
+	f := <-frames
+	if len(f.Data) != testStreamFrameLen {
+		t.Fatalf("unexpected frame length: %d", len(f.Data))
+	}
+	if cap(f.Data) != testStreamBufferLen {
+		t.Fatalf("frame was not read into a pool buffer, capacity: %d", cap(f.Data))
+	}
+
+	// Once returned, the buffer is reused for a later frame.
+	pool.Put(f.Data)
+	reused := &f.Data[:1][0]
+
+	for f := range frames {
+		if &f.Data[:1][0] == reused {
+			cancel()
+		}
+		pool.Put(f.Data)
+	}
+}
+
+func BenchmarkConnStream(b *testing.B) {
+	tests := []struct {
+		name string
+		pool BufferPool
+	}{
+		{name: "allocate"},
+		{name: "pool", pool: make(chanBufferPool, 128)},
+	}
+
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			c := testStreamConn(tt.pool)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			frames := c.Stream(ctx, 64)
+
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			gcs := ms.NumGC
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				f := <-frames
+				c.putBuffer(f.Data)
+			}
+
+			b.StopTimer()
+			runtime.ReadMemStats(&ms)
+			b.ReportMetric(float64(ms.NumGC-gcs)/float64(b.N), "gcs/op")
+
+			cancel()
+			for f := range frames {
+				c.putBuffer(f.Data)
+			}
+		})
+	}
+}
+
+const (
+	testStreamFrameLen  = 1514
+	testStreamBufferLen = 2048
+)
+
+// testStreamConn produces a Conn which immediately receives a full-sized frame
+// on every read.
+func testStreamConn(pool BufferPool) *Conn {
+	sa := &unix.SockaddrLinklayer{Halen: 6}
+	fc := &fakeConn{
+		recv: func(p []byte) (int, unix.Sockaddr, error) {
+			return len(p[:testStreamFrameLen]), sa, nil
+		},
+	}
+
+	return &Conn{c: fc, addr: &Addr{}, pool: pool}
+}
+
+// A chanBufferPool is a BufferPool which stores free buffers in a channel.
+type chanBufferPool chan []byte
+
+func (p chanBufferPool) Get() []byte {
+	select {
+	case b := <-p:
+		return b[:cap(b)]
+	default:
+		return make([]byte, testStreamBufferLen)
+	}
+}
+
+func (p chanBufferPool) Put(b []byte) {
+	select {
+	case p <- b:
+	default:
+	}
+}
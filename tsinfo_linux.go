@@ -0,0 +1,77 @@
+//go:build linux
+// +build linux
+
+package packet
+
+import (
+	"github.com/josharian/native"
+	"golang.org/x/sys/unix"
+)
+
+// sizeofEthtoolTSInfo is the size of struct ethtool_ts_info.
+const sizeofEthtoolTSInfo = 48
+
+// An ethtoolTSInfo is the subset of struct ethtool_ts_info used by the package.
+type ethtoolTSInfo struct {
+	soTimestamping uint32
+	phcIndex       int32
+	txTypes        uint32
+	rxFilters      uint32
+}
+
+// tsInfo wraps the ETHTOOL_GET_TS_INFO ethtool command.
+func (c *Conn) tsInfo() (*ethtoolTSInfo, error) {
+	// struct ethtool_ts_info {
+	// 	__u32 cmd;
+	// 	__u32 so_timestamping;
+	// 	__s32 phc_index;
+	// 	__u32 tx_types;
+	// 	__u32 tx_reserved[3];
+	// 	__u32 rx_filters;
+	// 	__u32 rx_reserved[3];
+	// };
+	b := make([]byte, sizeofEthtoolTSInfo)
+	native.Endian.PutUint32(b[0:4], unix.ETHTOOL_GET_TS_INFO)
+	if err := c.ethtool(b); err != nil {
+		return nil, err
+	}
+
+	return &ethtoolTSInfo{
+		soTimestamping: native.Endian.Uint32(b[4:8]),
+		phcIndex:       int32(native.Endian.Uint32(b[8:12])),
+		txTypes:        native.Endian.Uint32(b[12:16]),
+		rxFilters:      native.Endian.Uint32(b[28:32]),
+	}, nil
+}
+
+// timestampCapabilities reports timestamping capabilities from
+// ETHTOOL_GET_TS_INFO.
+func (c *Conn) timestampCapabilities() (*TSCaps, error) {
+	info, err := c.tsInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	has := func(flag uint32) bool { return info.soTimestamping&flag != 0 }
+
+	return &TSCaps{
+		SoftwareRX:  has(unix.SOF_TIMESTAMPING_RX_SOFTWARE),
+		SoftwareTX:  has(unix.SOF_TIMESTAMPING_TX_SOFTWARE),
+		HardwareRX:  has(unix.SOF_TIMESTAMPING_RX_HARDWARE),
+		HardwareTX:  has(unix.SOF_TIMESTAMPING_TX_HARDWARE),
+		RawHardware: has(unix.SOF_TIMESTAMPING_RAW_HARDWARE),
+		PHCIndex:    int(info.phcIndex),
+		TXTypes:     info.txTypes,
+		RXFilters:   info.rxFilters,
+	}, nil
+}
+
+// phcIndex reports the PTP hardware clock index from ETHTOOL_GET_TS_INFO.
+func (c *Conn) phcIndex() (int, error) {
+	info, err := c.tsInfo()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(info.phcIndex), nil
+}
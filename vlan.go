@@ -0,0 +1,74 @@
+package packet
+
+import "encoding/binary"
+
+// Tag protocol identifiers (TPIDs) of VLAN tags.
+const (
+	tpid8021Q  = 0x8100
+	tpid8021AD = 0x88a8
+
+	// A TPID used by some equipment for outer tags prior to the
+	// standardization of 802.1ad.
+	tpidQinQ = 0x9100
+)
+
+// A VLANTag is an IEEE 802.1Q or 802.1ad VLAN tag.
+type VLANTag struct {
+	// TPID is the tag protocol identifier, such as 0x8100 for an 802.1Q tag
+	// or 0x88a8 for an 802.1ad service tag.
+	TPID uint16
+
+	// TCI is the tag control information, which contains the priority, drop
+	// eligible indicator, and VLAN ID.
+	TCI uint16
+}
+
+// ID returns the VLAN ID carried by the tag.
+func (t VLANTag) ID() uint16 { return t.TCI & 0x0fff }
+
+// Priority returns the priority code point carried by the tag.
+func (t VLANTag) Priority() uint8 { return uint8(t.TCI >> 13) }
+
+// VLANTags reconstructs the stack of VLAN tags of a received frame, ordered
+// from outermost to innermost. frame must begin with an Ethernet header, as
+// frames read by Raw Conns do, or be nil if the header is unavailable. a is
+// the frame's Auxdata, or nil if it is unavailable.
+//
+// Network interfaces with VLAN offload strip the outermost tag from received
+// frames, in which case the kernel reports it in Auxdata instead, and any
+// inner tags remain in the frame. Otherwise, all tags remain in the frame. So
+// if a reports a valid tag, that tag is placed first, followed by the tags
+// found in the frame after its source MAC address. Kernels older than Linux
+// 3.14 do not report the TPID of a stripped tag, in which case 802.1Q
+// (0x8100) is assumed. In-frame tags are recognized by the TPIDs 0x8100,
+// 0x88a8, and 0x9100, and parsing stops at the first other EtherType or at
+// the end of a truncated frame.
+func VLANTags(frame []byte, a *Auxdata) []VLANTag {
+	var tags []VLANTag
+	if a != nil && a.VLANValid {
+		tpid := a.VLANTPID
+		if tpid == 0 {
+			tpid = tpid8021Q
+		}
+
+		tags = append(tags, VLANTag{TPID: tpid, TCI: a.VLANTCI})
+	}
+
+	// Each tag occupies the 4 bytes where the EtherType would otherwise be
+	// found, beginning after the destination and source MAC addresses.
+	for off := 12; len(frame) >= off+4; off += 4 {
+		tpid := binary.BigEndian.Uint16(frame[off : off+2])
+		switch tpid {
+		case tpid8021Q, tpid8021AD, tpidQinQ:
+		default:
+			return tags
+		}
+
+		tags = append(tags, VLANTag{
+			TPID: tpid,
+			TCI:  binary.BigEndian.Uint16(frame[off+2 : off+4]),
+		})
+	}
+
+	return tags
+}
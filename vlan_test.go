@@ -0,0 +1,92 @@
+package packet_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/packet"
+)
+
+func TestVLANTags(t *testing.T) {
+	// An Ethernet header with the specified tags following its addresses,
+	// and an IPv4 EtherType.
+	frame := func(tags ...byte) []byte {
+		b := []byte{
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		}
+		b = append(b, tags...)
+		return append(b, 0x08, 0x00)
+	}
+
+	var (
+		outer = []byte{0x88, 0xa8, 0x20, 0x64} // 802.1ad, priority 1, VLAN 100.
+		inner = []byte{0x81, 0x00, 0x00, 0xc8} // 802.1Q, VLAN 200.
+
+		outerTag = packet.VLANTag{TPID: 0x88a8, TCI: 0x2064}
+		innerTag = packet.VLANTag{TPID: 0x8100, TCI: 0x00c8}
+	)
+
+	tests := []struct {
+		name  string
+		frame []byte
+		a     *packet.Auxdata
+		tags  []packet.VLANTag
+	}{
+		{
+			name:  "untagged",
+			frame: frame(),
+		},
+		{
+			name:  "Q-in-Q in frame",
+			frame: frame(append(outer, inner...)...),
+			tags:  []packet.VLANTag{outerTag, innerTag},
+		},
+		{
+			name:  "Q-in-Q outer stripped",
+			frame: frame(inner...),
+			a:     &packet.Auxdata{VLANValid: true, VLANTPID: 0x88a8, VLANTCI: 0x2064},
+			tags:  []packet.VLANTag{outerTag, innerTag},
+		},
+		{
+			name:  "stripped no TPID",
+			frame: frame(),
+			a:     &packet.Auxdata{VLANValid: true, VLANTCI: 0x00c8},
+			tags:  []packet.VLANTag{innerTag},
+		},
+		{
+			name:  "auxdata invalid",
+			frame: frame(inner...),
+			a:     &packet.Auxdata{VLANTCI: 0x2064},
+			tags:  []packet.VLANTag{innerTag},
+		},
+		{
+			name: "no frame",
+			a:    &packet.Auxdata{VLANValid: true, VLANTPID: 0x88a8, VLANTCI: 0x2064},
+			tags: []packet.VLANTag{outerTag},
+		},
+		{
+			name:  "truncated",
+			frame: frame(append(outer, inner...)...)[:18],
+			tags:  []packet.VLANTag{outerTag},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.tags, packet.VLANTags(tt.frame, tt.a)); diff != "" {
+				t.Fatalf("unexpected tags (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVLANTagFields(t *testing.T) {
+	tag := packet.VLANTag{TPID: 0x8100, TCI: 0xa064}
+	if diff := cmp.Diff(uint16(100), tag.ID()); diff != "" {
+		t.Fatalf("unexpected ID (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(uint8(5), tag.Priority()); diff != "" {
+		t.Fatalf("unexpected priority (-want +got):\n%s", diff)
+	}
+}
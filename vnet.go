@@ -0,0 +1,102 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// vnetHdrLen is the length of a virtio_net_hdr structure.
+const vnetHdrLen = 10
+
+// Possible VnetHdr.Flags bits.
+//
+// When writing a frame, VnetHdrFNeedsCsum requests that the checksum for the
+// frame's transport layer be computed by the kernel or network interface
+// (CHECKSUM_PARTIAL). The checksum is computed over the bytes from CsumStart to
+// the end of the frame and stored at CsumStart+CsumOffset. The checksum field
+// should be seeded with the transport layer's pseudo-header checksum, as is the
+// convention for checksum offload.
+const (
+	VnetHdrFNeedsCsum uint8 = 0x1
+	VnetHdrFDataValid uint8 = 0x2
+)
+
+// Possible VnetHdr.GSOType values.
+const (
+	VnetHdrGSONone  uint8 = 0x0
+	VnetHdrGSOTCPv4 uint8 = 0x1
+	VnetHdrGSOUDP   uint8 = 0x3
+	VnetHdrGSOTCPv6 uint8 = 0x4
+	VnetHdrGSOUDPL4 uint8 = 0x5
+	VnetHdrGSOECN   uint8 = 0x80
+)
+
+// A VnetHdr is a virtio_net_hdr structure, which carries checksum and
+// segmentation offload metadata for a frame. The Linux kernel prepends a
+// VnetHdr to each frame read from a Conn when Config.VnetHdr is set, and
+// expects a VnetHdr to precede each frame written to the Conn.
+//
+// VnetHdr uses the legacy (pre-virtio 1.0) virtio_net_hdr layout from
+// linux/virtio_net.h, which is 10 bytes long with all fields in host byte
+// order. The num_buffers field used by mergeable receive buffers is not
+// present.
+//
+//	u8  flags
+//	u8  gso_type
+//	u16 hdr_len
+//	u16 gso_size
+//	u16 csum_start
+//	u16 csum_offset
+//
+// When generic receive offload (GRO) is enabled, a single frame may exceed the
+// interface MTU. In that case GSOType is non-zero and GSOSize reports the size
+// of the segments which were coalesced into the frame. When writing, setting
+// GSOType and GSOSize asks the kernel to segment a large frame.
+type VnetHdr struct {
+	Flags      uint8
+	GSOType    uint8
+	HdrLen     uint16
+	GSOSize    uint16
+	CsumStart  uint16
+	CsumOffset uint16
+}
+
+// unmarshal unpacks a VnetHdr in the specified byte order from b, which must
+// be at least vnetHdrLen bytes. Linux uses the host's native byte order for
+// the virtio_net_hdr of a packet socket.
+func (h *VnetHdr) unmarshal(b []byte, order binary.ByteOrder) {
+	*h = VnetHdr{
+		Flags:      b[0],
+		GSOType:    b[1],
+		HdrLen:     order.Uint16(b[2:4]),
+		GSOSize:    order.Uint16(b[4:6]),
+		CsumStart:  order.Uint16(b[6:8]),
+		CsumOffset: order.Uint16(b[8:10]),
+	}
+}
+
+// marshal packs a VnetHdr in the specified byte order into b, which must be at
+// least vnetHdrLen bytes.
+func (h *VnetHdr) marshal(b []byte, order binary.ByteOrder) {
+	b[0] = h.Flags
+	b[1] = h.GSOType
+	order.PutUint16(b[2:4], h.HdrLen)
+	order.PutUint16(b[4:6], h.GSOSize)
+	order.PutUint16(b[6:8], h.CsumStart)
+	order.PutUint16(b[8:10], h.CsumOffset)
+}
+
+// validate verifies that h describes a valid virtio_net_hdr for a frame of n
+// bytes being transmitted.
+func (h *VnetHdr) validate(n int) error {
+	if h.Flags&VnetHdrFNeedsCsum == 0 {
+		return nil
+	}
+
+	// The 16-bit checksum field must lie within the frame.
+	if int(h.CsumStart)+int(h.CsumOffset)+2 > n {
+		return errors.New("packet: virtio_net_hdr checksum offset exceeds frame length")
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package packet
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVnetHdrMarshal(t *testing.T) {
+	h := VnetHdr{
+		Flags:      VnetHdrFNeedsCsum,
+		GSOType:    VnetHdrGSOTCPv4,
+		HdrLen:     0x0102,
+		GSOSize:    0x0304,
+		CsumStart:  0x0506,
+		CsumOffset: 0x0708,
+	}
+
+	tests := []struct {
+		order binary.ByteOrder
+		b     []byte
+	}{
+		{
+			order: binary.LittleEndian,
+			b:     []byte{0x01, 0x01, 0x02, 0x01, 0x04, 0x03, 0x06, 0x05, 0x08, 0x07},
+		},
+		{
+			order: binary.BigEndian,
+			b:     []byte{0x01, 0x01, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order.String(), func(t *testing.T) {
+			b := make([]byte, vnetHdrLen)
+			h.marshal(b, tt.order)
+			if diff := cmp.Diff(tt.b, b); diff != "" {
+				t.Fatalf("unexpected bytes (-want +got):\n%s", diff)
+			}
+
+			var got VnetHdr
+			got.unmarshal(tt.b, tt.order)
+			if diff := cmp.Diff(h, got); diff != "" {
+				t.Fatalf("unexpected VnetHdr (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVnetHdrValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		h    VnetHdr
+		n    int
+		ok   bool
+	}{
+		{
+			name: "no checksum",
+			h:    VnetHdr{CsumStart: 100, CsumOffset: 100},
+			n:    10,
+			ok:   true,
+		},
+		{
+			name: "UDP checksum",
+			h: VnetHdr{
+				Flags:      VnetHdrFNeedsCsum,
+				CsumStart:  14 + 20,
+				CsumOffset: 6,
+			},
+			n:  14 + 20 + 8,
+			ok: true,
+		},
+		{
+			name: "checksum out of bounds",
+			h: VnetHdr{
+				Flags:      VnetHdrFNeedsCsum,
+				CsumStart:  14 + 20,
+				CsumOffset: 7,
+			},
+			n: 14 + 20 + 8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.h.validate(tt.n)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to validate: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}